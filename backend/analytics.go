@@ -0,0 +1,475 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// snapshotBidStat сохраняет учётную запись заявки по её текущим данным; повторный вызов
+// обновляет возраст и стаж, не трогая дату подачи и исход.
+func snapshotBidStat(tx *sql.Tx, bidID int) error {
+	_, err := tx.Exec(`
+        INSERT INTO bid_stat (bid_id, job_title_id, subdivision_id, age, overall_experience, s_p_experience, submitted_at)
+        SELECT id, job_title_id, subdivision_id, age, overall_experience, s_p_experience, created_at
+        FROM employee_bid_computed WHERE id = $1
+        ON CONFLICT (bid_id) DO UPDATE SET
+            age = EXCLUDED.age, overall_experience = EXCLUDED.overall_experience, s_p_experience = EXCLUDED.s_p_experience
+    `, bidID)
+	return err
+}
+
+// closeBidStat фиксирует исход заявки: accepted, rejected, withdrawn или merged.
+func closeBidStat(tx *sql.Tx, bidID int, outcome string) error {
+	_, err := tx.Exec("UPDATE bid_stat SET outcome = $2, decided_at = NOW() WHERE bid_id = $1 AND outcome IS NULL", bidID, outcome)
+	return err
+}
+
+// analyticsRange разбирает ?from= и ?to= (YYYY-MM-DD, включительно); по умолчанию — последние 30 дней.
+func analyticsRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if to != "" {
+		d, err := time.ParseInLocation(dateLayout, to, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to")
+		}
+		end = d
+	}
+	start := end.AddDate(0, 0, -29)
+	if from != "" {
+		d, err := time.ParseInLocation(dateLayout, from, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from")
+		}
+		start = d
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	return start, end, nil
+}
+
+type analyticsGrouping struct {
+	column string
+	table  string
+}
+
+var analyticsGroupings = map[string]analyticsGrouping{
+	"none":        {"NULL::int", ""},
+	"job_title":   {"s.job_title_id", "job_title"},
+	"subdivision": {"s.subdivision_id", "subdivision"},
+}
+
+// bidStatFilter собирает общие фильтры по bid_stat: период по column и ?job_title_id=, ?subdivision_id=.
+func bidStatFilter(c *gin.Context, column string) (*queryBuilder, error) {
+	from, to, err := analyticsRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	qb := &queryBuilder{}
+	qb.where(column+" >= %s AND "+column+" < %s", from, to.AddDate(0, 0, 1))
+	if err := qb.inFilter(c, "s.job_title_id", "job_title_id"); err != nil {
+		return nil, err
+	}
+	if err := qb.inFilter(c, "s.subdivision_id", "subdivision_id"); err != nil {
+		return nil, err
+	}
+	return qb, nil
+}
+
+// groupedSQL оборачивает агрегат с колонкой key_id, добавляя название группы.
+func groupedSQL(inner string, g analyticsGrouping, order string) string {
+	if g.table == "" {
+		return "SELECT g.*, NULL::text FROM (" + inner + ") g ORDER BY " + order
+	}
+	return "SELECT g.*, n.name FROM (" + inner + ") g LEFT JOIN " + g.table + " n ON n.id = g.key_id ORDER BY " + order
+}
+
+type BidVolume struct {
+	Period    string  `json:"period"`
+	GroupID   *int    `json:"group_id,omitempty"`
+	GroupName *string `json:"group_name,omitempty"`
+	Count     int     `json:"count"`
+}
+
+// GetBidVolume — число поданных заявок по дням, неделям или месяцам;
+// ?interval=day|week|month, ?group_by=none|job_title|subdivision.
+func GetBidVolume(c *gin.Context) {
+	interval := c.DefaultQuery("interval", "day")
+	if interval != "day" && interval != "week" && interval != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return
+	}
+	g, ok := analyticsGroupings[c.DefaultQuery("group_by", "none")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be none, job_title or subdivision"})
+		return
+	}
+	qb, err := bidStatFilter(c, "s.submitted_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inner := fmt.Sprintf(`
+        SELECT date_trunc('%s', s.submitted_at)::date AS period, %s AS key_id, COUNT(*) AS count
+        FROM bid_stat s%s
+        GROUP BY 1, 2`, interval, g.column, qb.whereSQL())
+	rows, err := db.Query(groupedSQL(inner, g, "g.period, g.key_id"), qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	points := []BidVolume{}
+	for rows.Next() {
+		var p BidVolume
+		var period time.Time
+		if err := rows.Scan(&period, &p.GroupID, &p.Count, &p.GroupName); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan bid volume"})
+			return
+		}
+		p.Period = period.Format(dateLayout)
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, points)
+}
+
+type DecisionStats struct {
+	GroupID             *int     `json:"group_id,omitempty"`
+	GroupName           *string  `json:"group_name,omitempty"`
+	Accepted            int      `json:"accepted"`
+	Rejected            int      `json:"rejected"`
+	Withdrawn           int      `json:"withdrawn"`
+	Merged              int      `json:"merged"`
+	AcceptanceRate      *float64 `json:"acceptance_rate"`
+	MedianDecisionHours *float64 `json:"median_decision_hours"`
+}
+
+// GetDecisionStats — исходы заявок, решённых за период: доля принятых среди принятых и отклонённых
+// и медиана времени от подачи до решения; ?group_by=none|job_title|subdivision.
+func GetDecisionStats(c *gin.Context) {
+	g, ok := analyticsGroupings[c.DefaultQuery("group_by", "none")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be none, job_title or subdivision"})
+		return
+	}
+	qb, err := bidStatFilter(c, "s.decided_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inner := fmt.Sprintf(`
+        SELECT %s AS key_id,
+            COUNT(*) FILTER (WHERE s.outcome = 'accepted') AS accepted,
+            COUNT(*) FILTER (WHERE s.outcome = 'rejected') AS rejected,
+            COUNT(*) FILTER (WHERE s.outcome = 'withdrawn') AS withdrawn,
+            COUNT(*) FILTER (WHERE s.outcome = 'merged') AS merged,
+            percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM s.decided_at - s.submitted_at))
+                FILTER (WHERE s.outcome IN ('accepted', 'rejected')) AS median_seconds
+        FROM bid_stat s%s
+        GROUP BY 1`, g.column, qb.whereSQL())
+	rows, err := db.Query(groupedSQL(inner, g, "g.key_id"), qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	stats := []DecisionStats{}
+	for rows.Next() {
+		var s DecisionStats
+		var medianSeconds sql.NullFloat64
+		if err := rows.Scan(&s.GroupID, &s.Accepted, &s.Rejected, &s.Withdrawn, &s.Merged, &medianSeconds, &s.GroupName); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan decision stats"})
+			return
+		}
+		if decided := s.Accepted + s.Rejected; decided > 0 {
+			rate := float64(s.Accepted) / float64(decided)
+			s.AcceptanceRate = &rate
+		}
+		if medianSeconds.Valid {
+			hours := medianSeconds.Float64 / 3600
+			s.MedianDecisionHours = &hours
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// staffAtSQL — сотрудники, чьё назначение действует на дату date, с фильтрами по назначению.
+func staffAtSQL(c *gin.Context, qb *queryBuilder, date time.Time) (string, error) {
+	day := date.Format(dateLayout)
+	qb.where("a.effective_from <= %s::date AND (a.effective_to IS NULL OR a.effective_to > %s::date)", day, day)
+	if err := qb.inFilter(c, "a.job_title_id", "job_title_id"); err != nil {
+		return "", err
+	}
+	if err := qb.inFilter(c, "a.subdivision_id", "subdivision_id"); err != nil {
+		return "", err
+	}
+	return "SELECT a.employee_id, a.job_title_id, a.subdivision_id FROM employee_assignment a" + qb.whereSQL(), nil
+}
+
+type SubdivisionHeadcount struct {
+	SubdivisionID int    `json:"subdivision_id"`
+	Subdivision   string `json:"subdivision"`
+	AtStart       int    `json:"headcount_start"`
+	AtEnd         int    `json:"headcount_end"`
+	Hired         int    `json:"hired"`
+	Authorized    *int   `json:"authorized"`
+}
+
+// GetHeadcountStats — численность подразделений на начало и конец периода по истории назначений,
+// число приёмов за период и штат по квотам.
+func GetHeadcountStats(c *gin.Context) {
+	from, to, err := analyticsRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	qb := &queryBuilder{}
+	joinCond := ""
+	jobTitles, err := queryIntList(c, "job_title_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(jobTitles) > 0 {
+		joinCond = " AND a.job_title_id = ANY(" + qb.arg(pq.Array(jobTitles)) + ")"
+	}
+	fromArg, toArg := qb.arg(from.Format(dateLayout))+"::date", qb.arg(to.Format(dateLayout))+"::date"
+	if err := qb.inFilter(c, "sd.id", "subdivision_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+        SELECT sd.id, sd.name,
+            COUNT(a.id) FILTER (WHERE a.effective_from <= %[1]s AND (a.effective_to IS NULL OR a.effective_to > %[1]s)),
+            COUNT(a.id) FILTER (WHERE a.effective_from <= %[2]s AND (a.effective_to IS NULL OR a.effective_to > %[2]s)),
+            COUNT(a.id) FILTER (WHERE a.kind = 'hire' AND a.effective_from BETWEEN %[1]s AND %[2]s),
+            (SELECT SUM(q.positions)::int FROM headcount_quota q WHERE q.subdivision_id = sd.id)
+        FROM subdivision sd
+        LEFT JOIN employee_assignment a ON a.subdivision_id = sd.id%[3]s%[4]s
+        GROUP BY sd.id, sd.name
+        ORDER BY sd.id
+    `, fromArg, toArg, joinCond, qb.whereSQL()), qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	stats := []SubdivisionHeadcount{}
+	for rows.Next() {
+		var s SubdivisionHeadcount
+		if err := rows.Scan(&s.SubdivisionID, &s.Subdivision, &s.AtStart, &s.AtEnd, &s.Hired, &s.Authorized); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan headcount"})
+			return
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+type DistributionBucket struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Count int `json:"count"`
+}
+
+func bucketParam(c *gin.Context, name string, def int) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > 50 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return n, nil
+}
+
+// GetDistributionStats — распределение возраста и стажа; ?source=bids — по заявкам, поданным
+// за период, ?source=employees — по сотрудникам на конец периода; ширина интервалов задаётся
+// ?age_bucket= (по умолчанию 10) и ?experience_bucket= (по умолчанию 5). Записи без даты
+// рождения в возрастные интервалы не входят, их число — в age_unknown.
+func GetDistributionStats(c *gin.Context) {
+	ageBucket, err := bucketParam(c, "age_bucket", 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expBucket, err := bucketParam(c, "experience_bucket", 5)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var population string
+	var qb *queryBuilder
+	switch source := c.DefaultQuery("source", "bids"); source {
+	case "bids":
+		qb, err = bidStatFilter(c, "s.submitted_at")
+		if err == nil {
+			population = "SELECT s.age, s.overall_experience, s.s_p_experience FROM bid_stat s" + qb.whereSQL()
+		}
+	case "employees":
+		var to time.Time
+		_, to, err = analyticsRange(c.Query("from"), c.Query("to"), time.Now())
+		if err == nil {
+			qb = &queryBuilder{}
+			var staff string
+			staff, err = staffAtSQL(c, qb, to)
+			population = "SELECT e.age, e.overall_experience, e.s_p_experience FROM employee_computed e JOIN (" + staff + ") st ON st.employee_id = e.id"
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be bids or employees"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ab, eb := qb.arg(ageBucket), qb.arg(expBucket)
+	rows, err := db.Query(fmt.Sprintf(`
+        WITH p AS (%[1]s)
+        SELECT 'age', (age / %[2]s) * %[2]s, COUNT(*) FROM p WHERE age IS NOT NULL GROUP BY 2
+        UNION ALL
+        SELECT 'age_unknown', 0, COUNT(*) FROM p WHERE age IS NULL
+        UNION ALL
+        SELECT 'overall_experience', (overall_experience / %[3]s) * %[3]s, COUNT(*) FROM p GROUP BY 2
+        UNION ALL
+        SELECT 's_p_experience', (s_p_experience / %[3]s) * %[3]s, COUNT(*) FROM p GROUP BY 2
+        ORDER BY 1, 2
+    `, population, ab, eb), qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	result := map[string][]DistributionBucket{"age": {}, "overall_experience": {}, "s_p_experience": {}}
+	total, ageUnknown := 0, 0
+	for rows.Next() {
+		var metric string
+		var b DistributionBucket
+		if err := rows.Scan(&metric, &b.From, &b.Count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan distribution"})
+			return
+		}
+		// Без даты рождения возраст неизвестен: такие записи считаются отдельно, не в корзинах
+		if metric == "age_unknown" {
+			ageUnknown = b.Count
+			total += b.Count
+			continue
+		}
+		width := expBucket
+		if metric == "age" {
+			width = ageBucket
+			total += b.Count
+		}
+		b.To = b.From + width - 1
+		result[metric] = append(result[metric], b)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total": total, "age": result["age"], "age_unknown": ageUnknown,
+		"overall_experience": result["overall_experience"], "s_p_experience": result["s_p_experience"],
+	})
+}
+
+type LanguageCoverage struct {
+	LanguageID int            `json:"language_id"`
+	Language   string         `json:"language"`
+	Employees  int            `json:"employees"`
+	Coverage   float64        `json:"coverage"`
+	Levels     map[string]int `json:"levels"`
+}
+
+// GetLanguageCoverage — сколько сотрудников на конец периода владеют каждым языком
+// и на каком уровне; coverage — доля от всех сотрудников с учётом фильтров.
+func GetLanguageCoverage(c *gin.Context) {
+	_, to, err := analyticsRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	qb := &queryBuilder{}
+	staff, err := staffAtSQL(c, qb, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(`
+        WITH staff AS (`+staff+`),
+        levels AS (
+            SELECT el.language_id, el.proficiency::text AS proficiency, COUNT(DISTINCT el.employee_id) AS n
+            FROM employee_languages el JOIN staff st ON st.employee_id = el.employee_id
+            GROUP BY 1, 2
+        )
+        SELECT lg.id, lg.language,
+            COALESCE((SELECT COUNT(DISTINCT el.employee_id) FROM employee_languages el
+                JOIN staff st ON st.employee_id = el.employee_id WHERE el.language_id = lg.id), 0),
+            COALESCE(jsonb_object_agg(l.proficiency, l.n) FILTER (WHERE l.proficiency IS NOT NULL), '{}'),
+            (SELECT COUNT(DISTINCT employee_id) FROM staff)
+        FROM languages lg
+        LEFT JOIN levels l ON l.language_id = lg.id
+        GROUP BY lg.id, lg.language
+        ORDER BY 3 DESC, lg.language
+    `, qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	coverage := []LanguageCoverage{}
+	for rows.Next() {
+		var l LanguageCoverage
+		var levels []byte
+		var total int
+		if err := rows.Scan(&l.LanguageID, &l.Language, &l.Employees, &levels, &total); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan languages"})
+			return
+		}
+		if err := json.Unmarshal(levels, &l.Levels); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse levels"})
+			return
+		}
+		if total > 0 {
+			l.Coverage = float64(l.Employees) / float64(total)
+		}
+		coverage = append(coverage, l)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, coverage)
+}
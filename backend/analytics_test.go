@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyticsRange(t *testing.T) {
+	now := time.Date(2024, 3, 15, 18, 30, 0, 0, time.Local)
+
+	from, to, err := analyticsRange("", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := from.Format(dateLayout) + ".." + to.Format(dateLayout); got != "2024-02-15..2024-03-15" {
+		t.Errorf("default range = %s", got)
+	}
+
+	from, to, err = analyticsRange("2024-01-01", "2024-01-31", now)
+	if err != nil || from.Format(dateLayout) != "2024-01-01" || to.Format(dateLayout) != "2024-01-31" {
+		t.Errorf("explicit range = %v..%v, %v", from, to, err)
+	}
+
+	if from, _, _ = analyticsRange("", "2024-01-31", now); from.Format(dateLayout) != "2024-01-02" {
+		t.Errorf("from should default to 30 days before to, got %v", from)
+	}
+
+	for _, tc := range [][2]string{{"2024-02-01", "2024-01-01"}, {"01.01.2024", ""}, {"", "tomorrow"}} {
+		if _, _, err := analyticsRange(tc[0], tc[1], now); err == nil {
+			t.Errorf("analyticsRange(%q, %q) should fail", tc[0], tc[1])
+		}
+	}
+}
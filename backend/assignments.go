@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Assignment struct {
+	ID            int     `json:"id"`
+	JobTitleID    int     `json:"job_title_id"`
+	JobTitle      string  `json:"job_title"`
+	SubdivisionID int     `json:"subdivision_id"`
+	Subdivision   string  `json:"subdivision"`
+	EffectiveFrom string  `json:"effective_from"`
+	EffectiveTo   *string `json:"effective_to"`
+	Kind          string  `json:"kind"`
+	Note          string  `json:"note"`
+}
+
+var (
+	errNoOpenAssignment = errors.New("employee has no open assignment")
+	errAssignmentDate   = errors.New("effective date must not be before the start of the current assignment or in the future")
+	errSamePosition     = errors.New("employee already holds this position")
+)
+
+// reassign закрывает текущее назначение датой effective и открывает новое с той же даты.
+// Если текущее назначение началось в тот же день, оно исправляется на месте,
+// чтобы не плодить интервалы нулевой длины. Штатная численность проверяется так же, как при приёме.
+func reassign(tx *sql.Tx, employeeID, jobTitleID, subdivisionID int, effective time.Time, kind, note string) error {
+	var (
+		currentID   int
+		currentJob  int
+		currentSub  int
+		currentFrom time.Time
+	)
+	err := tx.QueryRow(`
+        SELECT id, job_title_id, subdivision_id, effective_from
+        FROM employee_assignment
+        WHERE employee_id = $1 AND effective_to IS NULL
+        FOR UPDATE
+    `, employeeID).Scan(&currentID, &currentJob, &currentSub, &currentFrom)
+	if err == sql.ErrNoRows {
+		return errNoOpenAssignment
+	}
+	if err != nil {
+		return err
+	}
+
+	if currentJob == jobTitleID && currentSub == subdivisionID {
+		return errSamePosition
+	}
+	effective = truncateDay(effective)
+	if effective.Before(currentFrom) || effective.After(truncateDay(time.Now())) {
+		return errAssignmentDate
+	}
+	if err := checkHeadcount(tx, jobTitleID, subdivisionID, employeeID); err != nil {
+		return err
+	}
+
+	if effective.Equal(currentFrom) {
+		_, err = tx.Exec(`
+            UPDATE employee_assignment
+            SET job_title_id = $1, subdivision_id = $2, note = $3
+            WHERE id = $4
+        `, jobTitleID, subdivisionID, note, currentID)
+	} else {
+		_, err = tx.Exec("UPDATE employee_assignment SET effective_to = $1 WHERE id = $2", effective, currentID)
+		if err == nil {
+			_, err = tx.Exec(`
+                INSERT INTO employee_assignment (employee_id, job_title_id, subdivision_id, effective_from, kind, note)
+                VALUES ($1, $2, $3, $4, $5, $6)
+            `, employeeID, jobTitleID, subdivisionID, effective, kind, note)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE employee SET job_title_id = $1, subdivision_id = $2 WHERE id = $3", jobTitleID, subdivisionID, employeeID)
+	return err
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func transferEmployee(c *gin.Context) {
+	employeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+	if !checkEmployeeScope(c, c.Param("id")) {
+		return
+	}
+
+	var req struct {
+		JobTitleID    int    `json:"job_title_id" binding:"required,min=1"`
+		SubdivisionID int    `json:"subdivision_id" binding:"required,min=1"`
+		EffectiveFrom string `json:"effective_from"`
+		Kind          string `json:"kind"`
+		Note          string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Kind == "" {
+		req.Kind = "transfer"
+	}
+	if req.Kind != "transfer" && req.Kind != "promotion" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be transfer or promotion"})
+		return
+	}
+
+	effective := time.Now()
+	if req.EffectiveFrom != "" {
+		effective, err = time.Parse(dateLayout, req.EffectiveFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid effective_from"})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = reassign(tx, employeeID, req.JobTitleID, req.SubdivisionID, effective, req.Kind, req.Note)
+	full, isFull := err.(*headcountError)
+	switch {
+	case isFull:
+		c.JSON(http.StatusConflict, full.response())
+		return
+	case err == errNoOpenAssignment:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	case err == errAssignmentDate || err == errSamePosition:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer employee"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	history, err := loadAssignments(employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func GetEmployeeHistory(c *gin.Context) {
+	employeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+	if !checkEmployeeScope(c, c.Param("id")) {
+		return
+	}
+
+	history, err := loadAssignments(employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(history) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func loadAssignments(employeeID int) ([]Assignment, error) {
+	rows, err := db.Query(`
+        SELECT
+            a.id, a.job_title_id, jt.name, a.subdivision_id, sd.name,
+            to_char(a.effective_from, 'YYYY-MM-DD'), to_char(a.effective_to, 'YYYY-MM-DD'),
+            a.kind, a.note
+        FROM employee_assignment a
+        JOIN job_title jt ON a.job_title_id = jt.id
+        JOIN subdivision sd ON a.subdivision_id = sd.id
+        WHERE a.employee_id = $1
+        ORDER BY a.effective_from
+    `, employeeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []Assignment{}
+	for rows.Next() {
+		var a Assignment
+		if err := rows.Scan(&a.ID, &a.JobTitleID, &a.JobTitle, &a.SubdivisionID, &a.Subdivision,
+			&a.EffectiveFrom, &a.EffectiveTo, &a.Kind, &a.Note); err != nil {
+			return nil, err
+		}
+		history = append(history, a)
+	}
+	return history, rows.Err()
+}
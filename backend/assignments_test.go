@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReassign(t *testing.T) {
+	openTestDB(t)
+	one := 1
+	job, subA, subB := testPosition(t, &one)
+	holder := testEmployee(t, job, subA)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if err := reassign(tx, holder, job, subA, time.Now(), "transfer", ""); err != errSamePosition {
+		t.Errorf("та же должность: ожидалась errSamePosition, получено %v", err)
+	}
+	if err := reassign(tx, holder, job, subB, time.Now().AddDate(0, 0, 1), "transfer", ""); err != errAssignmentDate {
+		t.Errorf("дата в будущем: ожидалась errAssignmentDate, получено %v", err)
+	}
+	if err := reassign(tx, holder, job, subB, time.Now().AddDate(0, 0, -31), "transfer", ""); err != errAssignmentDate {
+		t.Errorf("дата до начала назначения: ожидалась errAssignmentDate, получено %v", err)
+	}
+
+	// Единственная ставка занята самим переводимым сотрудником — перевод разрешён
+	if err := reassign(tx, holder, job, subB, time.Now(), "transfer", "перевод"); err != nil {
+		t.Fatalf("перевод занимающего ставку: %v", err)
+	}
+	var closed, open int
+	err = tx.QueryRow(`
+        SELECT COUNT(*) FILTER (WHERE effective_to IS NOT NULL), COUNT(*) FILTER (WHERE effective_to IS NULL AND subdivision_id = $2)
+        FROM employee_assignment WHERE employee_id = $1
+    `, holder, subB).Scan(&closed, &open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 || open != 1 {
+		t.Errorf("ожидалось одно закрытое и одно открытое назначение в новом подразделении, получено %d и %d", closed, open)
+	}
+}
+
+func TestReassignHeadcountFull(t *testing.T) {
+	openTestDB(t)
+	one := 1
+	full, subA, _ := testPosition(t, &one)
+	other, _, _ := testPosition(t, nil)
+	testEmployee(t, full, subA)
+	mover := testEmployee(t, other, subA)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	err = reassign(tx, mover, full, subA, time.Now(), "promotion", "")
+	hc, ok := err.(*headcountError)
+	if !ok {
+		t.Fatalf("ожидалась *headcountError, получено %v", err)
+	}
+	if hc.Scope != "job title" || hc.Authorized != 1 || hc.Filled != 1 {
+		t.Errorf("неожиданные детали лимита: %+v", hc)
+	}
+}
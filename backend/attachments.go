@@ -0,0 +1,454 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const docxContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+type Attachment struct {
+	ID          int       `json:"id"`
+	BidID       int       `json:"bid_id"`
+	EmployeeID  *int      `json:"employee_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	UploadedBy  *string   `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// upload — прочитанный и проверенный файл, ещё не сохранённый в хранилище.
+type upload struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+var (
+	errInvalidApplication = errors.New("invalid request")
+	errAttachmentTooLarge = errors.New("attachment is too large")
+	errAttachmentType     = errors.New("only PDF, DOCX, PNG and JPEG files are allowed")
+	errTooManyAttachments = errors.New("too many attachments")
+)
+
+func attachmentLimits() (maxBytes int64, maxFiles int) {
+	return int64(envInt("ATTACHMENT_MAX_BYTES", 10<<20)), envInt("ATTACHMENT_MAX_FILES", 10)
+}
+
+// maxRequestBytes — предельный размер тела запроса: все вложения по максимуму плюс 1 МБ на поля формы.
+func maxRequestBytes() int64 {
+	maxBytes, maxFiles := attachmentLimits()
+	return int64(maxFiles)*maxBytes + 1<<20
+}
+
+// attachmentErrorStatus сопоставляет ошибку проверки файла с HTTP-статусом.
+func attachmentErrorStatus(err error) int {
+	switch err {
+	case errAttachmentTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case errAttachmentType:
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// attachmentErrorMessage — текст ошибки для ответа клиенту.
+func attachmentErrorMessage(err error) string {
+	if err == errInvalidApplication {
+		return "Invalid request"
+	}
+	return err.Error()
+}
+
+// sniffAttachment определяет тип по содержимому, а не по расширению или заголовку клиента.
+func sniffAttachment(data []byte) (string, error) {
+	switch ct := http.DetectContentType(data); ct {
+	case "application/pdf", "image/png", "image/jpeg":
+		return ct, nil
+	case "application/zip":
+		if isDOCX(data) {
+			return docxContentType, nil
+		}
+	}
+	return "", errAttachmentType
+}
+
+func isDOCX(data []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	var types, document bool
+	for _, f := range zr.File {
+		switch f.Name {
+		case "[Content_Types].xml":
+			types = true
+		case "word/document.xml":
+			document = true
+		}
+	}
+	return types && document
+}
+
+// cleanFilename оставляет от имени файла клиента только последний компонент без управляющих символов.
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
+
+// readUploads читает файлы формы целиком и проверяет размер и тип; existing — уже прикреплённые к заявке файлы.
+func readUploads(files []*multipart.FileHeader, existing int) ([]upload, error) {
+	maxBytes, maxFiles := attachmentLimits()
+	if existing+len(files) > maxFiles {
+		return nil, errTooManyAttachments
+	}
+
+	uploads := make([]upload, 0, len(files))
+	for _, fh := range files {
+		if fh.Size > maxBytes {
+			return nil, errAttachmentTooLarge
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxBytes {
+			return nil, errAttachmentTooLarge
+		}
+		ct, err := sniffAttachment(data)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload{Filename: cleanFilename(fh.Filename), ContentType: ct, Data: data})
+	}
+	return uploads, nil
+}
+
+// bindApplication разбирает заявку кандидата: обычный JSON либо multipart/form-data,
+// где поле data содержит тот же JSON, а files — резюме и документы.
+func bindApplication(c *gin.Context, req interface{}) ([]upload, error) {
+	if c.ContentType() != "multipart/form-data" {
+		if err := c.ShouldBindJSON(req); err != nil {
+			return nil, errInvalidApplication
+		}
+		return nil, nil
+	}
+
+	form, err := c.MultipartForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, errAttachmentTooLarge
+	}
+	if err != nil || len(form.Value["data"]) != 1 {
+		return nil, errInvalidApplication
+	}
+	if err := json.Unmarshal([]byte(form.Value["data"][0]), req); err != nil {
+		return nil, errInvalidApplication
+	}
+	return readUploads(form.File["files"], 0)
+}
+
+// newBlobKey не зависит от заявки: файлы сохраняются до транзакции, в которой заявка ещё только создаётся.
+func newBlobKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "attachments/" + hex.EncodeToString(b), nil
+}
+
+// putBlobs кладёт файлы в хранилище до начала транзакции, чтобы не держать её открытой
+// на время загрузки. Если сохранить удалось не все файлы, уже сохранённые удаляются.
+// После отката транзакции, в которой записывались метаданные, ключи удаляются через removeBlobs.
+func putBlobs(ctx context.Context, uploads []upload) ([]string, error) {
+	keys := make([]string, 0, len(uploads))
+	for _, u := range uploads {
+		key, err := newBlobKey()
+		if err == nil {
+			err = blobs.Put(ctx, key, u.Data, u.ContentType)
+		}
+		if err != nil {
+			removeBlobs(keys)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// insertAttachments записывает в транзакции tx метаданные файлов, сохранённых putBlobs под ключами keys.
+func insertAttachments(tx *sql.Tx, bidID int, uploads []upload, keys []string, uploadedBy *string) error {
+	for i, u := range uploads {
+		sum := sha256.Sum256(u.Data)
+		_, err := tx.Exec(`
+            INSERT INTO attachment (bid_id, filename, content_type, size, sha256, storage_key, uploaded_by)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+        `, bidID, u.Filename, u.ContentType, len(u.Data), hex.EncodeToString(sum[:]), keys[i], uploadedBy)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeBlobs удаляет файлы после отката или удаления записей; ошибки только логируются.
+func removeBlobs(keys []string) {
+	for _, key := range keys {
+		if err := blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Ошибка удаления файла %s: %v", key, err)
+		}
+	}
+}
+
+// detachRejectedAttachments удаляет записи о вложениях отклонённой заявки и возвращает ключи файлов.
+func detachRejectedAttachments(tx *sql.Tx, bidID string) ([]string, error) {
+	return deleteAttachmentRows(tx, "bid_id = $1 AND employee_id IS NULL", bidID)
+}
+
+// deleteEmployeeAttachments удаляет записи о вложениях удаляемого сотрудника: после
+// ON DELETE SET NULL они остались бы без сотрудника и без проверки scope.
+func deleteEmployeeAttachments(tx *sql.Tx, employeeID string) ([]string, error) {
+	return deleteAttachmentRows(tx, "employee_id = $1", employeeID)
+}
+
+func deleteAttachmentRows(tx *sql.Tx, where string, arg interface{}) ([]string, error) {
+	rows, err := tx.Query("DELETE FROM attachment WHERE "+where+" RETURNING storage_key", arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func loadAttachments(where string, arg interface{}) ([]Attachment, error) {
+	rows, err := db.Query(`
+        SELECT id, bid_id, employee_id, filename, content_type, size, sha256, uploaded_by, created_at
+        FROM attachment WHERE `+where+` ORDER BY created_at, id
+    `, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.BidID, &a.EmployeeID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.UploadedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+func uploadBidAttachments(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	var status sql.NullString
+	var existing int
+	err = db.QueryRow(`
+        SELECT (SELECT status FROM employee_bid WHERE id = $1),
+            (SELECT COUNT(*) FROM attachment WHERE bid_id = $1)
+    `, bidID).Scan(&status, &existing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !status.Valid {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	if status.String == "withdrawn" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Заявка отозвана заявителем"})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected multipart form with files"})
+		return
+	}
+	uploads, err := readUploads(form.File["files"], existing)
+	if err != nil {
+		c.JSON(attachmentErrorStatus(err), gin.H{"error": attachmentErrorMessage(err)})
+		return
+	}
+
+	keys, err := putBlobs(c.Request.Context(), uploads)
+	if err != nil {
+		log.Printf("Ошибка сохранения вложений: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachments"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err == nil {
+		defer tx.Rollback()
+		err = insertAttachments(tx, bidID, uploads, keys, &userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		removeBlobs(keys)
+		log.Printf("Ошибка сохранения вложений: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachments"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Attachments uploaded successfully", "count": len(uploads)})
+}
+
+func GetBidAttachments(c *gin.Context) {
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+	if !checkBidScope(c, bidID) {
+		return
+	}
+	attachments, err := loadAttachments("bid_id = $1", bidID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, attachments)
+}
+
+func GetEmployeeAttachments(c *gin.Context) {
+	if !checkEmployeeScope(c, c.Param("id")) {
+		return
+	}
+	attachments, err := loadAttachments("employee_id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, attachments)
+}
+
+func downloadAttachment(c *gin.Context) {
+	var filename, contentType, key string
+	var size int64
+	var employeeID *int
+	err := db.QueryRow(`
+        SELECT employee_id, filename, content_type, size, storage_key FROM attachment WHERE id = $1
+    `, c.Param("id")).Scan(&employeeID, &filename, &contentType, &size, &key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !checkEmployeeScopeOf(c, employeeID) {
+		return
+	}
+	serveBlob(c, filename, contentType, size, key)
+}
+
+// serveBlob отдаёт файл из хранилища как вложение с исходным именем.
+func serveBlob(c *gin.Context, filename, contentType string, size int64, key string) {
+	body, err := blobs.Get(c.Request.Context(), key)
+	if errors.Is(err, errBlobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File is missing"})
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка чтения файла %s: %v", key, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, size, contentType, body, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": filename}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+func deleteAttachment(c *gin.Context) {
+	var employeeID *int
+	err := db.QueryRow("SELECT employee_id FROM attachment WHERE id = $1", c.Param("id")).Scan(&employeeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !checkEmployeeScopeOf(c, employeeID) {
+		return
+	}
+
+	var key string
+	err = db.QueryRow("DELETE FROM attachment WHERE id = $1 RETURNING storage_key", c.Param("id")).Scan(&key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	removeBlobs([]string{key})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSniffAttachment(t *testing.T) {
+	var docx bytes.Buffer
+	zw := zip.NewWriter(&docx)
+	for _, name := range []string{"[Content_Types].xml", "word/document.xml"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte("<xml/>"))
+	}
+	zw.Close()
+
+	var plainZip bytes.Buffer
+	zw = zip.NewWriter(&plainZip)
+	w, _ := zw.Create("readme.txt")
+	w.Write([]byte("hello"))
+	zw.Close()
+
+	cases := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("%PDF-1.7\n..."), "application/pdf"},
+		{[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{[]byte("\xff\xd8\xff\xe0\x00\x10JFIF"), "image/jpeg"},
+		{docx.Bytes(), docxContentType},
+		{plainZip.Bytes(), ""},
+		{[]byte("<html><script>alert(1)</script>"), ""},
+	}
+	for i, tc := range cases {
+		got, err := sniffAttachment(tc.data)
+		if tc.expected == "" {
+			if err != errAttachmentType {
+				t.Errorf("case %d: expected errAttachmentType, got %q, %v", i, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.expected {
+			t.Errorf("case %d: got %q, %v; want %q", i, got, err, tc.expected)
+		}
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	cases := map[string]string{
+		"резюме.pdf":            "резюме.pdf",
+		`C:\Users\ivan\CV.docx`: "CV.docx",
+		"../../etc/passwd":      "passwd",
+		"bad\x00name\r\n.png":   "badname.png",
+		"":                      "attachment",
+	}
+	for in, expected := range cases {
+		if got := cleanFilename(in); got != expected {
+			t.Errorf("cleanFilename(%q) = %q, want %q", in, got, expected)
+		}
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(BodyLimitMiddleware(64))
+	r.POST("/idempotent", IdempotencyMiddleware(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	r.POST("/apply", func(c *gin.Context) {
+		var req applicationRequest
+		if _, err := bindApplication(c, &req); err != nil {
+			c.JSON(attachmentErrorStatus(err), gin.H{"error": attachmentErrorMessage(err)})
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	big := strings.Repeat("x", 1024)
+
+	// Тело с Idempotency-Key читается целиком ещё до обработчика
+	req := httptest.NewRequest(http.MethodPost, "/idempotent", strings.NewReader(big))
+	req.Header.Set("Idempotency-Key", "k")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("idempotent request: expected 413, got %d", w.Code)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("data", "{}")
+	fw, _ := mw.CreateFormFile("files", "cv.pdf")
+	fw.Write([]byte("%PDF-1.4 " + big))
+	mw.Close()
+	req = httptest.NewRequest(http.MethodPost, "/apply", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("multipart application: expected 413, got %d", w.Code)
+	}
+}
+
+func TestDeleteEmployeeRemovesAttachments(t *testing.T) {
+	openTestDB(t)
+	prev := blobs
+	blobs = &localStore{root: t.TempDir()}
+	t.Cleanup(func() { blobs = prev })
+
+	job, sub, _ := testPosition(t, nil)
+	employee := testEmployee(t, job, sub)
+	key, err := newBlobKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blobs.Put(context.Background(), key, []byte("%PDF-1.4"), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+        INSERT INTO attachment (bid_id, employee_id, filename, content_type, size, sha256, storage_key)
+        VALUES ($1, $2, 'cv.pdf', 'application/pdf', 8, '-', $3)
+    `, -employee, employee, key); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM attachment WHERE storage_key = $1", key) })
+
+	r := gin.New()
+	r.DELETE("/api/employees/:id", deleteEmployees)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/employees/%d", employee), nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body)
+	}
+
+	var left int
+	if err := db.QueryRow("SELECT COUNT(*) FROM attachment WHERE storage_key = $1", key).Scan(&left); err != nil || left != 0 {
+		t.Errorf("attachment rows left: %d, %v", left, err)
+	}
+	if _, err := blobs.Get(context.Background(), key); !errors.Is(err, errBlobNotFound) {
+		t.Errorf("blob should be removed, got %v", err)
+	}
+}
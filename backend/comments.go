@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+type Comment struct {
+	ID         int        `json:"id"`
+	BidID      int        `json:"bid_id"`
+	EmployeeID *int       `json:"employee_id"`
+	ParentID   *int       `json:"parent_id"`
+	AuthorID   string     `json:"author_id"`
+	Author     string     `json:"author"`
+	Body       string     `json:"body"`
+	Decision   *string    `json:"decision"`
+	Mentions   []string   `json:"mentions"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+	Replies    []*Comment `json:"replies"`
+}
+
+type CommentRevision struct {
+	Body     string    `json:"body"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@-])@([\p{L}\p{N}_.-]*[\p{L}\p{N}_])`)
+
+// extractMentions возвращает уникальные имена пользователей, упомянутых как @username.
+func extractMentions(body string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := m[1]
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// saveMentions связывает комментарий с упомянутыми сотрудниками; упоминания
+// пользователей без роли employee/admin игнорируются, комментарии им не видны.
+func saveMentions(tx *sql.Tx, commentID int, body string) error {
+	if _, err := tx.Exec("DELETE FROM bid_comment_mention WHERE comment_id = $1", commentID); err != nil {
+		return err
+	}
+	names := extractMentions(body)
+	if len(names) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+        INSERT INTO bid_comment_mention (comment_id, user_id)
+        SELECT $1, id::text FROM users
+        WHERE LOWER(username) = ANY($2) AND role IN ('employee', 'admin')
+        ON CONFLICT DO NOTHING
+    `, commentID, pq.Array(lowerAll(names)))
+	return err
+}
+
+func lowerAll(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = strings.ToLower(n)
+	}
+	return out
+}
+
+func insertComment(tx *sql.Tx, bidID int, employeeID *int, parentID *int, authorID, body string, decision *string) (int, error) {
+	var id int
+	err := tx.QueryRow(`
+        INSERT INTO bid_comment (bid_id, employee_id, parent_id, author_id, body, decision)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id
+    `, bidID, employeeID, parentID, authorID, body, decision).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, saveMentions(tx, id, body)
+}
+
+// readDecisionComment разбирает необязательное тело {"comment": "..."} у accept/reject.
+func readDecisionComment(c *gin.Context) (string, error) {
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimSpace(req.Comment), nil
+}
+
+// recordDecision сохраняет комментарий к решению по заявке, если рецензент его оставил.
+func recordDecision(tx *sql.Tx, authorID, bidID string, employeeID *int, decision, comment string) error {
+	if comment == "" {
+		return nil
+	}
+	id, err := strconv.Atoi(bidID)
+	if err != nil {
+		return err
+	}
+	_, err = insertComment(tx, id, employeeID, nil, authorID, comment, &decision)
+	return err
+}
+
+const commentSelectSQL = `
+    SELECT c.id, c.bid_id, c.employee_id, c.parent_id, c.author_id, COALESCE(u.username, ''),
+        c.body, c.decision, c.created_at, c.updated_at,
+        COALESCE(array_agg(mu.username ORDER BY mu.username) FILTER (WHERE mu.username IS NOT NULL), '{}')
+    FROM bid_comment c
+    LEFT JOIN users u ON u.id::text = c.author_id
+    LEFT JOIN bid_comment_mention m ON m.comment_id = c.id
+    LEFT JOIN users mu ON mu.id::text = m.user_id`
+
+const commentGroupBySQL = `
+    GROUP BY c.id, u.username
+    ORDER BY c.created_at, c.id`
+
+func loadComments(where string, arg interface{}) ([]*Comment, error) {
+	rows, err := db.Query(commentSelectSQL+" WHERE "+where+commentGroupBySQL, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*Comment
+	for rows.Next() {
+		var cm Comment
+		if err := rows.Scan(&cm.ID, &cm.BidID, &cm.EmployeeID, &cm.ParentID, &cm.AuthorID, &cm.Author,
+			&cm.Body, &cm.Decision, &cm.CreatedAt, &cm.UpdatedAt, pq.Array(&cm.Mentions)); err != nil {
+			return nil, err
+		}
+		cm.Replies = []*Comment{}
+		all = append(all, &cm)
+	}
+	return all, rows.Err()
+}
+
+// threadComments раскладывает плоский список в дерево ответов.
+func threadComments(all []*Comment) []*Comment {
+	byID := map[int]*Comment{}
+	for _, cm := range all {
+		byID[cm.ID] = cm
+	}
+	roots := []*Comment{}
+	for _, cm := range all {
+		if cm.ParentID != nil {
+			if parent, ok := byID[*cm.ParentID]; ok {
+				parent.Replies = append(parent.Replies, cm)
+				continue
+			}
+		}
+		roots = append(roots, cm)
+	}
+	return roots
+}
+
+func GetBidComments(c *gin.Context) {
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+	if !checkBidScope(c, bidID) {
+		return
+	}
+	comments, err := loadComments("c.bid_id = $1", bidID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, threadComments(comments))
+}
+
+func GetEmployeeComments(c *gin.Context) {
+	employeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+	if !checkEmployeeScope(c, c.Param("id")) {
+		return
+	}
+	comments, err := loadComments("c.employee_id = $1", employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, threadComments(comments))
+}
+
+// GetMyMentions — комментарии, в которых упомянут текущий пользователь.
+func GetMyMentions(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	comments, err := loadComments("c.id IN (SELECT comment_id FROM bid_comment_mention WHERE user_id = $1)", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if comments == nil {
+		comments = []*Comment{}
+	}
+	c.JSON(http.StatusOK, comments)
+}
+
+func postBidComment(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	var req struct {
+		Body     string `json:"body" binding:"required"`
+		ParentID *int   `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment body is empty"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Комментировать можно заявку на рассмотрении или уже принятого по ней сотрудника
+	var employeeID *int
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM employee_bid WHERE id = $1)", bidID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		err := tx.QueryRow("SELECT MAX(employee_id) FROM bid_comment WHERE bid_id = $1", bidID).Scan(&employeeID)
+		if err != nil || employeeID == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+			return
+		}
+	}
+
+	if req.ParentID != nil {
+		var parentBid int
+		err := tx.QueryRow("SELECT bid_id FROM bid_comment WHERE id = $1", *req.ParentID).Scan(&parentBid)
+		if err != nil || parentBid != bidID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found on this bid"})
+			return
+		}
+	}
+
+	id, err := insertComment(tx, bidID, employeeID, req.ParentID, userID, req.Body, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into bid_comment"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// editComment сохраняет прежний текст в bid_comment_revision; править можно только свои комментарии.
+func editComment(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	commentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	var req struct {
+		Body string `json:"body" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment body is empty"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var authorID, body string
+	err = tx.QueryRow("SELECT author_id, body FROM bid_comment WHERE id = $1 FOR UPDATE", commentID).Scan(&authorID, &body)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if authorID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can edit a comment"})
+		return
+	}
+
+	newBody := req.Body
+	if newBody != body {
+		if _, err := tx.Exec("INSERT INTO bid_comment_revision (comment_id, body) VALUES ($1, $2)", commentID, body); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into bid_comment_revision"})
+			return
+		}
+		if _, err := tx.Exec("UPDATE bid_comment SET body = $1, updated_at = NOW() WHERE id = $2", newBody, commentID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err := saveMentions(tx, commentID, newBody); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save mentions"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully"})
+}
+
+func GetCommentHistory(c *gin.Context) {
+	commentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	var employeeID *int
+	err = db.QueryRow("SELECT employee_id FROM bid_comment WHERE id = $1", commentID).Scan(&employeeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !checkEmployeeScopeOf(c, employeeID) {
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT body, edited_at FROM bid_comment_revision
+        WHERE comment_id = $1
+        ORDER BY edited_at, id
+    `, commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []CommentRevision{}
+	for rows.Next() {
+		var r CommentRevision
+		if err := rows.Scan(&r.Body, &r.EditedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan revisions"})
+			return
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
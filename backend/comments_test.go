@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestExtractMentions(t *testing.T) {
+	got := extractMentions("@anna, посмотри. cc @Иван_Петров и @anna; почта test@example.com.")
+	expected := []string{"anna", "Иван_Петров"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected mentions: got %v want %v", got, expected)
+	}
+}
+
+func TestThreadComments(t *testing.T) {
+	parent := 1
+	roots := threadComments([]*Comment{
+		{ID: 1, Replies: []*Comment{}},
+		{ID: 2, ParentID: &parent, Replies: []*Comment{}},
+		{ID: 3, Replies: []*Comment{}},
+	})
+	if len(roots) != 2 || len(roots[0].Replies) != 1 || roots[0].Replies[0].ID != 2 {
+		t.Errorf("unexpected thread: %+v", roots)
+	}
+}
+
+func TestBlankCommentRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, handler := range []gin.HandlerFunc{postBidComment, editComment} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"body":"  \n\t "}`))
+		c.Params = gin.Params{{Key: "id", Value: "1"}}
+		c.Set("userClaims", jwt.MapClaims{"user_id": "1"})
+		handler(c)
+		if c.Writer.Status() != http.StatusBadRequest {
+			t.Errorf("blank body: got %d, want 400", c.Writer.Status())
+		}
+	}
+}
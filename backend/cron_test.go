@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 3, 15, 10, 20, 30, 0, time.UTC) // пятница
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 15, 10, 21, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2024, 3, 16, 8, 0, 0, 0, time.UTC)},
+		{"30 * * * *", time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"*/15 9-17 * * 1-5", time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,20 * *", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)},
+		// День месяца и день недели ограничены оба: подходит любой
+		{"0 0 1 * 6", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 3, 15, 10, 25, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		s, err := parseCron(tc.spec)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tc.spec, err)
+			continue
+		}
+		if got := s.next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: next = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+
+	s, _ := parseCron("0 0 30 2 *")
+	if got := s.next(from); !got.IsZero() {
+		t.Errorf("impossible schedule should have no next run, got %v", got)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@yearly"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q) should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const documentDateLayout = "02.01.2006"
+
+// docBlock — элемент документа, общий для выдачи в HTML/PDF и DOCX.
+// Первая строка таблицы — заголовок.
+type docBlock struct {
+	Kind string // heading, paragraph, table
+	Text string
+	Rows [][]string
+}
+
+// documentSample — подстановки, доступные в шаблонах; по ним же проверяется шаблон при сохранении.
+var documentSample = map[string]interface{}{
+	"employee_id": 1,
+	"fio":         "Иванов Иван Иванович",
+	"birth_date":  "01.01.1990",
+	"hire_date":   "01.09.2024",
+	"job_title":   "Инженер",
+	"subdivision": "Отдел разработки",
+	"today":       "01.09.2024",
+}
+
+func parseDocumentTemplate(body string) (*texttemplate.Template, error) {
+	return texttemplate.New("document").Option("missingkey=error").Parse(body)
+}
+
+// renderDocumentTemplate подставляет данные в шаблон; каждая непустая строка — абзац, "# " — заголовок.
+func renderDocumentTemplate(body string, data map[string]interface{}) ([]docBlock, error) {
+	tmpl, err := parseDocumentTemplate(body)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	var blocks []docBlock
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "# "):
+			blocks = append(blocks, docBlock{Kind: "heading", Text: strings.TrimSpace(line[2:])})
+		default:
+			blocks = append(blocks, docBlock{Kind: "paragraph", Text: line})
+		}
+	}
+	return blocks, nil
+}
+
+var documentHTMLTemplate = template.Must(template.New("document").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<style>
+body { font-family: "Times New Roman", serif; font-size: 12pt; margin: 2cm 1.5cm 2cm 3cm; }
+h1 { font-size: 14pt; text-align: center; }
+h2 { font-size: 12pt; margin-top: 1.5em; }
+table { border-collapse: collapse; width: 100%; margin: 0.5em 0; }
+th, td { border: 1px solid #000; padding: 3pt 5pt; text-align: left; vertical-align: top; }
+</style></head><body>
+{{range .Blocks}}{{if eq .Kind "heading"}}<h1>{{.Text}}</h1>
+{{else if eq .Kind "subheading"}}<h2>{{.Text}}</h2>
+{{else if eq .Kind "table"}}<table>{{range $i, $row := .Rows}}<tr>{{range $row}}{{if eq $i 0}}<th>{{.}}</th>{{else}}<td>{{.}}</td>{{end}}{{end}}</tr>{{end}}</table>
+{{else}}<p>{{.Text}}</p>
+{{end}}{{end}}</body></html>`))
+
+func documentHTML(title string, blocks []docBlock) (string, error) {
+	var out bytes.Buffer
+	err := documentHTMLTemplate.Execute(&out, struct {
+		Title  string
+		Blocks []docBlock
+	}{title, blocks})
+	return out.String(), err
+}
+
+// documentPDF печатает HTML в PDF через headless Chrome: удалённый по CHROME_URL
+// (адрес DevTools, например ws://chrome:9222) или локальный, при необходимости по CHROME_PATH.
+func documentPDF(ctx context.Context, html string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, envDuration("PDF_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	var allocCtx context.Context
+	var allocCancel context.CancelFunc
+	if url := envString("CHROME_URL", ""); url != "" {
+		allocCtx, allocCancel = chromedp.NewRemoteAllocator(ctx, url)
+	} else {
+		opts := chromedp.DefaultExecAllocatorOptions[:]
+		if path := envString("CHROME_PATH", ""); path != "" {
+			opts = append(opts, chromedp.ExecPath(path))
+		}
+		allocCtx, allocCancel = chromedp.NewExecAllocator(ctx, opts...)
+	}
+	defer allocCancel()
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
+	defer browserCancel()
+
+	var pdf []byte
+	err := chromedp.Run(browserCtx,
+		chromedp.Navigate("about:blank"),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			tree, err := page.GetFrameTree().Do(ctx)
+			if err != nil {
+				return err
+			}
+			return page.SetDocumentContent(tree.Frame.ID, html).Do(ctx)
+		}),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			// A4, поля задаются в CSS документа
+			data, _, err := page.PrintToPDF().
+				WithPaperWidth(8.27).WithPaperHeight(11.69).
+				WithMarginTop(0).WithMarginBottom(0).WithMarginLeft(0).WithMarginRight(0).
+				WithPrintBackground(true).Do(ctx)
+			pdf = data
+			return err
+		}),
+	)
+	return pdf, err
+}
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+	`</Types>`
+
+const docxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+	`</Relationships>`
+
+func docxRun(sb *strings.Builder, text string, bold bool, size int) {
+	sb.WriteString(`<w:r><w:rPr><w:rFonts w:ascii="Times New Roman" w:hAnsi="Times New Roman" w:cs="Times New Roman"/>`)
+	if bold {
+		sb.WriteString(`<w:b/>`)
+	}
+	fmt.Fprintf(sb, `<w:sz w:val="%d"/></w:rPr><w:t xml:space="preserve">`, size)
+	xml.EscapeText(sb, []byte(text))
+	sb.WriteString(`</w:t></w:r>`)
+}
+
+func docxParagraph(sb *strings.Builder, text string, bold, center bool, size int) {
+	sb.WriteString(`<w:p>`)
+	if center {
+		sb.WriteString(`<w:pPr><w:jc w:val="center"/></w:pPr>`)
+	}
+	docxRun(sb, text, bold, size)
+	sb.WriteString(`</w:p>`)
+}
+
+// documentDOCX собирает минимальный пакет WordprocessingML: A4, Times New Roman 12 pt.
+func documentDOCX(blocks []docBlock) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`)
+	for _, b := range blocks {
+		switch b.Kind {
+		case "heading":
+			docxParagraph(&sb, b.Text, true, true, 28)
+		case "subheading":
+			docxParagraph(&sb, b.Text, true, false, 24)
+		case "table":
+			sb.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="5000" w:type="pct"/><w:tblBorders>`)
+			for _, side := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+				fmt.Fprintf(&sb, `<w:%s w:val="single" w:sz="4" w:space="0" w:color="000000"/>`, side)
+			}
+			sb.WriteString(`</w:tblBorders></w:tblPr>`)
+			for i, row := range b.Rows {
+				sb.WriteString(`<w:tr>`)
+				for _, cell := range row {
+					sb.WriteString(`<w:tc>`)
+					docxParagraph(&sb, cell, i == 0, false, 24)
+					sb.WriteString(`</w:tc>`)
+				}
+				sb.WriteString(`</w:tr>`)
+			}
+			sb.WriteString(`</w:tbl>`)
+			// Таблица не может идти последней или вплотную к следующей без абзаца
+			sb.WriteString(`<w:p/>`)
+		default:
+			docxParagraph(&sb, b.Text, false, false, 24)
+		}
+	}
+	sb.WriteString(`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/>` +
+		`<w:pgMar w:top="1134" w:right="850" w:bottom="1134" w:left="1701" w:header="708" w:footer="708" w:gutter="0"/>` +
+		`</w:sectPr></w:body></w:document>`)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct{ name, body string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxRels},
+		{"word/document.xml", sb.String()},
+	} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(f.body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func documentDate(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(documentDateLayout)
+}
+
+func documentAge(age sql.NullInt64) string {
+	if !age.Valid {
+		return ""
+	}
+	return strconv.FormatInt(age.Int64, 10)
+}
+
+type employeeDocumentData struct {
+	fields            map[string]interface{}
+	age               sql.NullInt64
+	overallExperience int
+	spExperience      int
+}
+
+func loadEmployeeDocumentData(employeeID int) (*employeeDocumentData, error) {
+	var fio, jobTitle, subdivision string
+	var birthDate, hireDate sql.NullTime
+	d := &employeeDocumentData{}
+	err := db.QueryRow(`
+        SELECT e.fio, e.birth_date, e.hire_date, e.age, e.overall_experience, e.s_p_experience,
+            COALESCE(jt.name, ''), COALESCE(sd.name, '')
+        FROM employee_computed e
+        LEFT JOIN job_title jt ON jt.id = e.job_title_id
+        LEFT JOIN subdivision sd ON sd.id = e.subdivision_id
+        WHERE e.id = $1
+    `, employeeID).Scan(&fio, &birthDate, &hireDate, &d.age, &d.overallExperience, &d.spExperience, &jobTitle, &subdivision)
+	if err != nil {
+		return nil, err
+	}
+	d.fields = map[string]interface{}{
+		"employee_id": employeeID,
+		"fio":         fio,
+		"birth_date":  documentDate(birthDate),
+		"hire_date":   documentDate(hireDate),
+		"job_title":   jobTitle,
+		"subdivision": subdivision,
+		"today":       time.Now().Format(documentDateLayout),
+	}
+	return d, nil
+}
+
+// queryTable читает строки запроса в таблицу документа с заголовком header.
+func queryTable(header []string, query string, args ...interface{}) (docBlock, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return docBlock{}, err
+	}
+	defer rows.Close()
+	table := docBlock{Kind: "table", Rows: [][]string{header}}
+	for rows.Next() {
+		row := make([]string, len(header))
+		dest := make([]interface{}, len(header))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return docBlock{}, err
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, rows.Err()
+}
+
+// personalCardBlocks — личная карточка по образцу формы Т-2: общие сведения, образование,
+// знание языков, стаж и история назначений.
+func personalCardBlocks(employeeID int, d *employeeDocumentData) ([]docBlock, error) {
+	f := d.fields
+	blocks := []docBlock{
+		{Kind: "heading", Text: "ЛИЧНАЯ КАРТОЧКА РАБОТНИКА"},
+		{Kind: "subheading", Text: "I. Общие сведения"},
+		{Kind: "table", Rows: [][]string{
+			{"Сведения", "Значение"},
+			{"Табельный номер", strconv.Itoa(employeeID)},
+			{"Фамилия, имя, отчество", f["fio"].(string)},
+			{"Дата рождения", f["birth_date"].(string)},
+			{"Возраст", documentAge(d.age)},
+			{"Дата приёма на работу", f["hire_date"].(string)},
+			{"Подразделение", f["subdivision"].(string)},
+			{"Должность", f["job_title"].(string)},
+		}},
+	}
+
+	education, err := queryTable([]string{"Образование", "Учебное заведение"}, `
+        SELECT ed.name, COALESCE(ee.place, '') FROM employee_education ee
+        JOIN education ed ON ed.id = ee.education_id
+        WHERE ee.employee_id = $1 ORDER BY ed.id
+    `, employeeID)
+	if err != nil {
+		return nil, err
+	}
+	languages, err := queryTable([]string{"Иностранный язык", "Степень знания"}, `
+        SELECT lg.language, COALESCE(el.proficiency::text, '') FROM employee_languages el
+        JOIN languages lg ON lg.id = el.language_id
+        WHERE el.employee_id = $1 ORDER BY lg.language
+    `, employeeID)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := queryTable([]string{"Дата", "Вид", "Подразделение", "Должность", "Основание"}, `
+        SELECT to_char(a.effective_from, 'DD.MM.YYYY'),
+            CASE a.kind WHEN 'hire' THEN 'Приём' WHEN 'transfer' THEN 'Перевод' ELSE 'Повышение' END,
+            COALESCE(sd.name, ''), COALESCE(jt.name, ''), a.note
+        FROM employee_assignment a
+        LEFT JOIN subdivision sd ON sd.id = a.subdivision_id
+        LEFT JOIN job_title jt ON jt.id = a.job_title_id
+        WHERE a.employee_id = $1 ORDER BY a.effective_from, a.id
+    `, employeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks = append(blocks, docBlock{Kind: "subheading", Text: "Образование"})
+	if len(education.Rows) > 1 {
+		blocks = append(blocks, education)
+	} else {
+		blocks = append(blocks, docBlock{Kind: "paragraph", Text: "Сведений нет"})
+	}
+	blocks = append(blocks, docBlock{Kind: "subheading", Text: "Знание иностранных языков"})
+	if len(languages.Rows) > 1 {
+		blocks = append(blocks, languages)
+	} else {
+		blocks = append(blocks, docBlock{Kind: "paragraph", Text: "Сведений нет"})
+	}
+	blocks = append(blocks,
+		docBlock{Kind: "subheading", Text: "Стаж работы"},
+		docBlock{Kind: "table", Rows: [][]string{
+			{"Вид стажа", "Лет"},
+			{"Общий", strconv.Itoa(d.overallExperience)},
+			{"Научно-технический", strconv.Itoa(d.spExperience)},
+		}},
+		docBlock{Kind: "subheading", Text: "II. Приём на работу и переводы"},
+		assignments,
+		docBlock{Kind: "paragraph", Text: "Работник ознакомлен ____________________ «___» __________ 20__ г."},
+	)
+	return blocks, nil
+}
+
+type DocumentTemplate struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	UpdatedBy *string   `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type documentTemplateRequest struct {
+	Name string `json:"name" binding:"required"`
+	Body string `json:"body" binding:"required"`
+}
+
+// validate проверяет, что шаблон разбирается и использует только известные подстановки.
+func (r documentTemplateRequest) validate() error {
+	if _, err := renderDocumentTemplate(r.Body, documentSample); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	return nil
+}
+
+const documentTemplateSelectSQL = `SELECT id, name, body, updated_by, updated_at FROM document_template`
+
+func scanDocumentTemplate(row interface{ Scan(...interface{}) error }) (DocumentTemplate, error) {
+	var t DocumentTemplate
+	err := row.Scan(&t.ID, &t.Name, &t.Body, &t.UpdatedBy, &t.UpdatedAt)
+	return t, err
+}
+
+func GetDocumentTemplates(c *gin.Context) {
+	rows, err := db.Query(documentTemplateSelectSQL + " ORDER BY id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	templates := []DocumentTemplate{}
+	for rows.Next() {
+		t, err := scanDocumentTemplate(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan templates"})
+			return
+		}
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates, "placeholders": documentSample})
+}
+
+func createDocumentTemplate(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	var req documentTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, err := scanDocumentTemplate(db.QueryRow(`
+        INSERT INTO document_template (name, body, updated_by) VALUES ($1, $2, $3)
+        RETURNING id, name, body, updated_by, updated_at
+    `, req.Name, req.Body, userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into document_template"})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+func updateDocumentTemplate(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	var req documentTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, err := scanDocumentTemplate(db.QueryRow(`
+        UPDATE document_template SET name = $1, body = $2, updated_by = $3, updated_at = NOW()
+        WHERE id = $4
+        RETURNING id, name, body, updated_by, updated_at
+    `, req.Name, req.Body, userID, c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update document_template"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func deleteDocumentTemplate(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM document_template WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type EmployeeDocument struct {
+	ID          int       `json:"id"`
+	EmployeeID  int       `json:"employee_id"`
+	Kind        string    `json:"kind"`
+	TemplateID  *int      `json:"template_id"`
+	Title       string    `json:"title"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	GeneratedBy *string   `json:"generated_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const employeeDocumentSelectSQL = `
+    SELECT id, employee_id, kind, template_id, title, filename, content_type, size, sha256, generated_by, created_at
+    FROM employee_document`
+
+func scanEmployeeDocument(row interface{ Scan(...interface{}) error }) (EmployeeDocument, error) {
+	var d EmployeeDocument
+	err := row.Scan(&d.ID, &d.EmployeeID, &d.Kind, &d.TemplateID, &d.Title, &d.Filename, &d.ContentType, &d.Size, &d.SHA256, &d.GeneratedBy, &d.CreatedAt)
+	return d, err
+}
+
+func GetEmployeeDocuments(c *gin.Context) {
+	if !checkEmployeeScope(c, c.Param("id")) {
+		return
+	}
+	rows, err := db.Query(employeeDocumentSelectSQL+" WHERE employee_id = $1 ORDER BY created_at, id", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	documents := []EmployeeDocument{}
+	for rows.Next() {
+		d, err := scanEmployeeDocument(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan documents"})
+			return
+		}
+		documents = append(documents, d)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, documents)
+}
+
+type documentRequest struct {
+	Kind       string `json:"kind" binding:"required,oneof=order personal_card"`
+	TemplateID *int   `json:"template_id"`
+	Format     string `json:"format" binding:"required,oneof=pdf docx"`
+}
+
+// generateEmployeeDocument формирует приказ по шаблону (kind=order, template_id) или личную
+// карточку (kind=personal_card) в PDF или DOCX и сохраняет его в документах сотрудника.
+func generateEmployeeDocument(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	employeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+	if !checkEmployeeScope(c, c.Param("id")) {
+		return
+	}
+
+	var req documentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Kind == "order" && req.TemplateID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "template_id is required for orders"})
+		return
+	}
+
+	data, err := loadEmployeeDocumentData(employeeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var title string
+	var blocks []docBlock
+	var templateID *int
+	if req.Kind == "order" {
+		t, err := scanDocumentTemplate(db.QueryRow(documentTemplateSelectSQL+" WHERE id = $1", *req.TemplateID))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		title, templateID = t.Name, &t.ID
+		if blocks, err = renderDocumentTemplate(t.Body, data.fields); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to render template: " + err.Error()})
+			return
+		}
+	} else {
+		title = "Личная карточка работника"
+		if blocks, err = personalCardBlocks(employeeID, data); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	var content []byte
+	contentType := docxContentType
+	if req.Format == "pdf" {
+		contentType = "application/pdf"
+		html, err := documentHTML(title, blocks)
+		if err == nil {
+			content, err = documentPDF(c.Request.Context(), html)
+		}
+		if err != nil {
+			log.Printf("Ошибка формирования PDF: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to render PDF"})
+			return
+		}
+	} else if content, err = documentDOCX(blocks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render DOCX"})
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate key"})
+		return
+	}
+	key := fmt.Sprintf("employees/%d/%s", employeeID, hex.EncodeToString(buf))
+	if err := blobs.Put(c.Request.Context(), key, content, contentType); err != nil {
+		log.Printf("Ошибка сохранения документа: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to store document"})
+		return
+	}
+
+	filename := cleanFilename(fmt.Sprintf("%s — %s.%s", title, data.fields["fio"], req.Format))
+	sum := sha256.Sum256(content)
+	doc, err := scanEmployeeDocument(db.QueryRow(`
+        INSERT INTO employee_document (employee_id, kind, template_id, title, filename, content_type, size, sha256, storage_key, generated_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        RETURNING id, employee_id, kind, template_id, title, filename, content_type, size, sha256, generated_by, created_at
+    `, employeeID, req.Kind, templateID, title, filename, contentType, len(content), hex.EncodeToString(sum[:]), key, userID))
+	if err != nil {
+		removeBlobs([]string{key})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into employee_document"})
+		return
+	}
+	c.JSON(http.StatusCreated, doc)
+}
+
+func downloadDocument(c *gin.Context) {
+	var filename, contentType, key string
+	var size int64
+	var employeeID int
+	err := db.QueryRow(`
+        SELECT employee_id, filename, content_type, size, storage_key FROM employee_document WHERE id = $1
+    `, c.Param("id")).Scan(&employeeID, &filename, &contentType, &size, &key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !checkEmployeeScopeOf(c, &employeeID) {
+		return
+	}
+	serveBlob(c, filename, contentType, size, key)
+}
+
+func deleteDocument(c *gin.Context) {
+	var employeeID int
+	err := db.QueryRow("SELECT employee_id FROM employee_document WHERE id = $1", c.Param("id")).Scan(&employeeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !checkEmployeeScopeOf(c, &employeeID) {
+		return
+	}
+
+	var key string
+	err = db.QueryRow("DELETE FROM employee_document WHERE id = $1 RETURNING storage_key", c.Param("id")).Scan(&key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	removeBlobs([]string{key})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
+}
+
+// deleteEmployeeDocuments удаляет записи о документах сотрудника и возвращает ключи их файлов.
+func deleteEmployeeDocuments(tx *sql.Tx, employeeID string) ([]string, error) {
+	rows, err := tx.Query("DELETE FROM employee_document WHERE employee_id = $1 RETURNING storage_key", employeeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRenderDocumentTemplate(t *testing.T) {
+	body := "# ПРИКАЗ № {{.employee_id}}\n\n  Принять {{.fio}} на должность «{{.job_title}}».  \n"
+	blocks, err := renderDocumentTemplate(body, documentSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []docBlock{
+		{Kind: "heading", Text: "ПРИКАЗ № 1"},
+		{Kind: "paragraph", Text: "Принять Иванов Иван Иванович на должность «Инженер»."},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d: %+v", len(blocks), len(want), blocks)
+	}
+	for i := range want {
+		if blocks[i].Kind != want[i].Kind || blocks[i].Text != want[i].Text {
+			t.Errorf("block %d = %+v, want %+v", i, blocks[i], want[i])
+		}
+	}
+}
+
+func TestDocumentTemplateValidate(t *testing.T) {
+	for _, body := range []string{"{{.salary}}", "{{.fio", "{{template \"x\"}}"} {
+		if err := (documentTemplateRequest{Name: "x", Body: body}).validate(); err == nil {
+			t.Errorf("%q: expected error", body)
+		}
+	}
+	if err := (documentTemplateRequest{Name: "x", Body: "{{.fio}}, {{.today}}"}).validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDocumentDOCX(t *testing.T) {
+	data, err := documentDOCX([]docBlock{
+		{Kind: "heading", Text: "Приказ"},
+		{Kind: "paragraph", Text: `ООО «Рога & Копыта» <test>`},
+		{Kind: "table", Rows: [][]string{{"Поле", "Значение"}, {"ФИО", "Иванов"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isDOCX(data) {
+		t.Fatal("result is not recognised as DOCX")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, _ := io.ReadAll(rc)
+		rc.Close()
+		s := string(doc)
+		if !strings.Contains(s, "Рога &amp; Копыта» &lt;test&gt;") {
+			t.Errorf("text not escaped: %s", s)
+		}
+		if strings.Count(s, "<w:tc>") != 4 {
+			t.Errorf("expected 4 table cells: %s", s)
+		}
+		return
+	}
+	t.Fatal("word/document.xml not found")
+}
+
+func TestDocumentHTML(t *testing.T) {
+	html, err := documentHTML("Карточка", []docBlock{
+		{Kind: "paragraph", Text: "<script>alert(1)</script>"},
+		{Kind: "table", Rows: [][]string{{"A"}, {"b"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("paragraph text is not escaped")
+	}
+	if !strings.Contains(html, "<th>A</th>") || !strings.Contains(html, "<td>b</td>") {
+		t.Errorf("unexpected table markup: %s", html)
+	}
+}
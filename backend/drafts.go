@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Draft struct {
+	ID        int             `json:"id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+const maxDraftBytes = 64 << 10
+
+var errDraftNotFound = errors.New("draft not found")
+
+// draftTTL — сколько черновик живёт после последнего сохранения.
+func draftTTL() time.Duration {
+	return envDuration("DRAFT_TTL", 30*24*time.Hour)
+}
+
+// readDraftData проверяет только то, что data — JSON-объект разумного размера:
+// черновик может быть заполнен частично и с ошибками, полная проверка — при подаче.
+func readDraftData(c *gin.Context) (json.RawMessage, error) {
+	var req struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	data := bytes.TrimSpace(req.Data)
+	if len(data) == 0 || data[0] != '{' {
+		return nil, errors.New("data must be a JSON object")
+	}
+	if len(data) > maxDraftBytes {
+		return nil, errors.New("draft is too large")
+	}
+	return data, nil
+}
+
+const draftSelectSQL = `SELECT id, data, created_at, updated_at, expires_at FROM bid_draft`
+
+func scanDraft(row interface{ Scan(...interface{}) error }) (Draft, error) {
+	var d Draft
+	var data []byte
+	err := row.Scan(&d.ID, &data, &d.CreatedAt, &d.UpdatedAt, &d.ExpiresAt)
+	d.Data = data
+	return d, err
+}
+
+func GetDrafts(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	rows, err := db.Query(draftSelectSQL+` WHERE user_id = $1 AND expires_at > NOW() ORDER BY updated_at DESC`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	drafts := []Draft{}
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan drafts"})
+			return
+		}
+		drafts = append(drafts, d)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, drafts)
+}
+
+func GetDraft(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft ID"})
+		return
+	}
+
+	d, err := scanDraft(db.QueryRow(draftSelectSQL+` WHERE id = $1 AND user_id = $2 AND expires_at > NOW()`, id, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+func createDraft(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	data, err := readDraftData(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	d, err := scanDraft(db.QueryRow(`
+        INSERT INTO bid_draft (user_id, data, expires_at)
+        VALUES ($1, $2, NOW() + make_interval(secs => $3))
+        RETURNING id, data, created_at, updated_at, expires_at
+    `, userID, string(data), draftTTL().Seconds()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into bid_draft"})
+		return
+	}
+	c.JSON(http.StatusCreated, d)
+}
+
+// patchDraft сливает переданные поля с сохранёнными (null удаляет поле) и продлевает срок жизни.
+func patchDraft(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft ID"})
+		return
+	}
+
+	data, err := readDraftData(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	d, err := scanDraft(db.QueryRow(`
+        UPDATE bid_draft SET
+            data = jsonb_strip_nulls(data || $3::jsonb),
+            updated_at = NOW(),
+            expires_at = NOW() + make_interval(secs => $4)
+        WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+        RETURNING id, data, created_at, updated_at, expires_at
+    `, id, userID, string(data), draftTTL().Seconds()))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bid_draft"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+func deleteDraft(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft ID"})
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM bid_draft WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Draft deleted successfully"})
+}
+
+// submitDraft подаёт черновик как обычную заявку с полной проверкой; черновик удаляется
+// в той же транзакции, поэтому повторная подача не создаст вторую заявку.
+func submitDraft(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft ID"})
+		return
+	}
+
+	d, err := scanDraft(db.QueryRow(draftSelectSQL+` WHERE id = $1 AND user_id = $2 AND expires_at > NOW()`, id, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var req applicationRequest
+	if err := json.Unmarshal(d.Data, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Draft is not a valid application: " + err.Error()})
+		return
+	}
+
+	submitApplication(c, req, nil, func(tx *sql.Tx) error {
+		result, err := tx.Exec("DELETE FROM bid_draft WHERE id = $1 AND user_id = $2", id, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errDraftNotFound
+		}
+		return nil
+	})
+}
+
+func purgeExpiredDrafts() (int64, error) {
+	result, err := db.Exec("DELETE FROM bid_draft WHERE expires_at <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestReadDraftData(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := map[string]bool{
+		`{"data": {"fio": "Иванов", "age": null}}`: true,
+		`{"data": {}}`:     true,
+		`{"data": [1, 2]}`: false,
+		`{"data": "text"}`: false,
+		`{}`:               false,
+		`{"data": {"fio": "` + strings.Repeat("я", maxDraftBytes) + `"}}`: false,
+	}
+	for body, ok := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/drafts", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		_, err := readDraftData(c)
+		if (err == nil) != ok {
+			t.Errorf("readDraftData(%.40q): err = %v", body, err)
+		}
+	}
+}
+
+// Черновик проверяется при подаче так же строго, как обычная заявка.
+func TestApplicationValidate(t *testing.T) {
+	var req applicationRequest
+	json.Unmarshal([]byte(`{"fio": "Иванов Иван", "job_title_id": 1, "subdivision_id": 2,
+		"languages": [{"language_id": 1, "proficiency": "B2"}]}`), &req)
+	if err := req.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	partial := req
+	partial.SubdivisionID = 0
+	if err := partial.validate(); err == nil {
+		t.Error("expected error without subdivision or vacancy")
+	}
+
+	json.Unmarshal([]byte(`{"languages": [{"language_id": 1, "proficiency": "fluent"}]}`), &req)
+	if err := req.validate(); err == nil {
+		t.Error("expected error for unknown proficiency")
+	}
+
+	req = applicationRequest{VacancyID: 3}
+	if err := req.validate(); err == nil {
+		t.Error("expected error without fio")
+	}
+}
+
+func TestDraftInvalidID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userClaims", jwt.MapClaims{"user_id": "1"}) })
+	r.GET("/api/drafts/:id", GetDraft)
+	r.PATCH("/api/drafts/:id", patchDraft)
+	r.DELETE("/api/drafts/:id", deleteDraft)
+	r.POST("/api/drafts/:id/submit", submitDraft)
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/api/drafts/abc"},
+		{http.MethodPatch, "/api/drafts/abc"},
+		{http.MethodDelete, "/api/drafts/abc"},
+		{http.MethodPost, "/api/drafts/abc/submit"},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"data":{}}`)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: got %d, want 400", tc.method, tc.path, w.Code)
+		}
+	}
+}
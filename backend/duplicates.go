@@ -0,0 +1,293 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type DuplicateMatch struct {
+	BidID       int      `json:"bid_id"`
+	DuplicateID int      `json:"duplicate_id"`
+	Kind        string   `json:"kind"`
+	FIO         string   `json:"fio"`
+	Similarity  float64  `json:"similarity"`
+	Reasons     []string `json:"reasons"`
+}
+
+func duplicateWindow() time.Duration {
+	return envDuration("DUPLICATE_WINDOW", 30*24*time.Hour)
+}
+
+// duplicateSimilarity — порог триграммного сходства нормализованных ФИО для панели рецензента.
+func duplicateSimilarity() float64 {
+	return float64(envInt("DUPLICATE_SIMILARITY_PERCENT", 80)) / 100
+}
+
+// submitterID возвращает пользователя, подавшего заявку, если он был авторизован.
+func submitterID(c *gin.Context) *string {
+	claims, ok := c.Get("userClaims")
+	if !ok {
+		return nil
+	}
+	userID, ok := claims.(jwt.MapClaims)["user_id"].(string)
+	if !ok {
+		return nil
+	}
+	return &userID
+}
+
+// findDuplicateBid ищет в окне DUPLICATE_WINDOW заявку с тем же ФИО, возрастом, должностью и подателем.
+// Блокировка по ФИО не даёт двум одновременным отправкам одной формы разминуться.
+func findDuplicateBid(tx *sql.Tx, fio string, birthDate *time.Time, jobTitleID int, submittedBy *string) (*int, error) {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('bid:' || normalize_fio($1)))", fio); err != nil {
+		return nil, err
+	}
+
+	var id int
+	err := tx.QueryRow(`
+        SELECT eb.id FROM employee_bid_computed eb
+        WHERE normalize_fio(eb.fio) = normalize_fio($1)
+            AND eb.age = date_part('year', age($2::date))::int
+            AND eb.job_title_id = $3
+            AND eb.submitted_by IS NOT DISTINCT FROM $4
+            AND eb.created_at > NOW() - make_interval(secs => $5)
+            AND eb.status = 'submitted'
+        ORDER BY eb.id
+        LIMIT 1
+    `, fio, birthDate, jobTitleID, submittedBy, duplicateWindow().Seconds()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// queryDuplicates выполняет поиск дублей с порогом похожести threshold ($1). Тот же порог
+// задаётся оператору % только на время транзакции, чтобы не влиять на другие запросы соединения.
+func queryDuplicates(query string, threshold float64, args ...interface{}) ([]DuplicateMatch, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', $1, true)", strconv.FormatFloat(threshold, 'f', -1, 64)); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(query, append([]interface{}{threshold}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDuplicates(rows)
+}
+
+func scanDuplicates(rows *sql.Rows) ([]DuplicateMatch, error) {
+	defer rows.Close()
+	matches := []DuplicateMatch{}
+	for rows.Next() {
+		var m DuplicateMatch
+		var sameAge, sameJob, sameSubmitter bool
+		if err := rows.Scan(&m.BidID, &m.DuplicateID, &m.Kind, &m.FIO, &m.Similarity, &sameAge, &sameJob, &sameSubmitter); err != nil {
+			return nil, err
+		}
+		m.Reasons = duplicateReasons(m.Similarity, sameAge, sameJob, sameSubmitter)
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+func duplicateReasons(similarity float64, sameAge, sameJob, sameSubmitter bool) []string {
+	reasons := []string{"fio_similar"}
+	if similarity >= 1 {
+		reasons[0] = "fio"
+	}
+	if sameAge {
+		reasons = append(reasons, "age")
+	}
+	if sameJob {
+		reasons = append(reasons, "job_title")
+	}
+	if sameSubmitter {
+		reasons = append(reasons, "submitter")
+	}
+	return reasons
+}
+
+// Пары похожих заявок: ФИО близки по триграммам (оператор % отбирает кандидатов по индексу,
+// similarity уточняет порог), возраст отличается не больше чем на год
+// (даты рождения из старых целых значений приблизительны). Неизвестный возраст пару
+// не исключает, но и совпадением не считается.
+const duplicateBidsSQL = `
+    SELECT a.id, b.id, 'bid', b.fio, similarity(normalize_fio(a.fio), normalize_fio(b.fio)),
+        COALESCE(a.age = b.age, false), a.job_title_id = b.job_title_id,
+        a.submitted_by IS NOT NULL AND a.submitted_by = b.submitted_by
+    FROM employee_bid_computed a
+    JOIN employee_bid_computed b ON b.id <> a.id AND normalize_fio(a.fio) % normalize_fio(b.fio)
+    WHERE similarity(normalize_fio(a.fio), normalize_fio(b.fio)) >= $1
+        AND (a.age IS NULL OR b.age IS NULL OR abs(a.age - b.age) <= 1)
+        AND a.status = 'submitted' AND b.status = 'submitted'`
+
+const duplicateEmployeesSQL = `
+    SELECT a.id, e.id, 'employee', e.fio, similarity(normalize_fio(a.fio), normalize_fio(e.fio)),
+        COALESCE(a.age = e.age, false), a.job_title_id = e.job_title_id, false
+    FROM employee_bid_computed a
+    JOIN employee_computed e ON normalize_fio(a.fio) % normalize_fio(e.fio)
+    WHERE similarity(normalize_fio(a.fio), normalize_fio(e.fio)) >= $1
+        AND (a.age IS NULL OR e.age IS NULL OR abs(a.age - e.age) <= 1) AND a.status = 'submitted'`
+
+// GetDuplicateBids — панель возможных дублей: пары заявок и заявки, похожие на уже принятых сотрудников.
+func GetDuplicateBids(c *gin.Context) {
+	matches, err := queryDuplicates(duplicateBidsSQL+" AND a.id < b.id UNION ALL "+duplicateEmployeesSQL+" ORDER BY 1, 5 DESC", duplicateSimilarity())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
+func GetBidDuplicates(c *gin.Context) {
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	matches, err := queryDuplicates(duplicateBidsSQL+" AND a.id = $2 UNION ALL "+duplicateEmployeesSQL+" AND a.id = $2 ORDER BY 5 DESC", duplicateSimilarity(), bidID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
+// mergeBid переносит в заявку into всё, чего в ней нет, из заявки :id, после чего удаляет :id.
+// Обсуждение, собеседования и вложения дубля переходят к сохраняемой заявке.
+func mergeBid(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	sourceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	var req struct {
+		Into int `json:"into" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Into == sourceID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot merge a bid into itself"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var locked int
+	err = tx.QueryRow(`
+        SELECT COUNT(*) FROM (
+            SELECT id FROM employee_bid WHERE id IN ($1, $2) ORDER BY id FOR UPDATE
+        ) b
+    `, sourceID, req.Into).Scan(&locked)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if locked != 2 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+
+	// Объединяются только заявки на рассмотрении: отозванную или уже решённую заявку не трогаем
+	var submitted int
+	err = tx.QueryRow("SELECT COUNT(*) FROM employee_bid WHERE id IN ($1, $2) AND status = 'submitted'", sourceID, req.Into).Scan(&submitted)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if submitted != 2 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Both bids must be submitted to merge"})
+		return
+	}
+
+	moves := []struct {
+		query string
+		table string
+	}{
+		{`INSERT INTO employee_languages_bid (employee_id, language_id, proficiency)
+            SELECT $2, s.language_id, s.proficiency FROM employee_languages_bid s
+            WHERE s.employee_id = $1 AND NOT EXISTS (
+                SELECT 1 FROM employee_languages_bid t WHERE t.employee_id = $2 AND t.language_id = s.language_id)`, "employee_languages_bid"},
+		{`INSERT INTO employee_education_bid (employee_id, education_id, place)
+            SELECT $2, s.education_id, s.place FROM employee_education_bid s
+            WHERE s.employee_id = $1 AND NOT EXISTS (
+                SELECT 1 FROM employee_education_bid t WHERE t.employee_id = $2 AND t.education_id = s.education_id)`, "employee_education_bid"},
+		{`INSERT INTO employee_experience_bid (employee_id, started_on, ended_on, specialty)
+            SELECT $2, started_on, ended_on, specialty FROM employee_experience_bid
+            WHERE employee_id = $1 AND NOT EXISTS (SELECT 1 FROM employee_experience_bid WHERE employee_id = $2)`, "employee_experience_bid"},
+		{"UPDATE bid_comment SET bid_id = $2 WHERE bid_id = $1", "bid_comment"},
+		{"UPDATE interview SET bid_id = $2 WHERE bid_id = $1", "interview"},
+		{"UPDATE attachment SET bid_id = $2 WHERE bid_id = $1", "attachment"},
+		{"UPDATE bid_revision SET bid_id = $2 WHERE bid_id = $1", "bid_revision"},
+		{"UPDATE employee_bid SET duplicate_of = CASE WHEN id = $2 THEN NULL ELSE $2::int END WHERE duplicate_of = $1", "employee_bid"},
+	}
+	for _, step := range moves {
+		if _, err := tx.Exec(step.query, sourceID, req.Into); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge " + step.table})
+			return
+		}
+	}
+	for _, table := range []string{"employee_languages_bid", "employee_education_bid"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE employee_id = $1", sourceID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from " + table})
+			return
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM employee_bid WHERE id = $1", sourceID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from employee_bid"})
+		return
+	}
+
+	note := fmt.Sprintf("Заявка #%d объединена с этой заявкой", sourceID)
+	if _, err := insertComment(tx, req.Into, nil, nil, userID, note, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into bid_comment"})
+		return
+	}
+	if err := publishBidEvent(tx, "bid.decided", sourceID, gin.H{"decision": "merged", "into": req.Into}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish bid event"})
+		return
+	}
+	if err := publishBidEvent(tx, "bid.updated", req.Into, gin.H{"change": "merged", "merged_bid_id": sourceID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish bid event"})
+		return
+	}
+	if err := closeBidStat(tx, sourceID, "merged"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bid_stat"})
+		return
+	}
+	// Опыт источника мог перейти в целевую заявку
+	if err := snapshotBidStat(tx, req.Into); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bid_stat"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bids merged successfully", "bid_id": req.Into})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+func TestDuplicateReasons(t *testing.T) {
+	got := duplicateReasons(1, true, true, false)
+	if expected := []string{"fio", "age", "job_title"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+	got = duplicateReasons(0.85, false, false, true)
+	if expected := []string{"fio_similar", "submitter"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestMergeBidRequiresSubmitted(t *testing.T) {
+	openTestDB(t)
+	job, sub, _ := testPosition(t, nil)
+
+	var ids []int
+	for _, status := range []string{"submitted", "submitted", "withdrawn"} {
+		var id int
+		err := db.QueryRow(`
+            INSERT INTO employee_bid (fio, birth_date, job_title_id, subdivision_id, status)
+            VALUES ('Дубль Заявки', '1990-01-01', $1, $2, $3) RETURNING id
+        `, job, sub, status).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM employee_bid WHERE id = ANY($1)", pq.Array(ids)) })
+
+	r := gin.New()
+	r.POST("/api/bids/:id/merge", func(c *gin.Context) {
+		c.Set("userClaims", jwt.MapClaims{"user_id": "0"})
+		mergeBid(c)
+	})
+	merge := func(source, into int) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/api/bids/%d/merge", source), strings.NewReader(fmt.Sprintf(`{"into":%d}`, into))))
+		return w.Code
+	}
+
+	if code := merge(ids[2], ids[0]); code != http.StatusConflict {
+		t.Errorf("merging a withdrawn bid: got %d, want 409", code)
+	}
+	if code := merge(ids[0], ids[2]); code != http.StatusConflict {
+		t.Errorf("merging into a withdrawn bid: got %d, want 409", code)
+	}
+}
+
+func TestBidDuplicatesBySimilarFIO(t *testing.T) {
+	openTestDB(t)
+	job, sub, _ := testPosition(t, nil)
+	suffix := fmt.Sprint(time.Now().UnixNano())
+
+	var ids []int
+	for _, fio := range []string{"Иванов Пётр " + suffix, "иванов  петр " + suffix, "Сидоров Олег " + suffix} {
+		var id int
+		err := db.QueryRow(`
+            INSERT INTO employee_bid (fio, birth_date, job_title_id, subdivision_id, status)
+            VALUES ($1, '1990-01-01', $2, $3, 'submitted') RETURNING id
+        `, fio, job, sub).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM employee_bid WHERE id = ANY($1)", pq.Array(ids)) })
+
+	matches, err := queryDuplicates(duplicateBidsSQL+" AND a.id = $2", duplicateSimilarity(), ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].DuplicateID != ids[1] {
+		t.Fatalf("matches = %+v, want only bid %d", matches, ids[1])
+	}
+	if strings.Join(matches[0].Reasons, ",") != "fio,age,job_title" {
+		t.Errorf("reasons = %v", matches[0].Reasons)
+	}
+}
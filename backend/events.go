@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/lib/pq"
+)
+
+// BidEvent — событие по заявке: bid.created, bid.updated или bid.decided.
+// Событие reset означает, что пропущено слишком много и входящие нужно перечитать целиком.
+type BidEvent struct {
+	ID        int64           `json:"id"`
+	Kind      string          `json:"event"`
+	BidID     int             `json:"bid_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+const (
+	bidEventChannel     = "bid_events"
+	bidEventReplayLimit = 500
+	bidEventHeartbeat   = 25 * time.Second
+)
+
+func bidEventRetention() time.Duration {
+	return envDuration("BID_EVENT_RETENTION", 7*24*time.Hour)
+}
+
+// publishBidEvent пишет событие в журнал и уведомляет все экземпляры бэкенда.
+// NOTIFY доставляется только при фиксации транзакции, поэтому откат не порождает событий.
+func publishBidEvent(tx *sql.Tx, kind string, bidID int, data gin.H) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var id int64
+	if err := tx.QueryRow("INSERT INTO bid_event (kind, bid_id, data) VALUES ($1, $2, $3) RETURNING id", kind, bidID, string(payload)).Scan(&id); err != nil {
+		return err
+	}
+	_, err = tx.Exec("SELECT pg_notify($1, $2)", bidEventChannel, strconv.FormatInt(id, 10))
+	return err
+}
+
+func loadBidEvents(where string, args ...interface{}) ([]BidEvent, error) {
+	rows, err := db.Query("SELECT id, kind, bid_id, data, created_at FROM bid_event WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []BidEvent
+	for rows.Next() {
+		var ev BidEvent
+		var data []byte
+		if err := rows.Scan(&ev.ID, &ev.Kind, &ev.BidID, &data, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		ev.Data = data
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// eventBroker раздаёт события подписчикам внутри процесса.
+type eventBroker struct {
+	mu   sync.Mutex
+	subs map[chan BidEvent]struct{}
+}
+
+var bidEvents = &eventBroker{subs: map[chan BidEvent]struct{}{}}
+
+func (b *eventBroker) subscribe() (<-chan BidEvent, func()) {
+	ch := make(chan BidEvent, 64)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish не блокируется: отстающий подписчик отключается и после переподключения
+// догонит пропущенное по Last-Event-ID.
+func (b *eventBroker) publish(ev BidEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// listenBidEvents слушает NOTIFY от всех экземпляров и передаёт события брокеру.
+// После разрыва соединения уведомления могли потеряться, поэтому журнал дочитывается с последнего id.
+func listenBidEvents(connStr string) {
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Ошибка подписки на %s: %v", bidEventChannel, err)
+		}
+	})
+	if err := listener.Listen(bidEventChannel); err != nil {
+		log.Printf("Ошибка LISTEN %s: %v", bidEventChannel, err)
+	}
+
+	var lastID int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM bid_event").Scan(&lastID); err != nil {
+		log.Printf("Ошибка чтения журнала событий: %v", err)
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			var events []BidEvent
+			var err error
+			if n == nil {
+				events, err = loadBidEvents("id > $1 ORDER BY id", lastID)
+			} else {
+				events, err = loadBidEvents("id = $1", n.Extra)
+			}
+			if err != nil {
+				log.Printf("Ошибка чтения журнала событий: %v", err)
+				continue
+			}
+			for _, ev := range events {
+				bidEvents.publish(ev)
+				if ev.ID > lastID {
+					lastID = ev.ID
+				}
+			}
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+// streamBidEvents отправляет события после lastEventID, затем новые, пока клиент не отключится.
+func streamBidEvents(ctx context.Context, lastEventID string, send func(BidEvent) error, ping func() error) error {
+	ch, unsubscribe := bidEvents.subscribe()
+	defer unsubscribe()
+
+	// Подписка оформлена до чтения журнала, поэтому событие может прийти дважды — повтор пропускаем
+	replayed := map[int64]bool{}
+	if lastID, err := strconv.ParseInt(lastEventID, 10, 64); err == nil {
+		events, err := loadBidEvents("id > $1 ORDER BY id LIMIT $2", lastID, bidEventReplayLimit+1)
+		if err != nil {
+			return err
+		}
+		if len(events) > bidEventReplayLimit {
+			reset := BidEvent{Kind: "reset", Data: json.RawMessage("{}"), CreatedAt: time.Now()}
+			if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM bid_event").Scan(&reset.ID); err != nil {
+				return err
+			}
+			events = []BidEvent{reset}
+		}
+		for _, ev := range events {
+			if err := send(ev); err != nil {
+				return err
+			}
+			replayed[ev.ID] = true
+		}
+	}
+
+	heartbeat := time.NewTicker(bidEventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("event subscriber is too slow")
+			}
+			if replayed[ev.ID] {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeSSE(w io.Writer, ev BidEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Kind, data)
+	return err
+}
+
+// StreamBidEventsSSE — поток событий в формате Server-Sent Events. Браузерный EventSource
+// сам передаёт Last-Event-ID при переподключении; ?last_event_id= — для первого подключения.
+func StreamBidEventsSSE(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	w := c.Writer
+	io.WriteString(w, "retry: 3000\n\n")
+	w.Flush()
+
+	err := streamBidEvents(c.Request.Context(), lastEventID,
+		func(ev BidEvent) error {
+			if err := writeSSE(w, ev); err != nil {
+				return err
+			}
+			w.Flush()
+			return nil
+		},
+		func() error {
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return err
+			}
+			w.Flush()
+			return nil
+		})
+	if err != nil {
+		log.Printf("Поток событий SSE завершён: %v", err)
+	}
+}
+
+// StreamBidEventsWS — тот же поток через WebSocket, по одному JSON-объекту в текстовом кадре.
+// Соединение авторизуется cookie, поэтому чужие Origin отклоняются.
+func StreamBidEventsWS(c *gin.Context) {
+	if origin := c.GetHeader("Origin"); origin != "" && origin != envString("PUBLIC_BASE_URL", "http://localhost:8081") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+		return
+	}
+
+	conn, rw, _, err := ws.UpgradeHTTP(c.Request, c.Writer)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var mu sync.Mutex
+	write := func(op ws.OpCode, p []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return wsutil.WriteServerMessage(conn, op, p)
+	}
+
+	// Клиент ничего не присылает, кроме управляющих кадров; чтение нужно, чтобы заметить закрытие
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			h, err := ws.ReadHeader(rw.Reader)
+			if err != nil || h.Length > 4096 {
+				return
+			}
+			payload := make([]byte, h.Length)
+			if _, err := io.ReadFull(rw.Reader, payload); err != nil {
+				return
+			}
+			if h.Masked {
+				ws.Cipher(payload, h.Mask, 0)
+			}
+			switch h.OpCode {
+			case ws.OpClose:
+				write(ws.OpClose, ws.NewCloseFrameBody(ws.StatusNormalClosure, ""))
+				return
+			case ws.OpPing:
+				write(ws.OpPong, payload)
+			}
+		}
+	}()
+
+	err = streamBidEvents(ctx, c.Query("last_event_id"),
+		func(ev BidEvent) error {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			return write(ws.OpText, data)
+		},
+		func() error { return write(ws.OpPing, nil) })
+	if err != nil {
+		log.Printf("Поток событий WebSocket завершён: %v", err)
+	}
+}
+
+// purgeBidEvents удаляет события старше BID_EVENT_RETENTION.
+func purgeBidEvents() (int64, error) {
+	result, err := db.Exec("DELETE FROM bid_event WHERE created_at < NOW() - make_interval(secs => $1)", bidEventRetention().Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	ev := BidEvent{ID: 42, Kind: "bid.created", BidID: 7, Data: json.RawMessage(`{"fio":"Иванов"}`), CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if err := writeSSE(&buf, ev); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id: 42\nevent: bid.created\n" +
+		`data: {"id":42,"event":"bid.created","bid_id":7,"data":{"fio":"Иванов"},"created_at":"2025-01-02T03:04:05Z"}` + "\n\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected frame:\n%q\nwant\n%q", buf.String(), expected)
+	}
+}
+
+func TestEventBrokerDropsSlowSubscriber(t *testing.T) {
+	b := &eventBroker{subs: map[chan BidEvent]struct{}{}}
+	fast, cancelFast := b.subscribe()
+	defer cancelFast()
+	slow, cancelSlow := b.subscribe()
+	defer cancelSlow()
+
+	for i := 1; i <= cap(fast)+1; i++ {
+		b.publish(BidEvent{ID: int64(i)})
+		if i <= cap(fast) {
+			<-fast
+		}
+	}
+
+	if ev := <-fast; ev.ID != int64(cap(fast)+1) {
+		t.Errorf("fast subscriber got %d", ev.ID)
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != cap(fast) {
+		t.Errorf("slow subscriber should be closed after %d events, got %d", cap(fast), n)
+	}
+}
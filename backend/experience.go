@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+type ExperiencePeriod struct {
+	StartedOn string `json:"started_on"`
+	EndedOn   string `json:"ended_on,omitempty"`
+	Specialty bool   `json:"specialty"`
+}
+
+// personDates — поля анкеты, из которых вычисляются возраст и стаж.
+// Старые клиенты присылают целые age / overall_experience / s_p_experience,
+// они переводятся в приблизительные даты так же, как это сделала миграция.
+type personDates struct {
+	BirthDate         string             `json:"birth_date"`
+	Experience        []ExperiencePeriod `json:"experience"`
+	Age               *int               `json:"age"`
+	OverallExperience *int               `json:"overall_experience"`
+	SPExperience      *int               `json:"s_p_experience"`
+}
+
+type experienceRow struct {
+	StartedOn time.Time
+	EndedOn   *time.Time
+	Specialty bool
+}
+
+func (p personDates) resolve(today time.Time) (*time.Time, []experienceRow, error) {
+	var birth *time.Time
+	switch {
+	case p.BirthDate != "":
+		d, err := time.Parse(dateLayout, p.BirthDate)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid birth_date")
+		}
+		if d.After(today) {
+			return nil, nil, fmt.Errorf("birth_date is in the future")
+		}
+		birth = &d
+	case p.Age != nil:
+		if *p.Age < 0 {
+			return nil, nil, fmt.Errorf("age must not be negative")
+		}
+		d := today.AddDate(-*p.Age, 0, 0)
+		birth = &d
+	}
+
+	if len(p.Experience) > 0 {
+		periods := make([]experienceRow, 0, len(p.Experience))
+		for _, e := range p.Experience {
+			start, err := time.Parse(dateLayout, e.StartedOn)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid experience started_on")
+			}
+			row := experienceRow{StartedOn: start, Specialty: e.Specialty}
+			if e.EndedOn != "" {
+				end, err := time.Parse(dateLayout, e.EndedOn)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid experience ended_on")
+				}
+				if end.Before(start) {
+					return nil, nil, fmt.Errorf("experience ended_on is before started_on")
+				}
+				row.EndedOn = &end
+			}
+			periods = append(periods, row)
+		}
+		return birth, periods, nil
+	}
+
+	overall, sp := 0, 0
+	if p.OverallExperience != nil {
+		overall = *p.OverallExperience
+	}
+	if p.SPExperience != nil {
+		sp = *p.SPExperience
+	}
+	if overall < 0 || sp < 0 {
+		return nil, nil, fmt.Errorf("experience must not be negative")
+	}
+	return birth, legacyExperience(overall, sp, today), nil
+}
+
+// legacyExperience раскладывает стаж в годах на два периода, заканчивающиеся сегодня:
+// последние sp лет — по специальности, предшествующие overall-sp лет — прочий стаж.
+func legacyExperience(overall, sp int, today time.Time) []experienceRow {
+	if sp > overall {
+		overall = sp
+	}
+	var periods []experienceRow
+	spStart := today.AddDate(-sp, 0, 0)
+	if overall > sp {
+		end := spStart
+		periods = append(periods, experienceRow{StartedOn: today.AddDate(-overall, 0, 0), EndedOn: &end})
+	}
+	if sp > 0 {
+		end := today
+		periods = append(periods, experienceRow{StartedOn: spStart, EndedOn: &end, Specialty: true})
+	}
+	return periods
+}
+
+// insertExperience записывает периоды стажа в employee_experience или employee_experience_bid.
+func insertExperience(tx *sql.Tx, table string, employeeID int, periods []experienceRow) error {
+	for _, p := range periods {
+		_, err := tx.Exec(`
+            INSERT INTO `+table+` (employee_id, started_on, ended_on, specialty)
+            VALUES ($1, $2, $3, $4)
+        `, employeeID, p.StartedOn, p.EndedOn, p.Specialty)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatDate(t sql.NullTime) interface{} {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time.Format(dateLayout)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLegacyExperience(t *testing.T) {
+	today := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+	periods := legacyExperience(7, 5, today)
+	if len(periods) != 2 {
+		t.Fatalf("expected 2 periods, got %d", len(periods))
+	}
+	if !periods[0].StartedOn.Equal(time.Date(2018, 3, 15, 0, 0, 0, 0, time.UTC)) || periods[0].Specialty {
+		t.Errorf("unexpected general period: %+v", periods[0])
+	}
+	if !periods[1].StartedOn.Equal(time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC)) || !periods[1].Specialty {
+		t.Errorf("unexpected specialty period: %+v", periods[1])
+	}
+
+	if periods := legacyExperience(0, 0, today); len(periods) != 0 {
+		t.Errorf("expected no periods, got %d", len(periods))
+	}
+}
+
+func TestPersonDatesResolve(t *testing.T) {
+	today := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	var legacy personDates
+	if err := json.Unmarshal([]byte(`{"age": 30, "overall_experience": 4, "s_p_experience": 3}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	birth, periods, err := legacy.resolve(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if birth == nil || birth.Year() != 1995 {
+		t.Errorf("unexpected birth date: %v", birth)
+	}
+	if len(periods) != 2 {
+		t.Errorf("expected 2 periods, got %d", len(periods))
+	}
+
+	var dated personDates
+	if err := json.Unmarshal([]byte(`{"birth_date": "1990-01-02", "experience": [{"started_on": "2015-01-01", "specialty": true}]}`), &dated); err != nil {
+		t.Fatal(err)
+	}
+	birth, periods, err = dated.resolve(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if birth.Format(dateLayout) != "1990-01-02" || len(periods) != 1 || periods[0].EndedOn != nil {
+		t.Errorf("unexpected result: %v %+v", birth, periods)
+	}
+
+	bad := personDates{Experience: []ExperiencePeriod{{StartedOn: "2020-01-01", EndedOn: "2019-01-01"}}}
+	if _, _, err := bad.resolve(today); err == nil {
+		t.Error("expected error for inverted period")
+	}
+}
+
+func TestAcceptClosesOpenExperience(t *testing.T) {
+	openTestDB(t)
+	job, sub, _ := testPosition(t, nil)
+	fio := fmt.Sprint("Кандидат Стаж ", time.Now().UnixNano())
+
+	var bidID int
+	err := db.QueryRow(`
+        INSERT INTO employee_bid (fio, birth_date, job_title_id, subdivision_id)
+        VALUES ($1, '1990-01-01', $2, $3) RETURNING id
+    `, fio, job, sub).Scan(&bidID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM bid_comment WHERE bid_id = $1", bidID)
+		db.Exec("DELETE FROM employee_bid WHERE id = $1", bidID)
+		db.Exec("DELETE FROM employee WHERE fio = $1", fio)
+	})
+	if _, err := db.Exec(`
+        INSERT INTO employee_experience_bid (employee_id, started_on, ended_on, specialty)
+        VALUES ($1, CURRENT_DATE - interval '2 years', NULL, true)
+    `, bidID); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/api/accept-application/:id", func(c *gin.Context) {
+		c.Set("userClaims", jwt.MapClaims{"user_id": "0"})
+		c.Set("userRole", "admin")
+		acceptRequest(c)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/accept-application/%d?override=true", bidID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("accept: %d %s", w.Code, w.Body)
+	}
+
+	// Открытый период заявки закрывается датой приёма, иначе стаж после приёма учитывался бы дважды
+	var open int
+	var ended, hired sql.NullTime
+	err = db.QueryRow(`
+        SELECT COUNT(*) FILTER (WHERE x.ended_on IS NULL), MAX(x.ended_on), e.hire_date
+        FROM employee e JOIN employee_experience x ON x.employee_id = e.id
+        WHERE e.fio = $1 GROUP BY e.hire_date
+    `, fio).Scan(&open, &ended, &hired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open != 0 || !ended.Valid || !ended.Time.Equal(hired.Time) {
+		t.Errorf("open periods = %d, ended_on = %v, hire_date = %v", open, ended, hired)
+	}
+}
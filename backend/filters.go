@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// queryBuilder собирает WHERE-условия и нумерует плейсхолдеры по порядку добавления аргументов.
+type queryBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+func (qb *queryBuilder) arg(v interface{}) string {
+	qb.args = append(qb.args, v)
+	return "$" + strconv.Itoa(len(qb.args))
+}
+
+// where добавляет условие, в котором каждый %s заменяется плейсхолдером очередного значения.
+func (qb *queryBuilder) where(cond string, vals ...interface{}) {
+	ph := make([]interface{}, len(vals))
+	for i, v := range vals {
+		ph[i] = qb.arg(v)
+	}
+	qb.conds = append(qb.conds, fmt.Sprintf(cond, ph...))
+}
+
+func (qb *queryBuilder) whereSQL() string {
+	if len(qb.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(qb.conds, " AND ")
+}
+
+// rangeFilter добавляет точное совпадение по param и границы param_min / param_max.
+func (qb *queryBuilder) rangeFilter(c *gin.Context, column, param string) error {
+	if v := c.Query(param); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s", param)
+		}
+		qb.where(column+" = %s", n)
+	}
+	if v := c.Query(param + "_min"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s_min", param)
+		}
+		qb.where(column+" >= %s", n)
+	}
+	if v := c.Query(param + "_max"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s_max", param)
+		}
+		qb.where(column+" <= %s", n)
+	}
+	return nil
+}
+
+// inFilter принимает как повторяющиеся параметры (?id=1&id=2), так и список через запятую (?id=1,2).
+func (qb *queryBuilder) inFilter(c *gin.Context, column, param string) error {
+	ids, err := queryIntList(c, param)
+	if err != nil {
+		return err
+	}
+	switch len(ids) {
+	case 0:
+	case 1:
+		qb.where(column+" = %s", ids[0])
+	default:
+		qb.where(column+" = ANY(%s)", pq.Array(ids))
+	}
+	return nil
+}
+
+// subdivisionSubtreeSQL — подзапрос с id подразделений из массива-плейсхолдера %s и всех вложенных в них.
+const subdivisionSubtreeSQL = `(
+        WITH RECURSIVE subtree AS (
+            SELECT id FROM subdivision WHERE id = ANY(%s)
+            UNION
+            SELECT s.id FROM subdivision s JOIN subtree t ON s.parent_id = t.id
+        )
+        SELECT id FROM subtree
+    )`
+
+// subdivisionFilter — inFilter по подразделению; с ?include_descendants=true подходят и вложенные подразделения.
+func (qb *queryBuilder) subdivisionFilter(c *gin.Context, column, param string) error {
+	if c.Query("include_descendants") != "true" {
+		return qb.inFilter(c, column, param)
+	}
+	ids, err := queryIntList(c, param)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		qb.where(column+" IN "+subdivisionSubtreeSQL, pq.Array(ids))
+	}
+	return nil
+}
+
+func queryIntList(c *gin.Context, param string) ([]int64, error) {
+	var ids []int64
+	for _, raw := range c.QueryArray(param) {
+		for _, part := range strings.Split(raw, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", param)
+			}
+			ids = append(ids, n)
+		}
+	}
+	return ids, nil
+}
+
+type sortKey struct {
+	Column string
+	Desc   bool
+}
+
+// parseSort разбирает ?sort=fio,-age; допускаются только колонки из allowed.
+// Для стабильного порядка в конец всегда добавляется id.
+func parseSort(raw string, allowed map[string]string) ([]sortKey, error) {
+	var keys []sortKey
+	hasID := false
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		desc := strings.HasPrefix(part, "-")
+		name := strings.TrimPrefix(part, "-")
+		column, ok := allowed[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort field %q", name)
+		}
+		if name == "id" {
+			hasID = true
+		}
+		keys = append(keys, sortKey{Column: column, Desc: desc})
+	}
+	if !hasID {
+		keys = append(keys, sortKey{Column: allowed["id"]})
+	}
+	return keys, nil
+}
+
+// orderSQL сортирует NULL в конец в обоих направлениях — на этом строится afterCursor.
+func orderSQL(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		if k.Desc {
+			parts[i] = k.Column + " DESC NULLS LAST"
+		} else {
+			parts[i] = k.Column + " ASC NULLS LAST"
+		}
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// pageCursor хранит значения ключей сортировки последней строки страницы.
+type pageCursor struct {
+	Values []interface{} `json:"v"`
+}
+
+func encodeCursor(values []interface{}) string {
+	b, _ := json.Marshal(pageCursor{Values: values})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(raw string, keys []sortKey) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cur pageCursor
+	if err := json.Unmarshal(b, &cur); err != nil || len(cur.Values) != len(keys) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return cur.Values, nil
+}
+
+// afterCursor строит keyset-условие "строка идёт после курсора" для произвольного набора ключей:
+// (a > x) OR (a = x AND b > y) OR ...
+// Ключи могут быть NULL (даты рождения и приёма, возраст); такие строки идут последними,
+// поэтому после непустого x идут и строки с a IS NULL, а после NULL строго больших значений нет.
+func (qb *queryBuilder) afterCursor(keys []sortKey, values []interface{}) {
+	var ors []string
+	for i := range keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				ands = append(ands, keys[j].Column+" IS NULL")
+			} else {
+				ands = append(ands, keys[j].Column+" = "+qb.arg(values[j]))
+			}
+		}
+		if values[i] == nil {
+			continue
+		}
+		op := ">"
+		if keys[i].Desc {
+			op = "<"
+		}
+		ands = append(ands, "("+keys[i].Column+" "+op+" "+qb.arg(values[i])+" OR "+keys[i].Column+" IS NULL)")
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	if len(ors) == 0 {
+		ors = append(ors, "FALSE")
+	}
+	qb.conds = append(qb.conds, "("+strings.Join(ors, " OR ")+")")
+}
+
+type pagination struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+func parsePagination(c *gin.Context) (pagination, error) {
+	p := pagination{Limit: defaultPageLimit, Cursor: c.Query("cursor")}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid limit")
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		p.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid offset")
+		}
+		p.Offset = n
+	}
+	if p.Cursor != "" && p.Offset != 0 {
+		return p, fmt.Errorf("cursor and offset cannot be combined")
+	}
+	return p, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryBuilderPlaceholders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/employees/get?age_min=20&age_max=40&job_title_id=1,2&job_title_id=3", nil)
+
+	qb := &queryBuilder{}
+	qb.where("fio ILIKE %s", "%Иван%")
+	if err := qb.rangeFilter(c, "age", "age"); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.inFilter(c, "job_title_id", "job_title_id"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := " WHERE fio ILIKE $1 AND age >= $2 AND age <= $3 AND job_title_id = ANY($4)"
+	if got := qb.whereSQL(); got != expected {
+		t.Errorf("unexpected where clause: got %q want %q", got, expected)
+	}
+	if len(qb.args) != 4 {
+		t.Errorf("expected 4 args, got %d", len(qb.args))
+	}
+}
+
+func TestParseSortAndCursor(t *testing.T) {
+	keys, err := parseSort("-age,fio", employeeSortColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := orderSQL(keys); got != " ORDER BY age DESC NULLS LAST, fio ASC NULLS LAST, id ASC NULLS LAST" {
+		t.Errorf("unexpected order: %q", got)
+	}
+
+	if _, err := parseSort("password", employeeSortColumns); err == nil {
+		t.Error("expected error for unknown sort field")
+	}
+
+	values, err := decodeCursor(encodeCursor([]interface{}{30, "Иванов", 7}), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb := &queryBuilder{}
+	qb.afterCursor(keys, values)
+	expected := " WHERE (((age < $1 OR age IS NULL)) OR (age = $2 AND (fio > $3 OR fio IS NULL)) OR (age = $4 AND fio = $5 AND (id > $6 OR id IS NULL)))"
+	if got := qb.whereSQL(); got != expected {
+		t.Errorf("unexpected cursor clause: got %q want %q", got, expected)
+	}
+}
+
+func TestCursorOverNulls(t *testing.T) {
+	keys, err := parseSort("birth_date", employeeSortColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Последняя строка страницы без даты: дальше только строки без даты с большим id
+	qb := &queryBuilder{}
+	qb.afterCursor(keys, []interface{}{nil, 7})
+	expected := " WHERE ((birth_date IS NULL AND (id > $1 OR id IS NULL)))"
+	if got := qb.whereSQL(); got != expected || len(qb.args) != 1 {
+		t.Errorf("unexpected cursor clause: got %q want %q", got, expected)
+	}
+
+	// С датой: более поздние даты, затем все строки без даты
+	qb = &queryBuilder{}
+	qb.afterCursor(keys, []interface{}{"1990-01-01", 7})
+	expected = " WHERE (((birth_date > $1 OR birth_date IS NULL)) OR (birth_date = $2 AND (id > $3 OR id IS NULL)))"
+	if got := qb.whereSQL(); got != expected {
+		t.Errorf("unexpected cursor clause: got %q want %q", got, expected)
+	}
+}
+
+func TestSubdivisionFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/employees/get?subdivision_id=3", nil)
+
+	qb := &queryBuilder{}
+	if err := qb.subdivisionFilter(c, "subdivision_id", "subdivision_id"); err != nil {
+		t.Fatal(err)
+	}
+	if got := qb.whereSQL(); got != " WHERE subdivision_id = $1" {
+		t.Errorf("unexpected where clause without descendants: %q", got)
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/employees/get?subdivision_id=3,4&include_descendants=true", nil)
+	qb = &queryBuilder{}
+	if err := qb.subdivisionFilter(c, "subdivision_id", "subdivision_id"); err != nil {
+		t.Fatal(err)
+	}
+	got := qb.whereSQL()
+	if !strings.HasPrefix(got, " WHERE subdivision_id IN (") || !strings.Contains(got, "id = ANY($1)") || len(qb.args) != 1 {
+		t.Errorf("unexpected where clause with descendants: %q", got)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HeadcountSlot struct {
+	SubdivisionID int    `json:"subdivision_id"`
+	Subdivision   string `json:"subdivision"`
+	Authorized    *int   `json:"authorized"`
+	Filled        int    `json:"filled"`
+	Open          *int   `json:"open"`
+}
+
+type JobTitleHeadcount struct {
+	JobTitleID   int             `json:"job_title_id"`
+	JobTitle     string          `json:"job_title"`
+	Authorized   *int            `json:"authorized"`
+	Filled       int             `json:"filled"`
+	Open         *int            `json:"open"`
+	Subdivisions []HeadcountSlot `json:"subdivisions"`
+}
+
+// headcountError описывает, какой из лимитов не даёт принять ещё одного сотрудника.
+type headcountError struct {
+	Scope      string
+	Authorized int
+	Filled     int
+}
+
+func (e *headcountError) Error() string {
+	return fmt.Sprintf("headcount for %s is full: %d of %d positions filled", e.Scope, e.Filled, e.Authorized)
+}
+
+// response — тело ответа 409 с подробностями о заполненном лимите.
+func (e *headcountError) response() gin.H {
+	return gin.H{
+		"error":      e.Error(),
+		"scope":      e.Scope,
+		"authorized": e.Authorized,
+		"filled":     e.Filled,
+	}
+}
+
+func openPositions(authorized *int, filled int) *int {
+	if authorized == nil {
+		return nil
+	}
+	open := *authorized - filled
+	if open < 0 {
+		open = 0
+	}
+	return &open
+}
+
+// checkHeadcount блокирует строку должности до конца транзакции, чтобы параллельные приёмы
+// на одну должность проверялись последовательно, и возвращает *headcountError, если мест нет.
+// employeeID — переводимый сотрудник, его текущее место не считается занятым (0 при приёме).
+func checkHeadcount(tx *sql.Tx, jobTitleID, subdivisionID, employeeID int) error {
+	var authorized sql.NullInt64
+	err := tx.QueryRow("SELECT count FROM job_title WHERE id = $1 FOR UPDATE", jobTitleID).Scan(&authorized)
+	if err != nil {
+		return err
+	}
+	if authorized.Valid {
+		var filled int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM employee WHERE job_title_id = $1 AND id <> $2", jobTitleID, employeeID).Scan(&filled); err != nil {
+			return err
+		}
+		if filled >= int(authorized.Int64) {
+			return &headcountError{Scope: "job title", Authorized: int(authorized.Int64), Filled: filled}
+		}
+	}
+
+	var positions int
+	err = tx.QueryRow(`
+        SELECT positions FROM headcount_quota WHERE job_title_id = $1 AND subdivision_id = $2
+    `, jobTitleID, subdivisionID).Scan(&positions)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var filled int
+	err = tx.QueryRow(`
+        SELECT COUNT(*) FROM employee WHERE job_title_id = $1 AND subdivision_id = $2 AND id <> $3
+    `, jobTitleID, subdivisionID, employeeID).Scan(&filled)
+	if err != nil {
+		return err
+	}
+	if filled >= positions {
+		return &headcountError{Scope: "subdivision", Authorized: positions, Filled: filled}
+	}
+	return nil
+}
+
+func GetVacancies(c *gin.Context) {
+	qb := &queryBuilder{}
+	if err := qb.inFilter(c, "jt.id", "job_title_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT jt.id, jt.name, jt.count, COUNT(e.id)
+        FROM job_title jt
+        LEFT JOIN employee e ON e.job_title_id = jt.id`+qb.whereSQL()+`
+        GROUP BY jt.id, jt.name, jt.count
+        ORDER BY jt.name
+    `, qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	result := []*JobTitleHeadcount{}
+	byID := map[int]*JobTitleHeadcount{}
+	for rows.Next() {
+		var h JobTitleHeadcount
+		var authorized sql.NullInt64
+		if err := rows.Scan(&h.JobTitleID, &h.JobTitle, &authorized, &h.Filled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan job titles"})
+			return
+		}
+		if authorized.Valid {
+			n := int(authorized.Int64)
+			h.Authorized = &n
+		}
+		h.Open = openPositions(h.Authorized, h.Filled)
+		h.Subdivisions = []HeadcountSlot{}
+		result = append(result, &h)
+		byID[h.JobTitleID] = &h
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Разбивка по подразделениям: все пары, где есть квота или хотя бы один сотрудник
+	slotRows, err := db.Query(`
+        SELECT p.job_title_id, p.subdivision_id, sd.name, q.positions,
+            (SELECT COUNT(*) FROM employee e WHERE e.job_title_id = p.job_title_id AND e.subdivision_id = p.subdivision_id)
+        FROM (
+            SELECT job_title_id, subdivision_id FROM headcount_quota
+            UNION
+            SELECT DISTINCT job_title_id, subdivision_id FROM employee
+        ) p
+        JOIN subdivision sd ON sd.id = p.subdivision_id
+        LEFT JOIN headcount_quota q ON q.job_title_id = p.job_title_id AND q.subdivision_id = p.subdivision_id
+        ORDER BY sd.name
+    `)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer slotRows.Close()
+
+	for slotRows.Next() {
+		var jobTitleID int
+		var slot HeadcountSlot
+		var positions sql.NullInt64
+		if err := slotRows.Scan(&jobTitleID, &slot.SubdivisionID, &slot.Subdivision, &positions, &slot.Filled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan headcount"})
+			return
+		}
+		h, ok := byID[jobTitleID]
+		if !ok {
+			continue
+		}
+		if positions.Valid {
+			n := int(positions.Int64)
+			slot.Authorized = &n
+		}
+		slot.Open = openPositions(slot.Authorized, slot.Filled)
+		h.Subdivisions = append(h.Subdivisions, slot)
+	}
+	if err := slotRows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if c.Query("open_only") == "true" {
+		filtered := []*JobTitleHeadcount{}
+		for _, h := range result {
+			if h.Open == nil || *h.Open > 0 {
+				filtered = append(filtered, h)
+			}
+		}
+		result = filtered
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// setHeadcount задаёт штатную численность должности и квоты по подразделениям.
+// count: null снимает ограничение, отсутствие поля оставляет численность как есть.
+func setHeadcount(c *gin.Context) {
+	jobTitleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job title ID"})
+		return
+	}
+
+	var req struct {
+		Count        json.RawMessage `json:"count"`
+		Subdivisions []struct {
+			SubdivisionID int  `json:"subdivision_id" binding:"required,min=1"`
+			Positions     *int `json:"positions" binding:"omitempty,min=0"`
+		} `json:"subdivisions" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setCount := len(req.Count) > 0
+	var count *int
+	if setCount {
+		if err := json.Unmarshal(req.Count, &count); err != nil || (count != nil && *count < 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count must be a non-negative integer or null"})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE job_title SET count = CASE WHEN $1 THEN $2::int ELSE count END WHERE id = $3", setCount, count, jobTitleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job title not found"})
+		return
+	}
+
+	// positions: null снимает ограничение для подразделения
+	for _, s := range req.Subdivisions {
+		if s.Positions == nil {
+			_, err = tx.Exec("DELETE FROM headcount_quota WHERE job_title_id = $1 AND subdivision_id = $2", jobTitleID, s.SubdivisionID)
+		} else {
+			_, err = tx.Exec(`
+                INSERT INTO headcount_quota (job_title_id, subdivision_id, positions)
+                VALUES ($1, $2, $3)
+                ON CONFLICT (job_title_id, subdivision_id) DO UPDATE SET positions = EXCLUDED.positions
+            `, jobTitleID, s.SubdivisionID, *s.Positions)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update headcount_quota"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Headcount updated successfully"})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenPositions(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	tests := []struct {
+		authorized *int
+		filled     int
+		want       *int
+	}{
+		{nil, 3, nil},
+		{intp(5), 3, intp(2)},
+		{intp(3), 3, intp(0)},
+		{intp(2), 4, intp(0)}, // переукомплектовано после уменьшения штата
+	}
+	for _, tt := range tests {
+		got := openPositions(tt.authorized, tt.filled)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("openPositions(%v, %d) = %v, ожидалось %v", tt.authorized, tt.filled, got, tt.want)
+		}
+	}
+}
+
+func TestHeadcountErrorResponse(t *testing.T) {
+	e := &headcountError{Scope: "subdivision", Authorized: 2, Filled: 2}
+	r := e.response()
+	if r["scope"] != "subdivision" || r["authorized"] != 2 || r["filled"] != 2 {
+		t.Errorf("неожиданное тело ответа: %v", r)
+	}
+	if r["error"] != "headcount for subdivision is full: 2 of 2 positions filled" {
+		t.Errorf("неожиданный текст ошибки: %v", r["error"])
+	}
+}
+
+func TestCheckHeadcount(t *testing.T) {
+	openTestDB(t)
+	two := 2
+	job, subA, subB := testPosition(t, &two)
+	first := testEmployee(t, job, subA)
+
+	if _, err := db.Exec("INSERT INTO headcount_quota (job_title_id, subdivision_id, positions) VALUES ($1, $2, 1)", job, subA); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(sub, employeeID int) error {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		return checkHeadcount(tx, job, sub, employeeID)
+	}
+
+	// Квота подразделения A (1) занята, по организации место ещё есть
+	err := check(subA, 0)
+	if hc, ok := err.(*headcountError); !ok || hc.Scope != "subdivision" || hc.Authorized != 1 || hc.Filled != 1 {
+		t.Errorf("приём в подразделение A: ожидался лимит подразделения, получено %v", err)
+	}
+	if err := check(subB, 0); err != nil {
+		t.Errorf("приём в подразделение B без квоты: %v", err)
+	}
+	// Сам сотрудник, занимающий квоту, её не расходует
+	if err := check(subA, first); err != nil {
+		t.Errorf("проверка для занимающего место сотрудника: %v", err)
+	}
+
+	testEmployee(t, job, subB)
+	err = check(subB, 0)
+	if hc, ok := err.(*headcountError); !ok || hc.Scope != "job title" || hc.Authorized != 2 || hc.Filled != 2 {
+		t.Errorf("приём сверх штата должности: ожидался лимит должности, получено %v", err)
+	}
+	if err := check(subB, first); err != nil {
+		t.Errorf("перевод внутри штата должности: %v", err)
+	}
+
+	// Без штатной численности ограничивает только квота
+	if _, err := db.Exec("UPDATE job_title SET count = NULL WHERE id = $1", job); err != nil {
+		t.Fatal(err)
+	}
+	if err := check(subB, 0); err != nil {
+		t.Errorf("должность без ограничения: %v", err)
+	}
+}
+
+func TestSetHeadcountCount(t *testing.T) {
+	openTestDB(t)
+	five := 5
+	job, _, _ := testPosition(t, &five)
+
+	r := gin.New()
+	r.PUT("/api/job-titles/:id/headcount", setHeadcount)
+	steps := []struct {
+		body   string
+		status int
+		want   sql.NullInt64
+	}{
+		{`{}`, http.StatusOK, sql.NullInt64{Int64: 5, Valid: true}},
+		{`{"count": 3}`, http.StatusOK, sql.NullInt64{Int64: 3, Valid: true}},
+		{`{"count": -1}`, http.StatusBadRequest, sql.NullInt64{Int64: 3, Valid: true}},
+		{`{"count": null}`, http.StatusOK, sql.NullInt64{}},
+	}
+	for _, s := range steps {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/job-titles/%d/headcount", job), strings.NewReader(s.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != s.status {
+			t.Fatalf("%s: статус %d, ожидался %d: %s", s.body, w.Code, s.status, w.Body)
+		}
+		var got sql.NullInt64
+		if err := db.QueryRow("SELECT count FROM job_title WHERE id = $1", job).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != s.want {
+			t.Errorf("%s: count = %v, ожидалось %v", s.body, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const icsTimeLayout = "20060102T150405Z"
+
+type calendarEvent struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+	Cancelled   bool
+}
+
+// icsEscape экранирует текстовое значение по RFC 5545 (3.3.11).
+func icsEscape(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsFold переносит строку длиннее 75 октетов, не разрывая многобайтовые символы.
+func icsFold(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line + "\r\n"
+	}
+	var b strings.Builder
+	width := limit
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Продолжение начинается с пробела, который тоже занимает октет
+		width = limit - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// buildCalendar собирает VCALENDAR для подписки из календарного клиента.
+func buildCalendar(name string, events []calendarEvent, stamp time.Time) string {
+	var b strings.Builder
+	write := func(line string) { b.WriteString(icsFold(line)) }
+
+	write("BEGIN:VCALENDAR")
+	write("VERSION:2.0")
+	write("PRODID:-//HR//Interviews//RU")
+	write("CALSCALE:GREGORIAN")
+	write("METHOD:PUBLISH")
+	write("X-WR-CALNAME:" + icsEscape(name))
+	for _, e := range events {
+		write("BEGIN:VEVENT")
+		write("UID:" + e.UID)
+		write("SEQUENCE:" + strconv.Itoa(e.Sequence))
+		write("DTSTAMP:" + stamp.UTC().Format(icsTimeLayout))
+		write("DTSTART:" + e.Start.UTC().Format(icsTimeLayout))
+		write("DTEND:" + e.End.UTC().Format(icsTimeLayout))
+		write("SUMMARY:" + icsEscape(e.Summary))
+		if e.Location != "" {
+			write("LOCATION:" + icsEscape(e.Location))
+			// URL — не текстовое значение и не экранируется, поэтому переводы строк просто убираются
+			if strings.HasPrefix(e.Location, "http://") || strings.HasPrefix(e.Location, "https://") {
+				write("URL:" + strings.NewReplacer("\r", "", "\n", "").Replace(e.Location))
+			}
+		}
+		if e.Description != "" {
+			write("DESCRIPTION:" + icsEscape(e.Description))
+		}
+		if e.Cancelled {
+			write("STATUS:CANCELLED")
+		} else {
+			write("STATUS:CONFIRMED")
+		}
+		write("END:VEVENT")
+	}
+	write("END:VCALENDAR")
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestIcsEscape(t *testing.T) {
+	got := icsEscape("Комната 1, этаж 2; корпус\\Б\r\nвход со двора")
+	expected := `Комната 1\, этаж 2\; корпус\\Б\nвход со двора`
+	if got != expected {
+		t.Errorf("unexpected escape: got %q want %q", got, expected)
+	}
+}
+
+func TestIcsFold(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("Собеседование ", 10)
+	folded := icsFold(line)
+	if !strings.HasSuffix(folded, "\r\n") {
+		t.Fatal("folded line must end with CRLF")
+	}
+	parts := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+	if len(parts) < 2 {
+		t.Fatalf("expected line to be folded: %q", folded)
+	}
+	var joined strings.Builder
+	for i, p := range parts {
+		if len(p) > 75 {
+			t.Errorf("part %d is %d octets long", i, len(p))
+		}
+		if !utf8.ValidString(p) {
+			t.Errorf("part %d splits a multibyte character: %q", i, p)
+		}
+		if i > 0 {
+			if !strings.HasPrefix(p, " ") {
+				t.Errorf("continuation %d must start with a space", i)
+			}
+			p = p[1:]
+		}
+		joined.WriteString(p)
+	}
+	if joined.String() != line {
+		t.Errorf("unfolded line differs: %q", joined.String())
+	}
+}
+
+func TestBuildCalendar(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	events := []calendarEvent{
+		{UID: "interview-1@hr", Start: start, End: start.Add(time.Hour), Summary: "Собеседование", Location: "https://meet.example.com/abc"},
+		{UID: "interview-2@hr", Sequence: 2, Start: start, End: start.Add(time.Hour), Summary: "Собеседование", Cancelled: true},
+	}
+	cal := buildCalendar("Собеседования", events, start)
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20260302T070000Z\r\n",
+		"DTEND:20260302T080000Z\r\n",
+		"URL:https://meet.example.com/abc\r\n",
+		"SEQUENCE:2\r\nDTSTAMP:",
+		"STATUS:CANCELLED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(cal, expected) {
+			t.Errorf("calendar does not contain %q:\n%s", expected, cal)
+		}
+	}
+	if strings.Count(cal, "BEGIN:VEVENT") != 2 {
+		t.Errorf("expected two events:\n%s", cal)
+	}
+}
+
+func TestBuildCalendarURLInjection(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	events := []calendarEvent{{
+		UID: "interview-1@hr", Start: start, End: start.Add(time.Hour), Summary: "Собеседование",
+		Location: "https://meet.example.com/abc\r\nATTACH:https://evil.example.com/x",
+	}}
+	cal := buildCalendar("Собеседования", events, start)
+	if strings.Contains(cal, "\r\nATTACH:") {
+		t.Errorf("location injected a property:\n%s", cal)
+	}
+	if !strings.Contains(cal, "URL:https://meet.example.com/abcATTACH:https://evil.example.com/x\r\n") {
+		t.Errorf("unexpected URL line:\n%s", cal)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func idempotencyTTL() time.Duration {
+	return envDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+}
+
+// captureWriter копирует тело ответа, чтобы его можно было сохранить для повторов.
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware обрабатывает заголовок Idempotency-Key: первый запрос с ключом выполняется
+// и его ответ сохраняется на IDEMPOTENCY_TTL, повторы с тем же телом получают сохранённый ответ.
+// Ключ действует в пределах пути запроса и пользователя; без заголовка запрос проходит как обычно.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.ContentType()+"\n"), body...))
+		requestHash := hex.EncodeToString(sum[:])
+
+		scope := c.Request.Method + " " + c.Request.URL.Path
+		if claims, ok := c.Get("userClaims"); ok {
+			if userID, ok := claims.(jwt.MapClaims)["user_id"].(string); ok {
+				scope += " " + userID
+			}
+		}
+
+		// Истёкший ключ перезахватывается тем же запросом, что и новый
+		var owned bool
+		err = db.QueryRow(`
+            INSERT INTO idempotency_key (scope, key, request_hash)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (scope, key) DO UPDATE SET
+                request_hash = EXCLUDED.request_hash, status = NULL, content_type = NULL,
+                response = NULL, created_at = NOW()
+            WHERE idempotency_key.created_at < NOW() - make_interval(secs => $4)
+            RETURNING true
+        `, scope, key, requestHash, idempotencyTTL().Seconds()).Scan(&owned)
+		if err == sql.ErrNoRows {
+			replayIdempotent(c, scope, key, requestHash)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка сохранения Idempotency-Key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// Ошибки сервера не запоминаем, чтобы клиент мог повторить запрос
+		status := w.Status()
+		if status >= 500 {
+			_, err = db.Exec("DELETE FROM idempotency_key WHERE scope = $1 AND key = $2", scope, key)
+		} else {
+			_, err = db.Exec(`
+                UPDATE idempotency_key SET status = $3, content_type = $4, response = $5
+                WHERE scope = $1 AND key = $2
+            `, scope, key, status, w.Header().Get("Content-Type"), w.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("Ошибка сохранения ответа для Idempotency-Key: %v", err)
+		}
+	}
+}
+
+func replayIdempotent(c *gin.Context, scope, key, requestHash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var contentType sql.NullString
+	var response []byte
+	err := db.QueryRow(`
+        SELECT request_hash, status, content_type, response FROM idempotency_key
+        WHERE scope = $1 AND key = $2
+    `, scope, key).Scan(&storedHash, &status, &contentType, &response)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	switch {
+	case storedHash != requestHash:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+	case !status.Valid:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(int(status.Int64), contentType.String, response)
+		c.Abort()
+	}
+}
+
+// purgeIdempotencyKeys удаляет ключи старше срока хранения.
+func purgeIdempotencyKeys() (int64, error) {
+	result, err := db.Exec("DELETE FROM idempotency_key WHERE created_at < NOW() - make_interval(secs => $1)", idempotencyTTL().Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentRouter — маршрут за IdempotencyMiddleware, считающий реальные вызовы обработчика.
+// Статус ответа обработчика задаётся параметром status.
+func idempotentRouter(calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/things", IdempotencyMiddleware(), func(c *gin.Context) {
+		*calls++
+		status := http.StatusCreated
+		if c.Query("status") != "" {
+			fmt.Sscan(c.Query("status"), &status)
+		}
+		c.JSON(status, gin.H{"call": *calls})
+	})
+	return r
+}
+
+func postIdempotent(r *gin.Engine, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	var calls int
+	w := postIdempotent(idempotentRouter(&calls), "/things", strings.Repeat("k", 256), "{}")
+	if w.Code != http.StatusBadRequest || calls != 0 {
+		t.Errorf("ожидался 400 без вызова обработчика, получено %d (вызовов %d)", w.Code, calls)
+	}
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	openTestDB(t)
+	prefix := fmt.Sprint("test-", time.Now().UnixNano(), "-")
+	t.Cleanup(func() { db.Exec("DELETE FROM idempotency_key WHERE key LIKE $1", prefix+"%") })
+
+	t.Run("replay", func(t *testing.T) {
+		var calls int
+		r := idempotentRouter(&calls)
+		first := postIdempotent(r, "/things", prefix+"replay", `{"a":1}`)
+		second := postIdempotent(r, "/things", prefix+"replay", `{"a":1}`)
+		if calls != 1 {
+			t.Fatalf("обработчик вызван %d раз, ожидался один", calls)
+		}
+		if second.Code != first.Code || second.Body.String() != first.Body.String() {
+			t.Errorf("повтор вернул %d %s вместо %d %s", second.Code, second.Body, first.Code, first.Body)
+		}
+		if second.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("у повтора нет заголовка Idempotent-Replayed")
+		}
+		if ct := second.Header().Get("Content-Type"); ct != first.Header().Get("Content-Type") {
+			t.Errorf("повтор вернул Content-Type %q", ct)
+		}
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		var calls int
+		r := idempotentRouter(&calls)
+		postIdempotent(r, "/things", prefix+"mismatch", `{"a":1}`)
+		w := postIdempotent(r, "/things", prefix+"mismatch", `{"a":2}`)
+		if w.Code != http.StatusUnprocessableEntity || calls != 1 {
+			t.Errorf("другое тело с тем же ключом: ожидался 422, получено %d (вызовов %d)", w.Code, calls)
+		}
+	})
+
+	t.Run("server error releases key", func(t *testing.T) {
+		var calls int
+		r := idempotentRouter(&calls)
+		if w := postIdempotent(r, "/things?status=503", prefix+"retry", "{}"); w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("ожидался 503, получено %d", w.Code)
+		}
+		w := postIdempotent(r, "/things?status=503", prefix+"retry", "{}")
+		if calls != 2 || w.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("после 5xx запрос должен выполниться заново, вызовов %d", calls)
+		}
+
+		// Ответы 4xx, напротив, запоминаются
+		postIdempotent(r, "/things?status=400", prefix+"client", "{}")
+		w = postIdempotent(r, "/things?status=400", prefix+"client", "{}")
+		if calls != 3 || w.Code != http.StatusBadRequest || w.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("ответ 4xx не воспроизведён: %d, вызовов %d", w.Code, calls)
+		}
+	})
+
+	t.Run("scope is per path", func(t *testing.T) {
+		var calls int
+		r := idempotentRouter(&calls)
+		r.POST("/other", IdempotencyMiddleware(), func(c *gin.Context) {
+			calls++
+			c.Status(http.StatusNoContent)
+		})
+		postIdempotent(r, "/things", prefix+"scope", "{}")
+		if w := postIdempotent(r, "/other", prefix+"scope", "{}"); w.Code != http.StatusNoContent || calls != 2 {
+			t.Errorf("тот же ключ на другом пути: получено %d, вызовов %d", w.Code, calls)
+		}
+	})
+}
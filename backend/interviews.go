@@ -0,0 +1,545 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+type Interviewer struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type InterviewFeedback struct {
+	UserID         string    `json:"user_id"`
+	Username       string    `json:"username"`
+	Rating         int       `json:"rating"`
+	Recommendation string    `json:"recommendation"`
+	Notes          string    `json:"notes"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Interview struct {
+	ID              int                 `json:"id"`
+	BidID           int                 `json:"bid_id"`
+	EmployeeID      *int                `json:"employee_id"`
+	CandidateName   string              `json:"candidate_name"`
+	StartsAt        time.Time           `json:"starts_at"`
+	EndsAt          time.Time           `json:"ends_at"`
+	DurationMinutes int                 `json:"duration_minutes"`
+	Location        string              `json:"location"`
+	Status          string              `json:"status"`
+	Sequence        int                 `json:"-"`
+	Interviewers    []Interviewer       `json:"interviewers"`
+	Feedback        []InterviewFeedback `json:"feedback"`
+}
+
+type interviewConflict struct {
+	UserID        string    `json:"user_id"`
+	Username      string    `json:"username"`
+	InterviewID   int       `json:"interview_id"`
+	CandidateName string    `json:"candidate_name"`
+	StartsAt      time.Time `json:"starts_at"`
+	EndsAt        time.Time `json:"ends_at"`
+}
+
+type interviewRequest struct {
+	StartsAt        time.Time `json:"starts_at" binding:"required"`
+	DurationMinutes int       `json:"duration_minutes" binding:"required,min=1,max=1440"`
+	Location        string    `json:"location"`
+	InterviewerIDs  []string  `json:"interviewer_ids" binding:"required,min=1"`
+}
+
+func (r interviewRequest) endsAt() time.Time {
+	return r.StartsAt.Add(time.Duration(r.DurationMinutes) * time.Minute)
+}
+
+const interviewSelectSQL = `
+    SELECT i.id, i.bid_id, i.employee_id, i.candidate_name, i.starts_at, i.duration_minutes,
+        i.location, i.status, i.sequence,
+        COALESCE((
+            SELECT json_agg(json_build_object('user_id', ii.user_id, 'username', COALESCE(u.username, '')) ORDER BY u.username)
+            FROM interview_interviewer ii
+            LEFT JOIN users u ON u.id::text = ii.user_id
+            WHERE ii.interview_id = i.id
+        ), '[]'),
+        COALESCE((
+            SELECT json_agg(json_build_object(
+                'user_id', f.user_id, 'username', COALESCE(u.username, ''), 'rating', f.rating,
+                'recommendation', f.recommendation, 'notes', f.notes, 'updated_at', f.updated_at
+            ) ORDER BY f.updated_at)
+            FROM interview_feedback f
+            LEFT JOIN users u ON u.id::text = f.user_id
+            WHERE f.interview_id = i.id
+        ), '[]')
+    FROM interview i`
+
+func loadInterviews(where string, args ...interface{}) ([]Interview, error) {
+	rows, err := db.Query(interviewSelectSQL+" WHERE "+where+" ORDER BY i.starts_at, i.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	interviews := []Interview{}
+	for rows.Next() {
+		var iv Interview
+		var interviewers, feedback string
+		if err := rows.Scan(&iv.ID, &iv.BidID, &iv.EmployeeID, &iv.CandidateName, &iv.StartsAt, &iv.DurationMinutes,
+			&iv.Location, &iv.Status, &iv.Sequence, &interviewers, &feedback); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(interviewers), &iv.Interviewers); err != nil {
+			return nil, fmt.Errorf("failed to parse interviewers: %w", err)
+		}
+		if err := json.Unmarshal([]byte(feedback), &iv.Feedback); err != nil {
+			return nil, fmt.Errorf("failed to parse feedback: %w", err)
+		}
+		iv.EndsAt = iv.StartsAt.Add(time.Duration(iv.DurationMinutes) * time.Minute)
+		interviews = append(interviews, iv)
+	}
+	return interviews, rows.Err()
+}
+
+// prepareInterviewers проверяет, что все интервьюеры — сотрудники, и блокирует их расписание
+// до конца транзакции, чтобы параллельные назначения не создали пересечение.
+func prepareInterviewers(tx *sql.Tx, ids []string) ([]string, error) {
+	seen := map[string]bool{}
+	var unique []string
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	sort.Strings(unique)
+
+	var staff int
+	err := tx.QueryRow(`
+        SELECT COUNT(*) FROM users WHERE id::text = ANY($1) AND role IN ('employee', 'admin')
+    `, pq.Array(unique)).Scan(&staff)
+	if err != nil {
+		return nil, err
+	}
+	if staff != len(unique) {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(`
+        SELECT pg_advisory_xact_lock(hashtext('interviewer:' || id))
+        FROM unnest($1::text[]) AS id ORDER BY id
+    `, pq.Array(unique))
+	return unique, err
+}
+
+// findInterviewConflicts ищет назначенные собеседования интервьюеров, пересекающиеся с [start, end).
+func findInterviewConflicts(tx *sql.Tx, interviewers []string, start, end time.Time, excludeID int) ([]interviewConflict, error) {
+	rows, err := tx.Query(`
+        SELECT ii.user_id, COALESCE(u.username, ''), i.id, i.candidate_name,
+            i.starts_at, i.starts_at + make_interval(mins => i.duration_minutes)
+        FROM interview i
+        JOIN interview_interviewer ii ON ii.interview_id = i.id
+        LEFT JOIN users u ON u.id::text = ii.user_id
+        WHERE i.status = 'scheduled' AND ii.user_id = ANY($1) AND i.id <> $4
+            AND i.starts_at < $3 AND i.starts_at + make_interval(mins => i.duration_minutes) > $2
+        ORDER BY i.starts_at
+    `, pq.Array(interviewers), start, end, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []interviewConflict
+	for rows.Next() {
+		var cf interviewConflict
+		if err := rows.Scan(&cf.UserID, &cf.Username, &cf.InterviewID, &cf.CandidateName, &cf.StartsAt, &cf.EndsAt); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, cf)
+	}
+	return conflicts, rows.Err()
+}
+
+// saveInterviewers проверяет пересечения и перезаписывает состав интервьюеров.
+// Возвращает false, если ответ клиенту уже отправлен.
+func saveInterviewers(c *gin.Context, tx *sql.Tx, interviewID int, req interviewRequest) bool {
+	interviewers, err := prepareInterviewers(tx, req.InterviewerIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if interviewers == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Interviewers must be employees or admins"})
+		return false
+	}
+
+	conflicts, err := findInterviewConflicts(tx, interviewers, req.StartsAt, req.endsAt(), interviewID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Interviewer is already booked at this time", "conflicts": conflicts})
+		return false
+	}
+
+	if _, err := tx.Exec("DELETE FROM interview_interviewer WHERE interview_id = $1", interviewID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from interview_interviewer"})
+		return false
+	}
+	_, err = tx.Exec(`
+        INSERT INTO interview_interviewer (interview_id, user_id)
+        SELECT $1, unnest($2::text[])
+    `, interviewID, pq.Array(interviewers))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into interview_interviewer"})
+		return false
+	}
+	return true
+}
+
+func scheduleInterview(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	var req interviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var candidate, status string
+	err = tx.QueryRow("SELECT fio, status FROM employee_bid WHERE id = $1", bidID).Scan(&candidate, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status == "withdrawn" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Заявка отозвана заявителем"})
+		return
+	}
+
+	var id int
+	err = tx.QueryRow(`
+        INSERT INTO interview (bid_id, candidate_name, starts_at, duration_minutes, location, created_by)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id
+    `, bidID, candidate, req.StartsAt, req.DurationMinutes, req.Location, userID).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into interview"})
+		return
+	}
+	if !saveInterviewers(c, tx, id, req) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// updateInterview переносит собеседование или меняет состав интервьюеров; SEQUENCE растёт,
+// чтобы календарные клиенты заменили событие, а не создали новое.
+func updateInterview(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interview ID"})
+		return
+	}
+
+	var req interviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM interview WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Interview not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status != "scheduled" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Interview is cancelled"})
+		return
+	}
+
+	_, err = tx.Exec(`
+        UPDATE interview SET starts_at = $1, duration_minutes = $2, location = $3,
+            sequence = sequence + 1, updated_at = NOW()
+        WHERE id = $4
+    `, req.StartsAt, req.DurationMinutes, req.Location, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update interview"})
+		return
+	}
+	if !saveInterviewers(c, tx, id, req) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Interview updated successfully"})
+}
+
+func cancelInterview(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interview ID"})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE interview SET status = 'cancelled', sequence = sequence + 1, updated_at = NOW()
+        WHERE id = $1 AND status = 'scheduled'
+    `, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled interview not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Interview cancelled successfully"})
+}
+
+// cancelUpcomingInterviews отменяет ещё не прошедшие собеседования по заявке, когда по ней принято решение.
+func cancelUpcomingInterviews(tx *sql.Tx, bidID string) error {
+	_, err := tx.Exec(`
+        UPDATE interview SET status = 'cancelled', sequence = sequence + 1, updated_at = NOW()
+        WHERE bid_id = $1 AND status = 'scheduled' AND starts_at > NOW()
+    `, bidID)
+	return err
+}
+
+// putInterviewFeedback сохраняет отзыв текущего пользователя; оставить его может только интервьюер.
+func putInterviewFeedback(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interview ID"})
+		return
+	}
+
+	var req struct {
+		Rating         int    `json:"rating" binding:"required,min=1,max=5"`
+		Recommendation string `json:"recommendation" binding:"required,oneof=strong_no no yes strong_yes"`
+		Notes          string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var isInterviewer bool
+	err = db.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM interview_interviewer WHERE interview_id = $1 AND user_id = $2)
+    `, id, userID).Scan(&isInterviewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !isInterviewer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only interviewers can leave feedback"})
+		return
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO interview_feedback (interview_id, user_id, rating, recommendation, notes)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (interview_id, user_id) DO UPDATE SET
+            rating = EXCLUDED.rating, recommendation = EXCLUDED.recommendation,
+            notes = EXCLUDED.notes, updated_at = NOW()
+    `, id, userID, req.Rating, req.Recommendation, req.Notes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save interview feedback"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feedback saved successfully"})
+}
+
+func GetBidInterviews(c *gin.Context) {
+	interviews, err := loadInterviews("i.bid_id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, interviews)
+}
+
+// feedToken возвращает токен подписки на календарь, создавая его при первом обращении.
+// Клиенты календаря не умеют передавать JWT, поэтому ссылка содержит случайный токен,
+// который хранится в calendar_feed и может быть перевыпущен resetInterviewFeeds.
+func feedToken(kind, id string) (string, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+	err = db.QueryRow(`
+        INSERT INTO calendar_feed (kind, subject_id, token) VALUES ($1, $2, $3)
+        ON CONFLICT (kind, subject_id) DO UPDATE SET kind = EXCLUDED.kind
+        RETURNING token
+    `, kind, id, token).Scan(&token)
+	return token, err
+}
+
+func newFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func feedURL(kind, id, token string) string {
+	return fmt.Sprintf("%s/api/calendar/%s/%s/interviews.ics?token=%s",
+		envString("PUBLIC_BASE_URL", "http://localhost:8081"), kind, url.PathEscape(id), token)
+}
+
+// interviewFeeds собирает ссылки на календарь текущего интервьюера, а с ?bid_id= — и кандидата.
+// token выдаёт токен подписки: текущий или перевыпущенный.
+func interviewFeeds(c *gin.Context, token func(kind, id string) (string, error)) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	subjects := [][2]string{{"interviewer", userID}}
+	if bidID := c.Query("bid_id"); bidID != "" {
+		if _, err := strconv.Atoi(bidID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+			return
+		}
+		subjects = append(subjects, [2]string{"candidate", bidID})
+	}
+
+	links := gin.H{}
+	for _, s := range subjects {
+		kind := "interviewers"
+		if s[0] == "candidate" {
+			kind = "bids"
+		}
+		t, err := token(kind, s[1])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue calendar token"})
+			return
+		}
+		links[s[0]] = feedURL(kind, s[1], t)
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+func GetInterviewFeedURLs(c *gin.Context) {
+	interviewFeeds(c, feedToken)
+}
+
+// resetInterviewFeeds перевыпускает токены подписок, например если ссылка попала к посторонним:
+// старые ссылки перестают работать.
+func resetInterviewFeeds(c *gin.Context) {
+	interviewFeeds(c, func(kind, id string) (string, error) {
+		token, err := newFeedToken()
+		if err != nil {
+			return "", err
+		}
+		_, err = db.Exec(`
+            INSERT INTO calendar_feed (kind, subject_id, token) VALUES ($1, $2, $3)
+            ON CONFLICT (kind, subject_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()
+        `, kind, id, token)
+		return token, err
+	})
+}
+
+// InterviewCalendar отдаёт .ics-подписку; kind — "interviewers" или "bids".
+func InterviewCalendar(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var token string
+		err := db.QueryRow("SELECT token FROM calendar_feed WHERE kind = $1 AND subject_id = $2", kind, id).Scan(&token)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err == sql.ErrNoRows || !hmac.Equal([]byte(c.Query("token")), []byte(token)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid calendar token"})
+			return
+		}
+
+		// Старые события клиенту календаря уже известны, в ленте — только последние три месяца
+		where := "i.starts_at > NOW() - INTERVAL '90 days' AND "
+		if kind == "interviewers" {
+			where += "i.id IN (SELECT interview_id FROM interview_interviewer WHERE user_id = $1)"
+		} else {
+			where += "i.bid_id = $1::int"
+		}
+		interviews, err := loadInterviews(where, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		events := make([]calendarEvent, 0, len(interviews))
+		for _, iv := range interviews {
+			e := calendarEvent{
+				UID:       fmt.Sprintf("interview-%d@hr", iv.ID),
+				Sequence:  iv.Sequence,
+				Start:     iv.StartsAt,
+				End:       iv.EndsAt,
+				Summary:   "Собеседование",
+				Location:  iv.Location,
+				Cancelled: iv.Status == "cancelled",
+			}
+			if kind == "interviewers" {
+				e.Summary = "Собеседование: " + iv.CandidateName
+				e.Description = fmt.Sprintf("Заявка #%d", iv.BidID)
+			}
+			events = append(events, e)
+		}
+
+		c.Header("Content-Disposition", `inline; filename="interviews.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(buildCalendar("Собеседования", events, time.Now())))
+	}
+}
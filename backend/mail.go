@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type mailTemplate struct {
+	subject *texttemplate.Template
+	body    *template.Template
+}
+
+func newMailTemplate(subject, body string) mailTemplate {
+	return mailTemplate{
+		subject: texttemplate.Must(texttemplate.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+const mailFooterRU = `{{if .unsubscribe_url}}<p style="color:#888;font-size:12px">Вы получили это письмо как рецензент.
+<a href="{{.unsubscribe_url}}">Отписаться от уведомлений</a></p>{{end}}`
+
+const mailFooterEN = `{{if .unsubscribe_url}}<p style="color:#888;font-size:12px">You receive this email as a reviewer.
+<a href="{{.unsubscribe_url}}">Unsubscribe from notifications</a></p>{{end}}`
+
+// mailTemplates[шаблон][язык]; если варианта на языке получателя нет, используется ru.
+var mailTemplates = map[string]map[string]mailTemplate{
+	"bid_submitted": {
+		"ru": newMailTemplate(`Заявка №{{.bid_id}} получена`, `<p>Здравствуйте, {{.fio}}!</p>
+<p>Ваша заявка на должность «{{.job_title}}» ({{.subdivision}}) получена и передана на рассмотрение.</p>
+<p>Пока заявку не начали рассматривать, её можно исправить или отозвать в <a href="{{.base_url}}/">личном кабинете</a>.</p>`),
+		"en": newMailTemplate(`Application #{{.bid_id}} received`, `<p>Hello, {{.fio}}!</p>
+<p>Your application for the position "{{.job_title}}" ({{.subdivision}}) has been received and is awaiting review.</p>
+<p>Until the review starts you can edit or withdraw it in <a href="{{.base_url}}/">your account</a>.</p>`),
+	},
+	"bid_decision": {
+		"ru": newMailTemplate(`Решение по заявке №{{.bid_id}}`, `<p>Здравствуйте, {{.fio}}!</p>
+{{if eq .decision "accepted"}}<p>Ваша заявка одобрена. Мы свяжемся с вами, чтобы обсудить выход на работу.</p>
+{{else}}<p>К сожалению, ваша заявка отклонена. Спасибо за интерес к нашей организации.</p>{{end}}`),
+		"en": newMailTemplate(`Decision on application #{{.bid_id}}`, `<p>Hello, {{.fio}}!</p>
+{{if eq .decision "accepted"}}<p>Your application has been accepted. We will contact you to arrange your start date.</p>
+{{else}}<p>Unfortunately, your application has been declined. Thank you for your interest.</p>{{end}}`),
+	},
+	"new_bid": {
+		"ru": newMailTemplate(`Новая заявка: {{.fio}}`, `<p>Поступила заявка №{{.bid_id}} от {{.fio}} на должность «{{.job_title}}» ({{.subdivision}}).</p>
+<p><a href="{{.base_url}}/employee">Открыть входящие</a></p>`+mailFooterRU),
+		"en": newMailTemplate(`New application: {{.fio}}`, `<p>Application #{{.bid_id}} from {{.fio}} for "{{.job_title}}" ({{.subdivision}}) has arrived.</p>
+<p><a href="{{.base_url}}/employee">Open the inbox</a></p>`+mailFooterEN),
+	},
+	"daily_digest": {
+		"ru": newMailTemplate(`Сводка по заявкам: новых {{.new_count}}, без рецензента {{.stale_count}}`, `{{define "bids"}}<ul>{{range .}}
+<li>№{{.bid_id}} от {{.created_at}}: {{.fio}}, «{{.job_title}}» ({{.subdivision}})</li>{{end}}
+</ul>{{end}}{{if .new}}<p>Новые заявки за сутки:</p>{{template "bids" .new}}{{end}}
+{{if .stale}}<p>Заявки, которые давно ждут рецензента:</p>{{template "bids" .stale}}{{end}}
+<p><a href="{{.base_url}}/employee">Открыть входящие</a></p>`+mailFooterRU),
+		"en": newMailTemplate(`Applications digest: {{.new_count}} new, {{.stale_count}} unassigned`, `{{define "bids"}}<ul>{{range .}}
+<li>#{{.bid_id}} of {{.created_at}}: {{.fio}}, "{{.job_title}}" ({{.subdivision}})</li>{{end}}
+</ul>{{end}}{{if .new}}<p>New applications in the last 24 hours:</p>{{template "bids" .new}}{{end}}
+{{if .stale}}<p>Applications waiting for a reviewer:</p>{{template "bids" .stale}}{{end}}
+<p><a href="{{.base_url}}/employee">Open the inbox</a></p>`+mailFooterEN),
+	},
+	"sla_escalation": {
+		"ru": newMailTemplate(`Заявки не рассмотрены дольше {{.sla_days}} дн.`, `<p>Следующие заявки ждут решения дольше установленного срока ({{.sla_days}} дн.):</p>
+<ul>{{range .bids}}
+<li>№{{.bid_id}} от {{.created_at}}: {{.fio}}, «{{.job_title}}» ({{.subdivision}}), рецензент: {{or .assigned_to_name "не назначен"}}</li>{{end}}
+</ul>
+<p><a href="{{.base_url}}/employee">Открыть входящие</a></p>`),
+		"en": newMailTemplate(`Applications pending for more than {{.sla_days}} days`, `<p>These applications have been waiting for a decision longer than the SLA ({{.sla_days}} days):</p>
+<ul>{{range .bids}}
+<li>#{{.bid_id}} of {{.created_at}}: {{.fio}}, "{{.job_title}}" ({{.subdivision}}), reviewer: {{or .assigned_to_name "unassigned"}}</li>{{end}}
+</ul>
+<p><a href="{{.base_url}}/employee">Open the inbox</a></p>`),
+	},
+}
+
+func renderMail(name, locale string, data map[string]interface{}) (string, string, error) {
+	variants, ok := mailTemplates[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown mail template %q", name)
+	}
+	tmpl, ok := variants[locale]
+	if !ok {
+		tmpl = variants["ru"]
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
+
+// buildMail собирает HTML-письмо; заголовки в UTF-8 кодируются по RFC 2047.
+func buildMail(from, to, subject, html string, headers map[string]string, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	for k, v := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(html)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type mailTransport interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+type smtpTransport struct {
+	addr string
+	auth smtp.Auth
+}
+
+func (t smtpTransport) Send(from string, to []string, msg []byte) error {
+	return smtp.SendMail(t.addr, t.auth, from, to, msg)
+}
+
+// logTransport пишет письма в лог — для разработки без SMTP-сервера.
+type logTransport struct{}
+
+func (logTransport) Send(from string, to []string, msg []byte) error {
+	log.Printf("Письмо %s -> %s:\n%s", from, strings.Join(to, ", "), msg)
+	return nil
+}
+
+// newMailTransport выбирает транспорт по MAIL_TRANSPORT (smtp|log); без SMTP_HOST по умолчанию log.
+func newMailTransport() (mailTransport, error) {
+	host := envString("SMTP_HOST", "")
+	driver := envString("MAIL_TRANSPORT", "smtp")
+	if host == "" && driver == "smtp" {
+		driver = "log"
+	}
+	switch driver {
+	case "log":
+		return logTransport{}, nil
+	case "smtp":
+		t := smtpTransport{addr: net.JoinHostPort(host, envString("SMTP_PORT", "25"))}
+		if user := envString("SMTP_USERNAME", ""); user != "" {
+			t.auth = smtp.PlainAuth("", user, envString("SMTP_PASSWORD", ""), host)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", driver)
+}
+
+func mailMaxAttempts() int {
+	return envInt("MAIL_MAX_ATTEMPTS", 6)
+}
+
+// mailRetryDelay — 1, 2, 4… минуты, но не больше часа.
+func mailRetryDelay(attempt int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+func unsubscribeToken(secret, userID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:" + userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func unsubscribeURL(secret, userID string) string {
+	return fmt.Sprintf("%s/api/mail/unsubscribe?user=%s&token=%s",
+		envString("PUBLIC_BASE_URL", "http://localhost:8081"), url.QueryEscape(userID), unsubscribeToken(secret, userID))
+}
+
+const queueMailSQL = `
+    INSERT INTO mail_message (user_id, recipient, locale, template, data, essential)
+    SELECT u.id::text, u.email, u.locale, $1, $2, $3 FROM users u
+    WHERE u.email <> '' AND ($3 OR NOT u.email_opt_out) AND `
+
+// queueMail ставит письмо в очередь пользователям, выбранным условием recipients по алиасу u.
+// Необязательные письма (essential = false) не получают отказавшиеся от рассылки.
+func queueMail(tx *sql.Tx, name string, data gin.H, essential bool, recipients string, args ...interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(queueMailSQL+recipients, append([]interface{}{name, string(payload), essential}, args...)...)
+	return err
+}
+
+// mailSink превращает события outbox в письма: подтверждение подачи заявителю и уведомление
+// рецензентам подразделения, решение по заявке — заявителю.
+type mailSink struct{}
+
+func (mailSink) Name() string { return "mail" }
+
+func (mailSink) Publish(tx *sql.Tx, msg outboxMessage) error {
+	var ev struct {
+		BidID         int     `json:"bid_id"`
+		FIO           string  `json:"fio"`
+		JobTitleID    int     `json:"job_title_id"`
+		SubdivisionID int     `json:"subdivision_id"`
+		SubmittedBy   *string `json:"submitted_by"`
+	}
+	if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+		return err
+	}
+
+	switch msg.EventType {
+	case "application.submitted":
+		var jobTitle, subdivision string
+		err := tx.QueryRow(`
+            SELECT COALESCE((SELECT name FROM job_title WHERE id = $1), ''),
+                COALESCE((SELECT name FROM subdivision WHERE id = $2), '')
+        `, ev.JobTitleID, ev.SubdivisionID).Scan(&jobTitle, &subdivision)
+		if err != nil {
+			return err
+		}
+		data := gin.H{"bid_id": ev.BidID, "fio": ev.FIO, "job_title": jobTitle, "subdivision": subdivision}
+		if ev.SubmittedBy != nil {
+			if err := queueMail(tx, "bid_submitted", data, true, "u.id::text = $4", *ev.SubmittedBy); err != nil {
+				return err
+			}
+		}
+		return queueMail(tx, "new_bid", data, false, `u.role IN ('employee', 'admin') AND EXISTS (
+            SELECT 1 FROM reviewer_subdivision rs WHERE rs.user_id = u.id::text AND rs.subdivision_id = $4)`, ev.SubdivisionID)
+	case "employee.hired", "application.rejected":
+		if ev.SubmittedBy == nil {
+			return nil
+		}
+		decision := "accepted"
+		if msg.EventType == "application.rejected" {
+			decision = "rejected"
+		}
+		data := gin.H{"bid_id": ev.BidID, "fio": ev.FIO, "decision": decision}
+		return queueMail(tx, "bid_decision", data, true, "u.id::text = $4", *ev.SubmittedBy)
+	}
+	return nil
+}
+
+// runMailer отправляет очередь писем, пока она не опустеет, затем ждёт MAIL_POLL_INTERVAL.
+func runMailer(jwtSecret string, transport mailTransport) {
+	for {
+		n, err := sendDueMail(jwtSecret, transport)
+		if err != nil {
+			log.Printf("Ошибка отправки писем: %v", err)
+		}
+		if n == 0 || err != nil {
+			time.Sleep(envDuration("MAIL_POLL_INTERVAL", 10*time.Second))
+		}
+	}
+}
+
+func sendDueMail(jwtSecret string, transport mailTransport) (int, error) {
+	// Как и у вебхуков, взятые письма откладываются на время аренды
+	rows, err := db.Query(`
+        UPDATE mail_message SET next_attempt_at = NOW() + interval '5 minutes'
+        WHERE id IN (
+            SELECT id FROM mail_message
+            WHERE status = 'pending' AND next_attempt_at <= NOW()
+            ORDER BY next_attempt_at
+            LIMIT 20
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, user_id, recipient, locale, template, data, essential, attempts
+    `)
+	if err != nil {
+		return 0, err
+	}
+	type job struct {
+		id                              int64
+		userID, recipient, locale, tmpl string
+		data                            []byte
+		essential                       bool
+		attempts                        int
+	}
+	var jobs []job
+	for rows.Next() {
+		var j job
+		if err := rows.Scan(&j.id, &j.userID, &j.recipient, &j.locale, &j.tmpl, &j.data, &j.essential, &j.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobs = append(jobs, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	from := envString("MAIL_FROM", "hr@localhost")
+	for _, j := range jobs {
+		attempts := j.attempts + 1
+		sendErr := func() error {
+			data := map[string]interface{}{}
+			if err := json.Unmarshal(j.data, &data); err != nil {
+				return err
+			}
+			data["base_url"] = envString("PUBLIC_BASE_URL", "http://localhost:8081")
+			headers := map[string]string{}
+			if !j.essential {
+				data["unsubscribe_url"] = unsubscribeURL(jwtSecret, j.userID)
+				headers["List-Unsubscribe"] = "<" + data["unsubscribe_url"].(string) + ">"
+			}
+			subject, body, err := renderMail(j.tmpl, j.locale, data)
+			if err != nil {
+				// Ошибку шаблона повтор не исправит
+				attempts = mailMaxAttempts()
+				return err
+			}
+			msg, err := buildMail(from, j.recipient, subject, body, headers, time.Now())
+			if err != nil {
+				return err
+			}
+			return transport.Send(from, []string{j.recipient}, msg)
+		}()
+
+		status, retryIn, errText := "sent", time.Duration(0), (*string)(nil)
+		if sendErr != nil {
+			s := sendErr.Error()
+			errText = &s
+			status = "pending"
+			retryIn = mailRetryDelay(attempts)
+			if attempts >= mailMaxAttempts() {
+				status = "dead"
+			}
+			log.Printf("Ошибка отправки письма %d: %v", j.id, sendErr)
+		}
+		_, err := db.Exec(`
+            UPDATE mail_message SET
+                status = $2, attempts = $3, last_error = $4,
+                next_attempt_at = NOW() + make_interval(secs => $5),
+                sent_at = CASE WHEN $2 = 'sent' THEN NOW() END
+            WHERE id = $1
+        `, j.id, status, attempts, errText, retryIn.Seconds())
+		if err != nil {
+			return len(jobs), err
+		}
+	}
+	return len(jobs), nil
+}
+
+// MailUnsubscribe отключает необязательные письма по подписанной ссылке из письма, без входа в систему.
+func MailUnsubscribe(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Query("user")
+		if !hmac.Equal([]byte(c.Query("token")), []byte(unsubscribeToken(jwtSecret, userID))) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid unsubscribe token"})
+			return
+		}
+		if _, err := db.Exec("UPDATE users SET email_opt_out = true WHERE id::text = $1", userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Вы отписались от уведомлений"})
+	}
+}
+
+func GetMailPreferences(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	var locale string
+	var optOut bool
+	err := db.QueryRow("SELECT locale, email_opt_out FROM users WHERE id::text = $1", userID).Scan(&locale, &optOut)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"locale": locale, "email_opt_out": optOut})
+}
+
+func putMailPreferences(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	var req struct {
+		Locale      string `json:"locale" binding:"required,oneof=ru en"`
+		EmailOptOut bool   `json:"email_opt_out"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := db.Exec("UPDATE users SET locale = $1, email_opt_out = $2 WHERE id::text = $3", req.Locale, req.EmailOptOut, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"locale": req.Locale, "email_opt_out": req.EmailOptOut})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderMail(t *testing.T) {
+	data := map[string]interface{}{
+		"bid_id": 12, "fio": "<b>Иванов</b>", "job_title": "Инженер", "subdivision": "Отдел 1", "base_url": "http://hr.local",
+	}
+	subject, body, err := renderMail("bid_submitted", "ru", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Заявка №12 получена" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if !strings.Contains(body, "&lt;b&gt;Иванов&lt;/b&gt;") || !strings.Contains(body, `href="http://hr.local/"`) {
+		t.Errorf("body is not escaped or misses link: %s", body)
+	}
+
+	subject, _, _ = renderMail("bid_submitted", "en", data)
+	if subject != "Application #12 received" {
+		t.Errorf("unexpected en subject %q", subject)
+	}
+	subject, _, _ = renderMail("bid_submitted", "de", data)
+	if subject != "Заявка №12 получена" {
+		t.Errorf("unknown locale should fall back to ru, got %q", subject)
+	}
+
+	_, body, _ = renderMail("new_bid", "ru", data)
+	if strings.Contains(body, "Отписаться") {
+		t.Error("footer without unsubscribe_url should be omitted")
+	}
+	data["unsubscribe_url"] = "http://hr.local/api/mail/unsubscribe?user=1&token=x"
+	_, body, _ = renderMail("new_bid", "ru", data)
+	if !strings.Contains(body, "Отписаться") {
+		t.Error("expected unsubscribe footer")
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	data := map[string]interface{}{
+		"new": []interface{}{
+			map[string]interface{}{"bid_id": 3, "fio": "Петров", "job_title": "Инженер", "subdivision": "Отдел 1", "created_at": "14.03.2024"},
+		},
+		"stale": []interface{}{}, "new_count": 1, "stale_count": 0, "base_url": "http://hr.local",
+	}
+	subject, body, err := renderMail("daily_digest", "ru", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Сводка по заявкам: новых 1, без рецензента 0" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if !strings.Contains(body, "№3 от 14.03.2024: Петров") || strings.Contains(body, "ждут рецензента") {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+// mailCatcher — минимальный SMTP-сервер, принимающий одно письмо.
+func mailCatcher(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 catcher ready")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 catcher")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPTransport(t *testing.T) {
+	addr, received := mailCatcher(t)
+
+	msg, err := buildMail("hr@example.com", "anna@example.com", "Заявка №1 получена", "<p>Здравствуйте!</p>",
+		map[string]string{"List-Unsubscribe": "<http://hr.local/unsubscribe>"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (smtpTransport{addr: addr}).Send("hr@example.com", []string{"anna@example.com"}, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw string
+	select {
+	case raw = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("mail catcher received nothing")
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Заявка №1 получена" || parsed.Header.Get("List-Unsubscribe") != "<http://hr.local/unsubscribe>" {
+		t.Errorf("unexpected headers: %v", parsed.Header)
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if strings.TrimSpace(string(body)) != "<p>Здравствуйте!</p>" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -30,24 +32,37 @@ type AuthRequest struct {
 }
 
 type Bid struct {
-	ID           int         `json:"bid_id"`
-	EmployeeName string      `json:"employee_name"`
-	Age          int         `json:"age"`
-	OverallExp   int         `json:"overall_experience"`
-	SPExp        int         `json:"s_p_experience"`
-	IsRead       bool        `json:"is_read"`
-	JobTitle     string      `json:"job_title"`
-	Subdivision  string      `json:"subdivision"`
-	Educations   []Education `json:"educations"`
-	Languages    []Language  `json:"languages"`
+	ID            int         `json:"bid_id"`
+	EmployeeName  string      `json:"employee_name"`
+	Age           *int        `json:"age"`
+	BirthDate     *string     `json:"birth_date"`
+	OverallExp    int         `json:"overall_experience"`
+	SPExp         int         `json:"s_p_experience"`
+	IsRead        bool        `json:"is_read"`
+	JobTitleID    int         `json:"job_title_id"`
+	SubdivisionID int         `json:"subdivision_id"`
+	VacancyID     *int        `json:"vacancy_id"`
+	CreatedAt     time.Time   `json:"created_at"`
+	AssignedTo    *string     `json:"assigned_to"`
+	AssignedName  *string     `json:"assigned_to_name"`
+	Stale         bool        `json:"stale"`
+	DuplicateOf   *int        `json:"duplicate_of"`
+	EmployeeMatch *int        `json:"matching_employee_id"`
+	Status        string      `json:"status"`
+	JobTitle      string      `json:"job_title"`
+	Subdivision   string      `json:"subdivision"`
+	Educations    []Education `json:"educations"`
+	Languages     []Language  `json:"languages"`
 }
 
 type Language struct {
+	ID    int    `json:"language_id"`
 	Name  string `json:"language"`
 	Level string `json:"proficiency"`
 }
 
 type Education struct {
+	ID    int    `json:"education_id"`
 	Name  string `json:"name"`
 	Place string `json:"place"`
 }
@@ -85,6 +100,32 @@ func main() {
 
 	fmt.Println("Подключение к PostgreSQL успешно!")
 
+	if err := migrate(db); err != nil {
+		log.Fatalf("Ошибка миграции базы данных: %v", err)
+	}
+
+	blobs, err = newBlobStore()
+	if err != nil {
+		log.Fatalf("Ошибка настройки хранилища файлов: %v", err)
+	}
+
+	go listenBidEvents(connStr)
+
+	tgBot = newTelegramBot()
+
+	sinks, err := outboxSinks()
+	if err != nil {
+		log.Fatalf("Ошибка настройки outbox: %v", err)
+	}
+	go runOutboxDispatcher(sinks)
+	go runWebhookWorker()
+
+	sched, err := newScheduler(sinks)
+	if err != nil {
+		log.Fatalf("Ошибка настройки планировщика: %v", err)
+	}
+	go sched.run()
+
 	r := gin.Default()
 
 	jwtSecret := os.Getenv("JWT_SECRET")
@@ -92,14 +133,22 @@ func main() {
 		log.Fatal("JWT_SECRET не найден в .env")
 	}
 
+	transport, err := newMailTransport()
+	if err != nil {
+		log.Fatalf("Ошибка настройки почты: %v", err)
+	}
+	go runMailer(jwtSecret, transport)
+
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:8081"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Range"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Range"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Range", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "X-Total-Count", "X-Next-Cursor", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
+	r.Use(BodyLimitMiddleware(maxRequestBytes()))
+
 	r.Use(func(c *gin.Context) {
 		c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 		c.Header("Pragma", "no-cache")
@@ -281,9 +330,9 @@ func main() {
 		c.JSON(http.StatusOK, educations)
 	})
 
-	r.POST("/api/submit-application", postRequest)
+	r.POST("/api/submit-application", OptionalAuthMiddleware(jwtSecret), IdempotencyMiddleware(), postRequest)
 
-	r.GET("/api/employees/get", GetEmployees)
+	r.GET("/api/employees/get", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetEmployees)
 
 	r.GET("/api/job_title/get", GetJobTitles)
 
@@ -293,21 +342,207 @@ func main() {
 
 	r.POST("/", AuthHandler)
 
-	r.POST("/api/accept-application/:id", AuthMiddleware(jwtSecret), acceptRequest)
+	r.POST("/api/accept-application/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), IdempotencyMiddleware(), acceptRequest)
+
+	r.DELETE("/api/reject-application/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), IdempotencyMiddleware(), denyRequest)
+
+	r.GET("/api/employees/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetEmployeeByID)
+
+	r.PUT("/api/employees/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), editEmployees)
+
+	r.DELETE("/api/employees/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), deleteEmployees)
+
+	r.POST("/api/employees/:id/transfer", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), transferEmployee)
+
+	r.GET("/api/employees/:id/history", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetEmployeeHistory)
+
+	r.GET("/api/job-titles/vacancies", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetVacancies)
+
+	r.PUT("/api/job-titles/:id/headcount", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), setHeadcount)
+
+	r.GET("/api/vacancies", GetOpenVacancies)
+
+	r.GET("/api/vacancies/manage", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetAllVacancies)
+
+	r.POST("/api/vacancies", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), createVacancy)
+
+	r.PUT("/api/vacancies/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), updateVacancy)
+
+	r.POST("/api/vacancies/:id/close", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), closeVacancy)
+
+	r.POST("/api/vacancies/:id/reopen", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), reopenVacancy)
+
+	r.GET("/api/job-titles/:id/requirements", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), getJobTitleRequirements)
+
+	r.PUT("/api/job-titles/:id/requirements", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), putJobTitleRequirements)
+
+	r.GET("/api/vacancies/:id/requirements", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), getVacancyRequirements)
+
+	r.PUT("/api/vacancies/:id/requirements", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), putVacancyRequirements)
+
+	r.GET("/api/bids/ranked", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetRankedBids)
+
+	r.GET("/api/bids/:id/score", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetBidScore)
+
+	r.GET("/api/bids/:id/comments", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetBidComments)
+
+	r.POST("/api/bids/:id/comments", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), postBidComment)
+
+	r.GET("/api/employees/:id/comments", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetEmployeeComments)
+
+	r.PUT("/api/comments/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), editComment)
+
+	r.GET("/api/comments/:id/history", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetCommentHistory)
+
+	r.GET("/api/mentions", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetMyMentions)
+
+	r.POST("/api/bids/:id/assign", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), assignBid)
+
+	r.GET("/api/reviewers/workload", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetReviewerWorkload)
+
+	r.PUT("/api/reviewers/:id/subdivisions", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), setReviewerSubdivisions)
+
+	r.GET("/api/bids/:id/interviews", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetBidInterviews)
+
+	r.POST("/api/bids/:id/interviews", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), scheduleInterview)
+
+	r.PUT("/api/interviews/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), updateInterview)
+
+	r.POST("/api/interviews/:id/cancel", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), cancelInterview)
+
+	r.PUT("/api/interviews/:id/feedback", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), putInterviewFeedback)
+
+	r.GET("/api/interviews/feeds", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetInterviewFeedURLs)
+
+	r.POST("/api/interviews/feeds/reset", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), resetInterviewFeeds)
+
+	// Подписки календаря авторизуются токеном подписки в ссылке
+	r.GET("/api/calendar/interviewers/:id/interviews.ics", InterviewCalendar("interviewers"))
+
+	r.GET("/api/calendar/bids/:id/interviews.ics", InterviewCalendar("bids"))
+
+	r.GET("/api/bids/:id/attachments", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetBidAttachments)
+
+	r.POST("/api/bids/:id/attachments", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), uploadBidAttachments)
+
+	r.GET("/api/employees/:id/attachments", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetEmployeeAttachments)
+
+	r.GET("/api/attachments/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), downloadAttachment)
+
+	r.DELETE("/api/attachments/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), deleteAttachment)
+
+	r.GET("/api/bids/duplicates", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetDuplicateBids)
+
+	r.GET("/api/bids/:id/duplicates", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetBidDuplicates)
+
+	r.POST("/api/bids/:id/merge", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), mergeBid)
+
+	r.GET("/api/drafts", AuthMiddleware(jwtSecret), GetDrafts)
 
-	r.DELETE("/api/reject-application/:id", AuthMiddleware(jwtSecret), denyRequest)
+	r.POST("/api/drafts", AuthMiddleware(jwtSecret), createDraft)
 
-	r.GET("/api/employees/:id", GetEmployeeByID)
+	r.GET("/api/drafts/:id", AuthMiddleware(jwtSecret), GetDraft)
 
-	r.PUT("/api/employees/:id", editEmployees)
+	r.PATCH("/api/drafts/:id", AuthMiddleware(jwtSecret), patchDraft)
 
-	r.DELETE("/api/employees/:id", deleteEmployees)
+	r.DELETE("/api/drafts/:id", AuthMiddleware(jwtSecret), deleteDraft)
+
+	r.POST("/api/drafts/:id/submit", AuthMiddleware(jwtSecret), IdempotencyMiddleware(), submitDraft)
+
+	r.GET("/api/my/bids", AuthMiddleware(jwtSecret), GetMyBids)
+
+	r.PATCH("/api/my/bids/:id", AuthMiddleware(jwtSecret), editMyBid)
+
+	r.POST("/api/my/bids/:id/withdraw", AuthMiddleware(jwtSecret), IdempotencyMiddleware(), withdrawMyBid)
+
+	r.GET("/api/bids/:id/history", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetBidHistory)
+
+	r.GET("/api/bids/events", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), StreamBidEventsSSE)
+
+	r.GET("/api/bids/events/ws", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), StreamBidEventsWS)
+
+	r.GET("/api/webhooks", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetWebhooks)
+
+	r.POST("/api/webhooks", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), createWebhook)
+
+	r.PUT("/api/webhooks/:id", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), updateWebhook)
+
+	r.DELETE("/api/webhooks/:id", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), deleteWebhook)
+
+	r.GET("/api/webhooks/deliveries", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetWebhookDeliveries)
+
+	r.GET("/api/webhooks/deliveries/:id", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetWebhookDelivery)
+
+	r.POST("/api/webhooks/deliveries/:id/redeliver", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), redeliverWebhook)
+
+	r.GET("/api/user/preferences", AuthMiddleware(jwtSecret), GetMailPreferences)
+
+	r.PUT("/api/user/preferences", AuthMiddleware(jwtSecret), putMailPreferences)
+
+	// Ссылка из письма открывается без входа, подлинность проверяется подписью
+	r.GET("/api/mail/unsubscribe", MailUnsubscribe(jwtSecret))
+
+	r.GET("/api/telegram/link", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetTelegramLink)
+
+	r.POST("/api/telegram/link", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), createTelegramLink)
+
+	r.DELETE("/api/telegram/link", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), deleteTelegramLink)
+
+	r.GET("/api/scheduler/jobs", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetScheduledJobs(sched))
+
+	r.GET("/api/scheduler/runs", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetJobRuns)
+
+	r.GET("/api/analytics/bids", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetBidVolume)
+
+	r.GET("/api/analytics/decisions", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetDecisionStats)
+
+	r.GET("/api/analytics/headcount", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetHeadcountStats)
+
+	r.GET("/api/analytics/distributions", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetDistributionStats)
+
+	r.GET("/api/analytics/languages", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), GetLanguageCoverage)
+
+	r.GET("/api/document-templates", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetDocumentTemplates)
+
+	r.POST("/api/document-templates", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), createDocumentTemplate)
+
+	r.PUT("/api/document-templates/:id", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), updateDocumentTemplate)
+
+	r.DELETE("/api/document-templates/:id", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), deleteDocumentTemplate)
+
+	r.GET("/api/employees/:id/documents", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetEmployeeDocuments)
+
+	r.POST("/api/employees/:id/documents", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), generateEmployeeDocument)
+
+	r.GET("/api/documents/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), downloadDocument)
+
+	r.DELETE("/api/documents/:id", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), deleteDocument)
+
+	r.GET("/api/org-chart", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetOrgChart)
+
+	r.GET("/api/subdivisions/:id/employees", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetSubdivisionEmployees)
+
+	r.PUT("/api/subdivisions/:id/parent", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), moveSubdivision)
+
+	r.PUT("/api/subdivisions/:id/head", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), setSubdivisionHead)
+
+	r.PUT("/api/employees/:id/manager", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), setEmployeeManager)
+
+	r.GET("/api/employees/:id/reports", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), GetEmployeeReports)
+
+	r.PUT("/api/users/:id/employee-scope", AuthMiddleware(jwtSecret), RoleMiddleware("admin"), setUserEmployeeScope)
+
+	r.GET("/api/search", AuthMiddleware(jwtSecret), RoleMiddleware("employee", "admin"), SearchHandler)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
 	}
 
+	if tgBot != nil {
+		go tgBot.run()
+	}
+
 	fmt.Printf("Сервер запущен на порту %s\n", port)
 
 	if err := r.Run(":" + port); err != nil {
@@ -436,6 +671,59 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthMiddleware сохраняет claims, если запрос пришёл с действительным токеном,
+// и пропускает анонимные запросы без ошибки.
+func OptionalAuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tokenString, err := c.Cookie("authToken"); err == nil {
+			if claims, err := validateToken(tokenString, jwtSecret); err == nil {
+				c.Set("userClaims", claims)
+			}
+		}
+		c.Next()
+	}
+}
+
+// BodyLimitMiddleware ограничивает размер тела запроса до того, как его целиком прочитают
+// IdempotencyMiddleware или разбор multipart-формы: анонимная подача заявки иначе позволяет
+// заставить сервер держать в памяти тело любого размера.
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+		c.Next()
+	}
+}
+
+// RoleMiddleware пропускает только пользователей с одной из перечисленных ролей.
+// Должен стоять после AuthMiddleware; роль сохраняется в контексте как "userRole".
+func RoleMiddleware(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+		var role string
+		err := db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+
+		for _, r := range roles {
+			if role == r {
+				c.Set("userRole", role)
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+	}
+}
+
 func validateToken(tokenString, jwtSecret string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -471,15 +759,27 @@ func GenerateJWT(userID string, jwtSecret string) (string, error) {
 	return signedToken, err
 }
 
-func EmployeeMiddleware(c *gin.Context) {
-	rows, err := db.Query(`
+const bidsQuery = `
         SELECT
         eb.id AS bid_id,
         eb.fio AS employee_name,
         eb.age,
+        to_char(eb.birth_date, 'YYYY-MM-DD') AS birth_date,
         eb.overall_experience,
         eb.s_p_experience,
         eb.read AS is_read,
+        eb.job_title_id,
+        eb.subdivision_id,
+        eb.vacancy_id,
+        eb.created_at,
+        eb.assigned_to,
+        ru.username AS assigned_to_name,
+        eb.duplicate_of,
+        eb.status,
+        -- Сотрудник с тем же ФИО и возрастом: кандидат, возможно, уже работает у нас
+        (SELECT e.id FROM employee_computed e
+            WHERE normalize_fio(e.fio) = normalize_fio(eb.fio) AND e.age = eb.age
+            ORDER BY e.id LIMIT 1) AS matching_employee_id,
         -- Должность
         jt.name AS job_title,
         -- Подразделение
@@ -487,6 +787,7 @@ func EmployeeMiddleware(c *gin.Context) {
         -- Образования (массив объектов)
         COALESCE(
             json_agg(DISTINCT jsonb_build_object(
+                'education_id', ed.id,
                 'name', ed.name,
                 'place', eeb.place
             )) FILTER (WHERE ed.name IS NOT NULL), 
@@ -494,34 +795,51 @@ func EmployeeMiddleware(c *gin.Context) {
         -- Языки с уровнями (массив объектов)
         COALESCE(
             json_agg(DISTINCT jsonb_build_object(
+                'language_id', lg.id,
                 'language', lg.language,
                 'proficiency', elb.proficiency
             )) FILTER (WHERE lg.language IS NOT NULL), 
             '[]'
         ) AS languages
-        FROM employee_bid eb
+        FROM employee_bid_computed eb
         LEFT JOIN job_title jt ON eb.job_title_id = jt.id
         LEFT JOIN subdivision sd ON eb.subdivision_id = sd.id
+        LEFT JOIN users ru ON ru.id::text = eb.assigned_to
         LEFT JOIN employee_education_bid eeb ON eb.id = eeb.employee_id
         LEFT JOIN education ed ON eeb.education_id = ed.id
         LEFT JOIN employee_languages_bid elb ON eb.id = elb.employee_id
-        LEFT JOIN languages lg ON elb.language_id = lg.id
+        LEFT JOIN languages lg ON elb.language_id = lg.id`
+
+const bidsGroupBy = `
         GROUP BY 
         eb.id, 
         eb.fio, 
         eb.age, 
+        eb.birth_date,
         eb.overall_experience, 
         eb.s_p_experience, 
         eb.read,
+        eb.job_title_id,
+        eb.subdivision_id,
+        eb.vacancy_id,
+        eb.created_at,
+        eb.assigned_to,
+        ru.username,
+        eb.duplicate_of,
+        eb.status,
         jt.name,
-        sd.name;
-    `)
+        sd.name
+        ORDER BY eb.id`
+
+// loadBids возвращает заявки вместе с образованием и языками; условия qb относятся к алиасу eb.
+func loadBids(qb *queryBuilder) ([]Bid, error) {
+	rows, err := db.Query(bidsQuery+qb.whereSQL()+bidsGroupBy, qb.args...)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Database error: " + err.Error()})
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
+	staleBefore := time.Now().Add(-unassignedThreshold())
 	var bids []Bid
 	for rows.Next() {
 		var bid Bid
@@ -531,29 +849,71 @@ func EmployeeMiddleware(c *gin.Context) {
 			&bid.ID,
 			&bid.EmployeeName,
 			&bid.Age,
+			&bid.BirthDate,
 			&bid.OverallExp,
 			&bid.SPExp,
 			&bid.IsRead,
+			&bid.JobTitleID,
+			&bid.SubdivisionID,
+			&bid.VacancyID,
+			&bid.CreatedAt,
+			&bid.AssignedTo,
+			&bid.AssignedName,
+			&bid.DuplicateOf,
+			&bid.Status,
+			&bid.EmployeeMatch,
 			&bid.JobTitle,
 			&bid.Subdivision,
 			&educationsStr,
 			&languagesStr,
 		); err != nil {
-			c.JSON(500, gin.H{"error": "Failed to parse playlists: " + err.Error()})
-			return
+			return nil, fmt.Errorf("failed to parse bids: %w", err)
 		}
 		if err := json.Unmarshal([]byte(educationsStr), &bid.Educations); err != nil {
-			c.JSON(500, gin.H{"error": "Failed to parse educations: " + err.Error()})
-			return
+			return nil, fmt.Errorf("failed to parse educations: %w", err)
 		}
 		if err := json.Unmarshal([]byte(languagesStr), &bid.Languages); err != nil {
-			c.JSON(500, gin.H{"error": "Failed to parse languages: " + err.Error()})
-			return
+			return nil, fmt.Errorf("failed to parse languages: %w", err)
 		}
+		bid.Stale = bid.AssignedTo == nil && bid.CreatedAt.Before(staleBefore)
 		bids = append(bids, bid)
 	}
-	if err := rows.Err(); err != nil {
-		c.JSON(500, gin.H{"error": "Database error: " + err.Error()})
+	return bids, rows.Err()
+}
+
+// EmployeeMiddleware — входящие заявки; ?assigned=me|none|<user_id>, ?stale=true, ?subdivision_id= (с ?include_descendants=true),
+// ?status=submitted|withdrawn|all (по умолчанию только поданные).
+func EmployeeMiddleware(c *gin.Context) {
+	qb := &queryBuilder{}
+	switch status := c.DefaultQuery("status", "submitted"); status {
+	case "all":
+	case "submitted", "withdrawn":
+		qb.where("eb.status = %s", status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be submitted, withdrawn or all"})
+		return
+	}
+	switch assigned := c.Query("assigned"); assigned {
+	case "":
+	case "me":
+		qb.where("eb.assigned_to = %s", c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string))
+	case "none":
+		qb.conds = append(qb.conds, "eb.assigned_to IS NULL")
+	default:
+		qb.where("eb.assigned_to = %s", assigned)
+	}
+	if c.Query("stale") == "true" {
+		qb.where("eb.assigned_to IS NULL AND eb.created_at < NOW() - make_interval(secs => %s)", unassignedThreshold().Seconds())
+	}
+	if err := qb.subdivisionFilter(c, "eb.subdivision_id", "subdivision_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bids, err := loadBids(qb)
+	if err != nil {
+		log.Printf("Ошибка загрузки заявок: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	if len(bids) == 0 {
@@ -572,28 +932,79 @@ func MessagesMiddleware(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Rows updated successfully"})
 }
 
+type applicationRequest struct {
+	personDates
+	FIO           string `json:"fio"`
+	VacancyID     int    `json:"vacancy_id"`
+	JobTitleID    int    `json:"job_title_id"`
+	SubdivisionID int    `json:"subdivision_id"`
+	Languages     []struct {
+		LanguageID  int    `json:"language_id"`
+		Proficiency string `json:"proficiency"`
+	} `json:"languages"`
+	Educations []struct {
+		EducationID int    `json:"education_id"`
+		Place       string `json:"place"`
+	} `json:"educations"`
+}
+
+func (r applicationRequest) validate() error {
+	if strings.TrimSpace(r.FIO) == "" {
+		return errors.New("fio is required")
+	}
+	if r.VacancyID == 0 && (r.JobTitleID == 0 || r.SubdivisionID == 0) {
+		return errors.New("vacancy_id or job_title_id and subdivision_id are required")
+	}
+	for _, lang := range r.Languages {
+		if lang.LanguageID <= 0 || cefrRank[lang.Proficiency] == 0 {
+			return errors.New("invalid language or proficiency")
+		}
+	}
+	for _, edu := range r.Educations {
+		if edu.EducationID <= 0 {
+			return errors.New("invalid education")
+		}
+	}
+	return nil
+}
+
 func postRequest(c *gin.Context) {
-	var req struct {
-		FIO               string `json:"fio"`
-		Age               int    `json:"age"`
-		OverallExperience int    `json:"overall_experience"`
-		SPExperience      int    `json:"s_p_experience"`
-		JobTitleID        int    `json:"job_title_id"`
-		SubdivisionID     int    `json:"subdivision_id"`
-		Languages         []struct {
-			LanguageID  int    `json:"language_id"`
-			Proficiency string `json:"proficiency"`
-		} `json:"languages"`
-		Educations []struct {
-			EducationID int    `json:"education_id"`
-			Place       string `json:"place"`
-		} `json:"educations"`
+	var req applicationRequest
+	uploads, err := bindApplication(c, &req)
+	if err != nil {
+		c.JSON(attachmentErrorStatus(err), gin.H{"error": attachmentErrorMessage(err)})
+		return
 	}
+	submitApplication(c, req, uploads, nil)
+}
 
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+// submitApplication проверяет и сохраняет заявку. beforeCommit, если задан, выполняется
+// в той же транзакции — например, чтобы удалить черновик, из которого подана заявка.
+func submitApplication(c *gin.Context, req applicationRequest, uploads []upload, beforeCommit func(tx *sql.Tx) error) {
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	birthDate, experience, err := req.resolve(time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Файлы загружаются в хранилище до транзакции и удаляются, если заявка так и не сохранится
+	keys, err := putBlobs(c.Request.Context(), uploads)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachments"})
+		log.Printf("Failed to save attachments: %v", err)
 		return
 	}
+	committed := false
+	defer func() {
+		if !committed {
+			removeBlobs(keys)
+		}
+	}()
 
 	tx, err := db.Begin()
 	if err != nil {
@@ -601,12 +1012,42 @@ func postRequest(c *gin.Context) {
 		return
 	}
 
+	// Заявка всегда привязана к открытой вакансии; должность и подразделение берутся из неё
+	vacancyID, jobTitleID, subdivisionID, err := resolveVacancy(tx, req.VacancyID, req.JobTitleID, req.SubdivisionID)
+	if err != nil {
+		tx.Rollback()
+		switch err {
+		case errVacancyNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errVacancyClosed, errNoOpenVacancy:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve vacancy"})
+		}
+		return
+	}
+
+	submittedBy := submitterID(c)
+	duplicateOf, err := findDuplicateBid(tx, req.FIO, birthDate, jobTitleID, submittedBy)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for duplicates"})
+		log.Printf("Failed to check for duplicates: %v", err)
+		return
+	}
+	// DUPLICATE_POLICY=reject отклоняет повтор, по умолчанию заявка принимается с пометкой
+	if duplicateOf != nil && envString("DUPLICATE_POLICY", "warn") == "reject" {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Такая заявка уже подана", "duplicate_of": *duplicateOf})
+		return
+	}
+
 	var employeeID int
 	err = tx.QueryRow(`
         INSERT INTO employee_bid (
-            fio, age, overall_experience, s_p_experience, job_title_id, subdivision_id
-        ) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
-    `, req.FIO, req.Age, req.OverallExperience, req.SPExperience, req.JobTitleID, req.SubdivisionID).Scan(&employeeID)
+            fio, birth_date, job_title_id, subdivision_id, vacancy_id, submitted_by, duplicate_of
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+    `, req.FIO, birthDate, jobTitleID, subdivisionID, vacancyID, submittedBy, duplicateOf).Scan(&employeeID)
 	if err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into employee_bid"})
@@ -614,6 +1055,21 @@ func postRequest(c *gin.Context) {
 		return
 	}
 
+	if err := insertExperience(tx, "employee_experience_bid", employeeID, experience); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into employee_experience_bid"})
+		log.Printf("Failed to insert into employee_experience_bid: %v", err)
+		return
+	}
+
+	// Пустой пул рецензентов не мешает подаче: заявка просто останется неназначенной
+	if _, err := autoAssign(tx, employeeID, subdivisionID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign reviewer"})
+		log.Printf("Failed to assign reviewer: %v", err)
+		return
+	}
+
 	for _, lang := range req.Languages {
 		_, err := tx.Exec(`
             INSERT INTO employee_languages_bid (employee_id, language_id, proficiency)
@@ -640,218 +1096,502 @@ func postRequest(c *gin.Context) {
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Application submitted successfully"})
-}
-
-func acceptRequest(c *gin.Context) {
-	bidID := c.Param("id")
-
-	tx, err := db.Begin()
-	if err != nil {
-		log.Printf("Ошибка начала транзакции: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
-		return
-	}
-
-	var exists bool
-	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM employee_bid WHERE id = $1)", bidID).Scan(&exists)
-	if err != nil || !exists {
+	if err := insertAttachments(tx, employeeID, uploads, keys, nil); err != nil {
 		tx.Rollback()
-		log.Printf("Заявка с ID %s не найдена", bidID)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Заявка не найдена"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachments"})
+		log.Printf("Failed to save attachments: %v", err)
 		return
 	}
 
-	var employeeID int
-	err = tx.QueryRow(`
-        INSERT INTO employee (
-            fio, age, overall_experience, s_p_experience, job_title_id, subdivision_id
-        )
-        SELECT 
-            fio, age, overall_experience, s_p_experience, job_title_id, subdivision_id
-        FROM employee_bid
-        WHERE id = $1
-        RETURNING id
-    `, bidID).Scan(&employeeID)
+	err = publishBidEvent(tx, "bid.created", employeeID, gin.H{
+		"fio": req.FIO, "job_title_id": jobTitleID, "subdivision_id": subdivisionID, "duplicate_of": duplicateOf,
+	})
 	if err != nil {
 		tx.Rollback()
-		log.Printf("Ошибка копирования данных в таблицу employee: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy data into employee table"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish bid event"})
+		log.Printf("Failed to publish bid event: %v", err)
 		return
 	}
 
-	_, err = tx.Exec(`
-        INSERT INTO employee_languages (employee_id, language_id, proficiency)
-        SELECT 
-            $1, language_id, proficiency
-        FROM employee_languages_bid
-        WHERE employee_id = $2
-    `, employeeID, bidID)
+	err = writeOutbox(tx, "application.submitted", gin.H{
+		"bid_id": employeeID, "fio": req.FIO, "job_title_id": jobTitleID, "subdivision_id": subdivisionID, "vacancy_id": vacancyID,
+		"submitted_by": submittedBy,
+	})
 	if err != nil {
 		tx.Rollback()
-		log.Printf("Ошибка копирования данных в таблицу employee_languages: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy data into employee_languages table"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write outbox"})
+		log.Printf("Failed to write outbox: %v", err)
 		return
 	}
 
-	_, err = tx.Exec(`
-        INSERT INTO employee_education (employee_id, education_id, place)
-        SELECT 
-            $1, education_id, place
-        FROM employee_education_bid
-        WHERE employee_id = $2
-    `, employeeID, bidID)
-	if err != nil {
+	if err := snapshotBidStat(tx, employeeID); err != nil {
 		tx.Rollback()
-		log.Printf("Ошибка копирования данных в таблицу employee_education: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy data into employee_education table"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into bid_stat"})
+		log.Printf("Failed to insert into bid_stat: %v", err)
 		return
 	}
 
-	_, err = tx.Exec("DELETE FROM employee_languages_bid WHERE employee_id = $1", bidID)
-	if err != nil {
-		tx.Rollback()
-		log.Printf("Ошибка удаления данных из таблицы employee_languages_bid: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete data from employee_languages_bid table"})
+	if beforeCommit != nil {
+		if err := beforeCommit(tx); err != nil {
+			tx.Rollback()
+			if errors.Is(err, errDraftNotFound) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Draft has already been submitted"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finish application"})
+			log.Printf("Failed to finish application: %v", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+	committed = true
+
+	if duplicateOf != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Application submitted successfully",
+			"bid_id":       employeeID,
+			"warning":      "Похожая заявка уже подана",
+			"duplicate_of": *duplicateOf,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Application submitted successfully", "bid_id": employeeID})
+}
+
+// bidDecisionError — отказ в решении по заявке: HTTP-статус и тело ответа для клиента.
+type bidDecisionError struct {
+	status int
+	body   gin.H
+}
+
+func (e *bidDecisionError) Error() string {
+	return fmt.Sprint(e.body["error"])
+}
+
+func decisionFailed(status int, message string) error {
+	return &bidDecisionError{status: status, body: gin.H{"error": message}}
+}
+
+// respondDecision отвечает на запрос решения по заявке ошибкой из acceptBid или rejectBid.
+func respondDecision(c *gin.Context, err error) {
+	if e, ok := err.(*bidDecisionError); ok {
+		c.JSON(e.status, e.body)
 		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+}
+
+func acceptRequest(c *gin.Context) {
+	comment, err := readDecisionComment(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	// Сверх штата может принять только администратор с явным override=true
+	override := c.Query("override") == "true" && c.GetString("userRole") == "admin"
+
+	if _, err := acceptBid(c.Param("id"), userID, comment, override); err != nil {
+		respondDecision(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Application accepted successfully"})
+}
+
+// acceptBid переводит заявку в сотрудники от имени рецензента userID и возвращает id сотрудника.
+// Общая часть acceptRequest и кнопки «Принять» в Telegram; ошибки — *bidDecisionError.
+func acceptBid(bidID, userID, comment string, override bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Ошибка начала транзакции: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Database transaction error")
+	}
+	defer tx.Rollback()
+
+	var jobTitleID, subdivisionID int
+	var vacancyID sql.NullInt64
+	var status string
+	var submittedBy *string
+	err = tx.QueryRow("SELECT job_title_id, subdivision_id, vacancy_id, status, submitted_by FROM employee_bid WHERE id = $1 FOR UPDATE", bidID).Scan(&jobTitleID, &subdivisionID, &vacancyID, &status, &submittedBy)
+	if err != nil {
+		log.Printf("Заявка с ID %s не найдена", bidID)
+		return 0, decisionFailed(http.StatusBadRequest, "Заявка не найдена")
+	}
+	if status == "withdrawn" {
+		return 0, decisionFailed(http.StatusConflict, "Заявка отозвана заявителем")
+	}
+
+	err = checkHeadcount(tx, jobTitleID, subdivisionID, 0)
+	if err == nil && vacancyID.Valid {
+		err = checkVacancyCapacity(tx, int(vacancyID.Int64))
+	}
+	if err != nil {
+		full, ok := err.(*headcountError)
+		if !ok {
+			log.Printf("Ошибка проверки штатной численности: %v", err)
+			return 0, decisionFailed(http.StatusInternalServerError, "Failed to check headcount")
+		}
+		if !override {
+			return 0, &bidDecisionError{status: http.StatusConflict, body: full.response()}
+		}
+		log.Printf("Заявка с ID %s принимается сверх штата: %v", bidID, full)
+	}
+
+	var employeeID int
+	var fio string
+	err = tx.QueryRow(`
+        INSERT INTO employee (
+            fio, birth_date, hire_date, job_title_id, subdivision_id, vacancy_id
+        )
+        SELECT 
+            fio, birth_date, CURRENT_DATE, job_title_id, subdivision_id, vacancy_id
+        FROM employee_bid
+        WHERE id = $1
+        RETURNING id, fio
+    `, bidID).Scan(&employeeID, &fio)
+	if err != nil {
+		log.Printf("Ошибка копирования данных в таблицу employee: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to copy data into employee table")
+	}
+
+	_, err = tx.Exec("UPDATE bid_comment SET employee_id = $1 WHERE bid_id = $2", employeeID, bidID)
+	if err == nil {
+		err = recordDecision(tx, userID, bidID, &employeeID, "accepted", comment)
+	}
+	if err != nil {
+		log.Printf("Ошибка сохранения комментариев к заявке: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to save bid comments")
+	}
+
+	_, err = tx.Exec("UPDATE interview SET employee_id = $1 WHERE bid_id = $2", employeeID, bidID)
+	if err == nil {
+		err = cancelUpcomingInterviews(tx, bidID)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE attachment SET employee_id = $1 WHERE bid_id = $2", employeeID, bidID)
+	}
+	if err != nil {
+		log.Printf("Ошибка обновления собеседований: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to update interviews")
+	}
+
+	if vacancyID.Valid {
+		if err := closeFilledVacancy(tx, int(vacancyID.Int64)); err != nil {
+			log.Printf("Ошибка обновления вакансии: %v", err)
+			return 0, decisionFailed(http.StatusInternalServerError, "Failed to update vacancy")
+		}
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO employee_assignment (employee_id, job_title_id, subdivision_id, effective_from, kind)
+        SELECT id, job_title_id, subdivision_id, hire_date, 'hire'
+        FROM employee
+        WHERE id = $1
+    `, employeeID)
+	if err != nil {
+		log.Printf("Ошибка создания назначения сотрудника: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to create employee assignment")
+	}
+
+	// Текущая работа заявителя заканчивается днём приёма: дальше стаж идёт от hire_date
+	_, err = tx.Exec(`
+        INSERT INTO employee_experience (employee_id, started_on, ended_on, specialty)
+        SELECT 
+            $1, started_on, COALESCE(ended_on, (SELECT hire_date FROM employee WHERE id = $1)), specialty
+        FROM employee_experience_bid
+        WHERE employee_id = $2
+    `, employeeID, bidID)
+	if err != nil {
+		log.Printf("Ошибка копирования данных в таблицу employee_experience: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to copy data into employee_experience table")
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO employee_languages (employee_id, language_id, proficiency)
+        SELECT 
+            $1, language_id, proficiency
+        FROM employee_languages_bid
+        WHERE employee_id = $2
+    `, employeeID, bidID)
+	if err != nil {
+		log.Printf("Ошибка копирования данных в таблицу employee_languages: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to copy data into employee_languages table")
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO employee_education (employee_id, education_id, place)
+        SELECT 
+            $1, education_id, place
+        FROM employee_education_bid
+        WHERE employee_id = $2
+    `, employeeID, bidID)
+	if err != nil {
+		log.Printf("Ошибка копирования данных в таблицу employee_education: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to copy data into employee_education table")
+	}
+
+	_, err = tx.Exec("DELETE FROM employee_languages_bid WHERE employee_id = $1", bidID)
+	if err != nil {
+		log.Printf("Ошибка удаления данных из таблицы employee_languages_bid: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to delete data from employee_languages_bid table")
+	}
 
 	_, err = tx.Exec("DELETE FROM employee_education_bid WHERE employee_id = $1", bidID)
 	if err != nil {
-		tx.Rollback()
 		log.Printf("Ошибка удаления данных из таблицы employee_education_bid: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete data from employee_education_bid table"})
-		return
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to delete data from employee_education_bid table")
 	}
 
 	_, err = tx.Exec("DELETE FROM employee_bid WHERE id = $1", bidID)
 	if err != nil {
-		tx.Rollback()
 		log.Printf("Ошибка удаления данных из таблицы employee_bid: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete data from employee_bid table"})
-		return
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to delete data from employee_bid table")
+	}
+
+	id, _ := strconv.Atoi(bidID)
+	if err := publishBidEvent(tx, "bid.decided", id, gin.H{"decision": "accepted", "employee_id": employeeID}); err != nil {
+		log.Printf("Ошибка публикации события: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to publish bid event")
+	}
+
+	err = writeOutbox(tx, "employee.hired", gin.H{
+		"employee_id": employeeID, "bid_id": id, "fio": fio, "job_title_id": jobTitleID, "subdivision_id": subdivisionID,
+		"submitted_by": submittedBy,
+	})
+	if err != nil {
+		log.Printf("Ошибка записи в outbox: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to write outbox")
+	}
+
+	if err := closeBidStat(tx, id, "accepted"); err != nil {
+		log.Printf("Ошибка обновления статистики заявки: %v", err)
+		return 0, decisionFailed(http.StatusInternalServerError, "Failed to update bid_stat")
 	}
 
 	if err := tx.Commit(); err != nil {
 		log.Printf("Ошибка фиксации транзакции: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
-		return
+		return 0, decisionFailed(http.StatusInternalServerError, "Transaction commit failed")
 	}
 
 	log.Printf("Заявка с ID %s успешно принята", bidID)
-	c.JSON(http.StatusOK, gin.H{"message": "Application accepted successfully"})
+	return employeeID, nil
 }
 
 func denyRequest(c *gin.Context) {
-	bidID := c.Param("id")
+	comment, err := readDecisionComment(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
 
+	if err := rejectBid(c.Param("id"), userID, comment); err != nil {
+		respondDecision(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Application rejected successfully"})
+}
+
+// rejectBid отклоняет заявку от имени рецензента userID: общая часть denyRequest
+// и кнопки «Отклонить» в Telegram; ошибки — *bidDecisionError.
+func rejectBid(bidID, userID, comment string) error {
 	tx, err := db.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
-		return
+		return decisionFailed(http.StatusInternalServerError, "Database transaction error")
+	}
+	defer tx.Rollback()
+
+	var status, fio string
+	var submittedBy *string
+	err = tx.QueryRow("SELECT status, submitted_by, fio FROM employee_bid WHERE id = $1 FOR UPDATE", bidID).Scan(&status, &submittedBy, &fio)
+	if err == sql.ErrNoRows {
+		return decisionFailed(http.StatusNotFound, "Bid not found")
+	}
+	if err != nil {
+		return decisionFailed(http.StatusInternalServerError, "Database error")
+	}
+	// Отозванная заявка хранится как есть, отклонять и удалять её нечего
+	if status == "withdrawn" {
+		return decisionFailed(http.StatusConflict, "Заявка отозвана заявителем")
+	}
+
+	if err := recordDecision(tx, userID, bidID, nil, "rejected", comment); err != nil {
+		log.Printf("Ошибка сохранения комментария к решению: %v", err)
+		return decisionFailed(http.StatusInternalServerError, "Failed to save decision comment")
+	}
+
+	if err := cancelUpcomingInterviews(tx, bidID); err != nil {
+		log.Printf("Ошибка отмены собеседований: %v", err)
+		return decisionFailed(http.StatusInternalServerError, "Failed to cancel interviews")
+	}
+
+	attachmentKeys, err := detachRejectedAttachments(tx, bidID)
+	if err != nil {
+		log.Printf("Ошибка удаления вложений: %v", err)
+		return decisionFailed(http.StatusInternalServerError, "Failed to delete attachments")
 	}
 
 	_, err = tx.Exec("DELETE FROM employee_languages_bid WHERE employee_id = $1", bidID)
 	if err != nil {
-		tx.Rollback()
 		log.Printf("Ошибка удаления данных из таблицы employee_languages_bid: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete data from employee_languages_bid table"})
-		return
+		return decisionFailed(http.StatusInternalServerError, "Failed to delete data from employee_languages_bid table")
 	}
 
 	_, err = tx.Exec("DELETE FROM employee_education_bid WHERE employee_id = $1", bidID)
 	if err != nil {
-		tx.Rollback()
 		log.Printf("Ошибка удаления данных из таблицы employee_education_bid: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete data from employee_education_bid table"})
-		return
+		return decisionFailed(http.StatusInternalServerError, "Failed to delete data from employee_education_bid table")
 	}
 
 	_, err = tx.Exec("DELETE FROM employee_bid WHERE id = $1", bidID)
 	if err != nil {
-		tx.Rollback()
 		log.Printf("Ошибка удаления данных из таблицы employee_bid: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete data from employee_bid table"})
-		return
+		return decisionFailed(http.StatusInternalServerError, "Failed to delete data from employee_bid table")
+	}
+
+	if status != "" {
+		id, _ := strconv.Atoi(bidID)
+		if err := publishBidEvent(tx, "bid.decided", id, gin.H{"decision": "rejected"}); err != nil {
+			log.Printf("Ошибка публикации события: %v", err)
+			return decisionFailed(http.StatusInternalServerError, "Failed to publish bid event")
+		}
+		if err := writeOutbox(tx, "application.rejected", gin.H{"bid_id": id, "fio": fio, "submitted_by": submittedBy}); err != nil {
+			log.Printf("Ошибка записи в outbox: %v", err)
+			return decisionFailed(http.StatusInternalServerError, "Failed to write outbox")
+		}
+		if err := closeBidStat(tx, id, "rejected"); err != nil {
+			log.Printf("Ошибка обновления статистики заявки: %v", err)
+			return decisionFailed(http.StatusInternalServerError, "Failed to update bid_stat")
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
-		return
+		return decisionFailed(http.StatusInternalServerError, "Transaction commit failed")
 	}
+	removeBlobs(attachmentKeys)
+	return nil
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Application rejected successfully"})
+var employeeSortColumns = map[string]string{
+	"id":                 "id",
+	"fio":                "fio",
+	"age":                "age",
+	"job_title_id":       "job_title_id",
+	"subdivision_id":     "subdivision_id",
+	"overall_experience": "overall_experience",
+	"s_p_experience":     "s_p_experience",
+	"birth_date":         "birth_date",
+	"hire_date":          "hire_date",
 }
 
 func GetEmployees(c *gin.Context) {
-	id := c.Query("id")
-	fio := c.Query("fio")
-	age := c.Query("age")
-	jobTitle := c.Query("job_title_id")
-	subdivision := c.Query("subdivision_id")
-	overall := c.Query("overall_experience")
-	s_p := c.Query("s_p_experience")
-
-	query := `
-        SELECT 
-            id, fio, age, job_title_id, subdivision_id, overall_experience, s_p_experience
-        FROM employee
-        WHERE 1=1
-    `
-	args := []interface{}{}
-
-	if id != "" {
-		query += " AND id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, id)
+	qb := &queryBuilder{}
+
+	// ?as_of=YYYY-MM-DD подставляет должность и подразделение из назначения, действовавшего
+	// на эту дату, и оставляет только тех, кто в тот день уже работал
+	source := "employee_computed"
+	if asOf := c.Query("as_of"); asOf != "" {
+		if _, err := time.Parse(dateLayout, asOf); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid as_of"})
+			return
+		}
+		ph := qb.arg(asOf)
+		source = `(
+            SELECT e.id, e.fio, e.age, a.job_title_id, a.subdivision_id,
+                e.overall_experience, e.s_p_experience, e.birth_date, e.hire_date
+            FROM employee_computed e
+            JOIN employee_assignment a ON a.employee_id = e.id
+                AND a.effective_from <= ` + ph + `::date
+                AND (a.effective_to IS NULL OR a.effective_to > ` + ph + `::date)
+        ) AS employee_computed`
+	}
+
+	if id := c.Query("id"); id != "" {
+		qb.where("id = %s", id)
+	}
+	if fio := c.Query("fio"); fio != "" {
+		qb.where("fio ILIKE %s", "%"+fio+"%")
+	}
+	for _, f := range []struct{ column, param string }{
+		{"age", "age"},
+		{"overall_experience", "overall_experience"},
+		{"s_p_experience", "s_p_experience"},
+	} {
+		if err := qb.rangeFilter(c, f.column, f.param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
-
-	if fio != "" {
-		query += " AND fio ILIKE $1"
-		args = append(args, "%"+fio+"%")
+	if err := qb.inFilter(c, "job_title_id", "job_title_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if age != "" {
-		query += " AND age = $" + strconv.Itoa(len(args)+1)
-		args = append(args, age)
+	if err := qb.subdivisionFilter(c, "subdivision_id", "subdivision_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if jobTitle != "" {
-		query += " AND job_title_id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, jobTitle)
+	scope, err := loadEmployeeScope(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
-	if subdivision != "" {
-		query += " AND subdivision_id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, subdivision)
+	scope.apply(qb, "id")
+
+	sortKeys, err := parseSort(c.Query("sort"), employeeSortColumns)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if overall != "" {
-		query += " AND overall_experience = $" + strconv.Itoa(len(args)+1)
-		args = append(args, overall)
+	page, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if s_p != "" {
-		query += " AND s_p_experience = $" + strconv.Itoa(len(args)+1)
-		args = append(args, s_p)
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+source+qb.whereSQL(), qb.args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	rows, err := db.Query(query, args...)
+	if page.Cursor != "" {
+		values, err := decodeCursor(page.Cursor, sortKeys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		qb.afterCursor(sortKeys, values)
+	}
+
+	query := `
+        SELECT 
+            id, fio, age, job_title_id, subdivision_id, overall_experience, s_p_experience, birth_date, hire_date
+        FROM ` + source + qb.whereSQL() + orderSQL(sortKeys) +
+		" LIMIT " + qb.arg(page.Limit) + " OFFSET " + qb.arg(page.Offset)
+
+	rows, err := db.Query(query, qb.args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	defer rows.Close()
 
-	var employees []map[string]interface{}
+	employees := []map[string]interface{}{}
 	for rows.Next() {
 		var employee struct {
 			ID                int    `db:"id"`
 			FIO               string `db:"fio"`
-			Age               int    `db:"age"`
+			Age               *int   `db:"age"`
 			JobTitleID        int    `db:"job_title_id"`
 			SubdivisionID     int    `db:"subdivision_id"`
 			OverallExperience int    `db:"overall_experience"`
 			SPExperience      int    `db:"s_p_experience"`
+			BirthDate         sql.NullTime
+			HireDate          sql.NullTime
 		}
 
 		if err := rows.Scan(
@@ -862,6 +1602,8 @@ func GetEmployees(c *gin.Context) {
 			&employee.SubdivisionID,
 			&employee.OverallExperience,
 			&employee.SPExperience,
+			&employee.BirthDate,
+			&employee.HireDate,
 		); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employees"})
 			return
@@ -875,6 +1617,8 @@ func GetEmployees(c *gin.Context) {
 			"subdivision_id":     employee.SubdivisionID,
 			"overall_experience": employee.OverallExperience,
 			"s_p_experience":     employee.SPExperience,
+			"birth_date":         formatDate(employee.BirthDate),
+			"hire_date":          formatDate(employee.HireDate),
 		})
 	}
 
@@ -883,30 +1627,46 @@ func GetEmployees(c *gin.Context) {
 		return
 	}
 
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if len(employees) == page.Limit {
+		last := employees[len(employees)-1]
+		values := make([]interface{}, len(sortKeys))
+		for i, k := range sortKeys {
+			values[i] = last[k.Column]
+		}
+		c.Header("X-Next-Cursor", encodeCursor(values))
+	}
+
 	c.JSON(http.StatusOK, employees)
 }
 
-func GetEmployeeByID(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
-		return
-	}
+type EmployeeRecord struct {
+	ID                int                `json:"id"`
+	FIO               string             `json:"fio"`
+	Age               *int               `json:"age"`
+	BirthDate         interface{}        `json:"birth_date"`
+	HireDate          interface{}        `json:"hire_date"`
+	JobTitleID        int                `json:"job_title_id"`
+	SubdivisionID     int                `json:"subdivision_id"`
+	ManagerID         *int               `json:"manager_id"`
+	OverallExperience int                `json:"overall_experience"`
+	SPExperience      int                `json:"s_p_experience"`
+	Experience        []ExperiencePeriod `json:"experience"`
+}
 
-	var employee struct {
-		ID                int    `db:"id" json:"id"`
-		FIO               string `db:"fio" json:"fio"`
-		Age               int    `db:"age" json:"age"`
-		JobTitleID        int    `db:"job_title_id" json:"job_title_id"`
-		SubdivisionID     int    `db:"subdivision_id" json:"subdivision_id"`
-		OverallExperience int    `db:"overall_experience" json:"overall_experience"`
-		SPExperience      int    `db:"s_p_experience" json:"s_p_experience"`
-	}
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
 
-	err := db.QueryRow(`
+func loadEmployee(q queryer, id string) (*EmployeeRecord, error) {
+	var employee EmployeeRecord
+	var birthDate, hireDate sql.NullTime
+	err := q.QueryRow(`
         SELECT 
-        id, fio, age, job_title_id, subdivision_id, overall_experience, s_p_experience
-        FROM employee
+        id, fio, age, job_title_id, subdivision_id, overall_experience, s_p_experience, birth_date, hire_date,
+        (SELECT manager_id FROM employee WHERE employee.id = employee_computed.id)
+        FROM employee_computed
         WHERE id = $1
     `, id).Scan(
 		&employee.ID,
@@ -916,8 +1676,55 @@ func GetEmployeeByID(c *gin.Context) {
 		&employee.SubdivisionID,
 		&employee.OverallExperience,
 		&employee.SPExperience,
+		&birthDate,
+		&hireDate,
+		&employee.ManagerID,
 	)
+	if err != nil {
+		return nil, err
+	}
+	employee.BirthDate = formatDate(birthDate)
+	employee.HireDate = formatDate(hireDate)
+
+	rows, err := q.Query(`
+        SELECT started_on, ended_on, specialty
+        FROM employee_experience
+        WHERE employee_id = $1
+        ORDER BY started_on
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	employee.Experience = []ExperiencePeriod{}
+	for rows.Next() {
+		var started sql.NullTime
+		var ended sql.NullTime
+		var period ExperiencePeriod
+		if err := rows.Scan(&started, &ended, &period.Specialty); err != nil {
+			return nil, err
+		}
+		period.StartedOn = started.Time.Format(dateLayout)
+		if ended.Valid {
+			period.EndedOn = ended.Time.Format(dateLayout)
+		}
+		employee.Experience = append(employee.Experience, period)
+	}
+	return &employee, rows.Err()
+}
+
+func GetEmployeeByID(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
+		return
+	}
+	if !checkEmployeeScope(c, id) {
+		return
+	}
 
+	employee, err := loadEmployee(db, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
@@ -934,18 +1741,20 @@ func editEmployees(c *gin.Context) {
 	id := c.Param("id")
 
 	type UpdateEmployee struct {
-		FIO               string `json:"fio" binding:"required"`
-		Age               int    `json:"age" binding:"min=0"`
-		JobTitleID        int    `json:"job_title_id" binding:"required,min=1"`
-		SubdivisionID     int    `json:"subdivision_id" binding:"required,min=1"`
-		OverallExperience int    `json:"overall_experience" binding:"min=0"`
-		SPExperience      int    `json:"s_p_experience" binding:"min=0"`
+		personDates
+		FIO           string `json:"fio" binding:"required"`
+		HireDate      string `json:"hire_date"`
+		JobTitleID    int    `json:"job_title_id" binding:"required,min=1"`
+		SubdivisionID int    `json:"subdivision_id" binding:"required,min=1"`
 	}
 
 	if id == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
 		return
 	}
+	if !checkEmployeeScope(c, id) {
+		return
+	}
 
 	var employee UpdateEmployee
 	if err := c.ShouldBindJSON(&employee); err != nil {
@@ -953,65 +1762,130 @@ func editEmployees(c *gin.Context) {
 		return
 	}
 
-	query := `
-        UPDATE employee 
-        SET 
-            fio = $1,
-            age = $2,
-            job_title_id = $3,
-            subdivision_id = $4,
-            overall_experience = $5,
-            s_p_experience = $6
-        WHERE id = $7
-        RETURNING *
-    `
+	now := time.Now()
+	birthDate, experience, err := employee.resolve(now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var hireDate *time.Time
+	if employee.HireDate != "" {
+		d, err := time.Parse(dateLayout, employee.HireDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hire_date"})
+			return
+		}
+		hireDate = &d
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := loadEmployee(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
-	var updatedEmployee struct {
-		ID                int    `db:"id"`
-		FIO               string `db:"fio"`
-		Age               int    `db:"age"`
-		JobTitleID        int    `db:"job_title_id"`
-		SubdivisionID     int    `db:"subdivision_id"`
-		OverallExperience int    `db:"overall_experience"`
-		SPExperience      int    `db:"s_p_experience"`
+	// Форма редактирования присылает вычисленные age / стаж обратно как есть;
+	// неизменённые значения не должны сдвигать сохранённые даты.
+	if employee.BirthDate == "" && employee.Age != nil && current.Age != nil && *employee.Age == *current.Age {
+		birthDate = nil
+	}
+	replaceExperience := employee.Experience != nil
+	if !replaceExperience && (employee.OverallExperience != nil || employee.SPExperience != nil) {
+		overall, sp := current.OverallExperience, current.SPExperience
+		if employee.OverallExperience != nil {
+			overall = *employee.OverallExperience
+		}
+		if employee.SPExperience != nil {
+			sp = *employee.SPExperience
+		}
+		if overall != current.OverallExperience || sp != current.SPExperience {
+			// Стаж в компании считается от hire_date, поэтому прежний стаж заканчивается датой приёма
+			hired := now
+			if hireDate != nil {
+				hired = *hireDate
+			} else if s, ok := current.HireDate.(string); ok {
+				hired, _ = time.Parse(dateLayout, s)
+			}
+			tenure := int(now.Sub(hired).Hours() / 24 / 365.25)
+			experience = legacyExperience(max(overall-tenure, 0), max(sp-tenure, 0), hired)
+			replaceExperience = true
+		}
+	}
+
+	// Смена должности или подразделения через форму редактирования — перевод с сегодняшнего дня
+	if employee.JobTitleID != current.JobTitleID || employee.SubdivisionID != current.SubdivisionID {
+		err := reassign(tx, current.ID, employee.JobTitleID, employee.SubdivisionID, now, "transfer", "")
+		if full, ok := err.(*headcountError); ok {
+			c.JSON(http.StatusConflict, full.response())
+			return
+		}
+		if err != nil && err != errSamePosition {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record transfer"})
+			return
+		}
 	}
 
-	err := db.QueryRow(query,
+	result, err := tx.Exec(`
+        UPDATE employee 
+        SET 
+            fio = $1,
+            birth_date = COALESCE($2, birth_date),
+            hire_date = COALESCE($3, hire_date),
+            job_title_id = $4,
+            subdivision_id = $5
+        WHERE id = $6
+    `,
 		employee.FIO,
-		employee.Age,
+		birthDate,
+		hireDate,
 		employee.JobTitleID,
 		employee.SubdivisionID,
-		employee.OverallExperience,
-		employee.SPExperience,
 		id,
-	).Scan(
-		&updatedEmployee.ID,
-		&updatedEmployee.FIO,
-		&updatedEmployee.Age,
-		&updatedEmployee.JobTitleID,
-		&updatedEmployee.SubdivisionID,
-		&updatedEmployee.OverallExperience,
-		&updatedEmployee.SPExperience,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	if replaceExperience {
+		if _, err := tx.Exec("DELETE FROM employee_experience WHERE employee_id = $1", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from employee_experience"})
+			return
+		}
+		employeeID, _ := strconv.Atoi(id)
+		if err := insertExperience(tx, "employee_experience", employeeID, experience); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into employee_experience"})
 			return
 		}
+	}
+
+	updatedEmployee, err := loadEmployee(tx, id)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":                 updatedEmployee.ID,
-		"fio":                updatedEmployee.FIO,
-		"age":                updatedEmployee.Age,
-		"job_title_id":       updatedEmployee.JobTitleID,
-		"subdivision_id":     updatedEmployee.SubdivisionID,
-		"overall_experience": updatedEmployee.OverallExperience,
-		"s_p_experience":     updatedEmployee.SPExperience,
-	})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updatedEmployee)
 }
 
 func deleteEmployees(c *gin.Context) {
@@ -1020,6 +1894,9 @@ func deleteEmployees(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
 		return
 	}
+	if !checkEmployeeScope(c, id) {
+		return
+	}
 
 	tx, err := db.Begin()
 	if err != nil {
@@ -1040,23 +1917,55 @@ func deleteEmployees(c *gin.Context) {
 		return
 	}
 
-	result, err := tx.Exec("DELETE FROM employee WHERE id = $1", id)
+	documentKeys, err := deleteEmployeeDocuments(tx, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from employee_document"})
+		return
+	}
+
+	attachmentKeys, err := deleteEmployeeAttachments(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachments"})
+		return
+	}
+
+	// Подчинённые удаляемого сотрудника переходят к его руководителю
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock(hashtext('employee_reporting'))")
+	if err == nil {
+		_, err = tx.Exec("UPDATE employee SET manager_id = (SELECT manager_id FROM employee WHERE id = $1) WHERE manager_id = $1", id)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign reports"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	var employeeID, jobTitleID, subdivisionID int
+	var fio string
+	err = tx.QueryRow("DELETE FROM employee WHERE id = $1 RETURNING id, fio, job_title_id, subdivision_id", id).Scan(&employeeID, &fio, &jobTitleID, &subdivisionID)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	err = writeOutbox(tx, "employee.deleted", gin.H{
+		"employee_id": employeeID, "fio": fio, "job_title_id": jobTitleID, "subdivision_id": subdivisionID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write outbox"})
+		return
+	}
 
 	err = tx.Commit()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
 		return
 	}
+	removeBlobs(documentKeys)
+	removeBlobs(attachmentKeys)
 
 	c.Status(http.StatusNoContent)
 }
@@ -1079,7 +1988,7 @@ func GetJobTitles(c *gin.Context) {
 	}
 
 	if name != "" {
-		query += " AND name ILIKE $1"
+		query += " AND name ILIKE $" + strconv.Itoa(len(args)+1)
 		args = append(args, "%"+name+"%")
 	}
 	if count != "" {
@@ -1099,7 +2008,7 @@ func GetJobTitles(c *gin.Context) {
 		var job_title struct {
 			ID    int    `db:"id"`
 			Name  string `db:"name"`
-			Count int    `db:"count"`
+			Count *int   `db:"count"`
 		}
 
 		if err := rows.Scan(
@@ -1126,28 +2035,22 @@ func GetJobTitles(c *gin.Context) {
 	c.JSON(http.StatusOK, job_titles)
 }
 
+// GetSubdivisions — ?id= (с ?include_descendants=true — вместе с вложенными), ?name=, ?parent_id=.
 func GetSubdivisions(c *gin.Context) {
-	id := c.Query("id")
-	name := c.Query("name")
-
-	query := `
-        SELECT id, name
-        FROM subdivision
-        WHERE 1=1
-    `
-	args := []interface{}{}
-
-	if id != "" {
-		query += " AND id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, id)
+	qb := &queryBuilder{}
+	if err := qb.subdivisionFilter(c, "id", "id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	if name != "" {
-		query += " AND name ILIKE $1"
-		args = append(args, "%"+name+"%")
+	if name := c.Query("name"); name != "" {
+		qb.where("name ILIKE %s", "%"+name+"%")
+	}
+	if err := qb.inFilter(c, "parent_id", "parent_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.Query("SELECT id, name, parent_id, head_employee_id FROM subdivision"+qb.whereSQL()+" ORDER BY id", qb.args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -1157,21 +2060,27 @@ func GetSubdivisions(c *gin.Context) {
 	var subdivisions []map[string]interface{}
 	for rows.Next() {
 		var subdivision struct {
-			ID   int    `db:"id"`
-			Name string `db:"name"`
+			ID             int    `db:"id"`
+			Name           string `db:"name"`
+			ParentID       *int   `db:"parent_id"`
+			HeadEmployeeID *int   `db:"head_employee_id"`
 		}
 
 		if err := rows.Scan(
 			&subdivision.ID,
 			&subdivision.Name,
+			&subdivision.ParentID,
+			&subdivision.HeadEmployeeID,
 		); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan subdivisions"})
 			return
 		}
 
 		subdivisions = append(subdivisions, map[string]interface{}{
-			"id":   subdivision.ID,
-			"name": subdivision.Name,
+			"id":               subdivision.ID,
+			"name":             subdivision.Name,
+			"parent_id":        subdivision.ParentID,
+			"head_employee_id": subdivision.HeadEmployeeID,
 		})
 	}
 
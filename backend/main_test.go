@@ -9,52 +9,35 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/chromedp/chromedp"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
 )
 
 func TestPostRequest(t *testing.T) {
-	connStr := "user=postgres dbname=Cursovoy sslmode=disable password=Djcmvfv583746 host=localhost port=5432"
-	var err error
-	db, err = sql.Open("postgres", connStr)
-	if err != nil {
-		log.Fatalf("Ошибка при подключении к базе данных: %v", err)
-	}
-	defer db.Close()
-
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Ошибка Ping: %v", err)
-	}
-
-	fmt.Println("Подключение к PostgreSQL успешно!")
-
-	// Установка режима тестирования для Gin
-	gin.SetMode(gin.TestMode)
+	openTestDB(t)
+	job, sub, _ := testPosition(t, nil)
+	testVacancy(t, job, sub, 1, time.Now().AddDate(0, 0, -1), "open")
+	fio := fmt.Sprint("Тестовый Тест ", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM bid_stat WHERE bid_id IN (SELECT id FROM employee_bid WHERE fio = $1)", fio)
+		db.Exec("DELETE FROM employee_bid WHERE fio = $1", fio)
+	})
 
 	// Подготовка тестовых данных
 	reqBody := map[string]interface{}{
-		"fio":                "Тестовый Тест Тестович",
+		"fio":                fio,
 		"overall_experience": 7,
 		"s_p_experience":     5,
-		"job_title_id":       1,
-		"subdivision_id":     2,
-		"languages": []map[string]interface{}{
-			{
-				"language_id": 1,
-				"proficiency": "B2",
-			},
-		},
-		"educations": []map[string]interface{}{
-			{
-				"education_id": 1,
-				"place":        "Тестовый университет",
-			},
-		},
+		"job_title_id":       job,
+		"subdivision_id":     sub,
 	}
 
 	body, _ := json.Marshal(reqBody)
@@ -70,7 +53,7 @@ func TestPostRequest(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Создание нового маршрутизатора Gin
-	router := gin.Default()
+	router := gin.New()
 	router.POST("/api/submit-application", postRequest)
 
 	// Выполнение запроса
@@ -78,20 +61,25 @@ func TestPostRequest(t *testing.T) {
 
 	// Проверка статус кода
 	if status := w.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s",
+			status, http.StatusOK, w.Body)
 	}
 
 	// Проверка тела ответа
-	expected := `{"message":"Application submitted successfully"}`
-	if w.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			w.Body.String(), expected)
+	var resp struct {
+		Message string `json:"message"`
+		BidID   int    `json:"bid_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message != "Application submitted successfully" || resp.BidID <= 0 {
+		t.Errorf("handler returned unexpected body: %s", w.Body)
 	}
 
 	// Дополнительно проверяем, что данные действительно были добавлены в базу данных
 	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM employee_bid WHERE fio = $1", "Тестовый Тест Тестович").Scan(&count)
+	err = db.QueryRow("SELECT COUNT(*) FROM employee_bid WHERE fio = $1", fio).Scan(&count)
 	if err != nil {
 		t.Fatalf("Database query error: %v", err)
 	}
@@ -186,3 +174,384 @@ func TestE2EFlow(t *testing.T) {
 
 	log.Print("Тест прошёл успешно!")
 }
+
+// openTestDB подключает глобальный db к тестовой базе и применяет миграции;
+// без PostgreSQL тест пропускается.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	connStr := "user=postgres dbname=Cursovoy sslmode=disable password=Djcmvfv583746 host=localhost port=5432"
+	var err error
+	db, err = sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Skipf("PostgreSQL недоступен: %v", err)
+	}
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+}
+
+// TestEmployeeScopeRoutes проходит по маршрутам с сотрудниками от имени пользователя
+// со scope = own: чужой сотрудник не должен быть виден ни напрямую, ни в списках.
+func TestEmployeeScopeRoutes(t *testing.T) {
+	openTestDB(t)
+	var err error
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	inFIO, outFIO := "Областной Внутренний "+suffix, "Областной Внешний "+suffix
+
+	var ownSub, otherSub, me, inside, outside int
+	var userID string
+	steps := []struct {
+		query string
+		args  []interface{}
+		dest  interface{}
+	}{
+		{"INSERT INTO subdivision (name) VALUES ($1) RETURNING id", []interface{}{"Свой " + suffix}, &ownSub},
+		{"INSERT INTO subdivision (name) VALUES ($1) RETURNING id", []interface{}{"Чужой " + suffix}, &otherSub},
+	}
+	for _, s := range steps {
+		if err := db.QueryRow(s.query, s.args...).Scan(s.dest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer db.Exec("DELETE FROM subdivision WHERE id = ANY($1)", pq.Array([]int{ownSub, otherSub}))
+
+	for _, e := range []struct {
+		fio  string
+		sub  int
+		dest *int
+	}{{"Руководитель " + suffix, ownSub, &me}, {inFIO, ownSub, &inside}, {outFIO, otherSub, &outside}} {
+		err := db.QueryRow(`
+            INSERT INTO employee (fio, birth_date, hire_date, job_title_id, subdivision_id)
+            VALUES ($1, '1990-01-01', CURRENT_DATE, 1, $2) RETURNING id
+        `, e.fio, e.sub).Scan(e.dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer db.Exec("DELETE FROM employee WHERE id = ANY($1)", pq.Array([]int{me, inside, outside}))
+	db.Exec("UPDATE subdivision SET head_employee_id = $1 WHERE id = $2", outside, otherSub)
+
+	err = db.QueryRow(`
+        INSERT INTO users (email, username, password_hash, role, registration_date, ip_address, employee_id, employee_scope)
+        VALUES ($1, $1, '-', 'employee', NOW(), '127.0.0.1', $2, 'own') RETURNING id::text
+    `, "scope"+suffix+"@example.com", me).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM users WHERE id::text = $1", userID)
+
+	const secret = "test-secret"
+	token, err := GenerateJWT(userID, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	staff := []gin.HandlerFunc{AuthMiddleware(secret), RoleMiddleware("employee", "admin")}
+	for _, route := range []struct {
+		method, path string
+		handler      gin.HandlerFunc
+	}{
+		{"GET", "/api/employees/get", GetEmployees},
+		{"GET", "/api/employees/:id", GetEmployeeByID},
+		{"PUT", "/api/employees/:id", editEmployees},
+		{"DELETE", "/api/employees/:id", deleteEmployees},
+		{"POST", "/api/employees/:id/transfer", transferEmployee},
+		{"GET", "/api/employees/:id/history", GetEmployeeHistory},
+		{"GET", "/api/employees/:id/reports", GetEmployeeReports},
+		{"GET", "/api/employees/:id/comments", GetEmployeeComments},
+		{"GET", "/api/employees/:id/attachments", GetEmployeeAttachments},
+		{"GET", "/api/employees/:id/documents", GetEmployeeDocuments},
+		{"POST", "/api/employees/:id/documents", generateEmployeeDocument},
+		{"GET", "/api/subdivisions/:id/employees", GetSubdivisionEmployees},
+		{"GET", "/api/org-chart", GetOrgChart},
+		{"GET", "/api/search", SearchHandler},
+		{"GET", "/api/bids/:id/comments", GetBidComments},
+		{"GET", "/api/bids/:id/attachments", GetBidAttachments},
+	} {
+		r.Handle(route.method, route.path, append(staff, route.handler)...)
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "authToken", Value: token})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Принятая заявка чужого сотрудника: комментарии и вложения по номеру заявки тоже закрыты
+	acceptedBid := -outside
+	if _, err := db.Exec(`
+        INSERT INTO bid_comment (bid_id, employee_id, author_id, body, decision) VALUES ($1, $2, $3, 'ok', 'accepted')
+    `, acceptedBid, outside, userID); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM bid_comment WHERE bid_id = $1", acceptedBid)
+
+	out := fmt.Sprint(outside)
+	for _, tc := range []struct{ method, path, body string }{
+		{"GET", "/api/employees/" + out, ""},
+		{"PUT", "/api/employees/" + out, `{"fio":"x","job_title_id":1,"subdivision_id":1}`},
+		{"DELETE", "/api/employees/" + out, ""},
+		{"POST", "/api/employees/" + out + "/transfer", fmt.Sprintf(`{"job_title_id":1,"subdivision_id":%d}`, ownSub)},
+		{"GET", "/api/employees/" + out + "/history", ""},
+		{"GET", "/api/employees/" + out + "/reports", ""},
+		{"GET", "/api/employees/" + out + "/comments", ""},
+		{"GET", "/api/employees/" + out + "/attachments", ""},
+		{"GET", "/api/employees/" + out + "/documents", ""},
+		{"POST", "/api/employees/" + out + "/documents", `{"kind":"personal_card","format":"docx"}`},
+		{"GET", fmt.Sprintf("/api/bids/%d/comments", acceptedBid), ""},
+		{"GET", fmt.Sprintf("/api/bids/%d/attachments", acceptedBid), ""},
+	} {
+		if w := do(tc.method, tc.path, tc.body); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: got %d, want 403: %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+	for _, path := range []string{"/api/employees/abc/history", "/api/employees/abc/attachments", "/api/bids/abc/attachments"} {
+		if w := do("GET", path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: got %d, want 400: %s", path, w.Code, w.Body.String())
+		}
+	}
+	if w := do("GET", fmt.Sprintf("/api/employees/%d", inside), ""); w.Code != http.StatusOK {
+		t.Errorf("own employee: got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{
+		"/api/employees/get?fio=" + url.QueryEscape("Областной"),
+		"/api/search?type=employees&q=" + url.QueryEscape("Областной "+suffix),
+		fmt.Sprintf("/api/subdivisions/%d/employees", otherSub),
+		fmt.Sprintf("/api/org-chart?root=%d", otherSub),
+	} {
+		w := do("GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: got %d: %s", path, w.Code, w.Body.String())
+			continue
+		}
+		if strings.Contains(w.Body.String(), outFIO) {
+			t.Errorf("GET %s leaks an out-of-scope employee: %s", path, w.Body.String())
+		}
+	}
+}
+
+// testPosition создаёт должность со штатной численностью count (nil — без ограничения)
+// и два подразделения; всё удаляется после теста.
+func testPosition(t *testing.T, count *int) (jobTitleID, subA, subB int) {
+	t.Helper()
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	if err := db.QueryRow("INSERT INTO job_title (name, count) VALUES ($1, $2) RETURNING id", "Должность "+suffix, count).Scan(&jobTitleID); err != nil {
+		t.Fatal(err)
+	}
+	for i, dest := range []*int{&subA, &subB} {
+		if err := db.QueryRow("INSERT INTO subdivision (name) VALUES ($1) RETURNING id", fmt.Sprintf("Отдел %d %s", i+1, suffix)).Scan(dest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM subdivision WHERE id = ANY($1)", pq.Array([]int{subA, subB}))
+		db.Exec("DELETE FROM job_title WHERE id = $1", jobTitleID)
+	})
+	return jobTitleID, subA, subB
+}
+
+// testEmployee принимает сотрудника на должность с открытым назначением месячной давности.
+func testEmployee(t *testing.T, jobTitleID, subdivisionID int) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO employee (fio, birth_date, hire_date, job_title_id, subdivision_id)
+        VALUES ($1, '1990-01-01', CURRENT_DATE - 30, $2, $3) RETURNING id
+    `, fmt.Sprint("Тестовый ", time.Now().UnixNano()), jobTitleID, subdivisionID).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM employee WHERE id = $1", id) })
+	_, err = db.Exec(`
+        INSERT INTO employee_assignment (employee_id, job_title_id, subdivision_id, effective_from)
+        VALUES ($1, $2, $3, CURRENT_DATE - 30)
+    `, id, jobTitleID, subdivisionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestEmployeesCursorOverNulls(t *testing.T) {
+	openTestDB(t)
+	job, sub, _ := testPosition(t, nil)
+	want := map[int]bool{}
+	for _, birth := range []interface{}{nil, "1985-05-05", nil, "1995-05-05"} {
+		id := testEmployee(t, job, sub)
+		if _, err := db.Exec("UPDATE employee SET birth_date = $1, hire_date = NULL WHERE id = $2", birth, id); err != nil {
+			t.Fatal(err)
+		}
+		want[id] = true
+	}
+
+	r := gin.New()
+	r.GET("/api/employees/get", GetEmployees)
+	for _, sort := range []string{"birth_date", "-birth_date", "hire_date,-id"} {
+		seen := map[int]bool{}
+		cursor := ""
+		for page := 0; page <= len(want); page++ {
+			q := url.Values{"subdivision_id": {fmt.Sprint(sub)}, "sort": {sort}, "limit": {"1"}, "cursor": {cursor}}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/api/employees/get?"+q.Encode(), nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("sort=%s: статус %d: %s", sort, w.Code, w.Body)
+			}
+			var rows []struct {
+				ID int `json:"id"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range rows {
+				if seen[row.ID] {
+					t.Errorf("sort=%s: сотрудник %d выдан повторно", sort, row.ID)
+				}
+				seen[row.ID] = true
+			}
+			if cursor = w.Header().Get("X-Next-Cursor"); cursor == "" {
+				break
+			}
+		}
+		if len(seen) != len(want) {
+			t.Errorf("sort=%s: пройдено %d сотрудников из %d", sort, len(seen), len(want))
+		}
+	}
+}
+
+func TestDistributionUnknownAge(t *testing.T) {
+	openTestDB(t)
+	job, sub, _ := testPosition(t, nil)
+	testEmployee(t, job, sub)
+	unknown := testEmployee(t, job, sub)
+	if _, err := db.Exec("UPDATE employee SET birth_date = NULL WHERE id = $1", unknown); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, err := loadEmployee(db, fmt.Sprint(unknown)); err != nil || e.Age != nil {
+		t.Fatalf("возраст без даты рождения должен быть NULL: %+v, %v", e, err)
+	}
+
+	r := gin.New()
+	r.GET("/api/analytics/distributions", GetDistributionStats)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/analytics/distributions?source=employees&subdivision_id=%d", sub), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("статус %d: %s", w.Code, w.Body)
+	}
+	var got struct {
+		Total      int                  `json:"total"`
+		Age        []DistributionBucket `json:"age"`
+		AgeUnknown int                  `json:"age_unknown"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	inBuckets := 0
+	for _, b := range got.Age {
+		inBuckets += b.Count
+	}
+	if got.Total != 2 || got.AgeUnknown != 1 || inBuckets != 1 {
+		t.Errorf("total=%d, age_unknown=%d, в корзинах %d; ожидалось 2, 1, 1", got.Total, got.AgeUnknown, inBuckets)
+	}
+}
+
+func TestSubdivisionEmployeesDescendants(t *testing.T) {
+	openTestDB(t)
+	job, parent, child := testPosition(t, nil)
+	if _, err := db.Exec("UPDATE subdivision SET parent_id = $1 WHERE id = $2", parent, child); err != nil {
+		t.Fatal(err)
+	}
+	direct := testEmployee(t, job, parent)
+	nested := testEmployee(t, job, child)
+
+	r := gin.New()
+	r.GET("/api/subdivisions/:id/employees", GetSubdivisionEmployees)
+	for query, want := range map[string][]int{
+		"":                          {direct},
+		"?include_descendants=true": {direct, nested},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/subdivisions/%d/employees%s", parent, query), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: статус %d: %s", query, w.Code, w.Body)
+		}
+		var rows []struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+			t.Fatal(err)
+		}
+		got := map[int]bool{}
+		for _, row := range rows {
+			got[row.ID] = true
+		}
+		if len(got) != len(want) {
+			t.Errorf("%q: сотрудники %v, ожидались %v", query, rows, want)
+		}
+		for _, id := range want {
+			if !got[id] {
+				t.Errorf("%q: нет сотрудника %d", query, id)
+			}
+		}
+	}
+}
+
+func TestInterviewFeedTokenReset(t *testing.T) {
+	openTestDB(t)
+	userID := fmt.Sprint("feed-", time.Now().UnixNano())
+	t.Cleanup(func() { db.Exec("DELETE FROM calendar_feed WHERE subject_id = $1", userID) })
+
+	r := gin.New()
+	withUser := func(c *gin.Context) { c.Set("userClaims", jwt.MapClaims{"user_id": userID}) }
+	r.GET("/api/interviews/feeds", withUser, GetInterviewFeedURLs)
+	r.POST("/api/interviews/feeds/reset", withUser, resetInterviewFeeds)
+	r.GET("/api/calendar/interviewers/:id/interviews.ics", InterviewCalendar("interviewers"))
+
+	link := func(method, path string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		var links map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &links); err != nil || links["interviewer"] == "" {
+			t.Fatalf("%s %s: %d %s", method, path, w.Code, w.Body)
+		}
+		u, err := url.Parse(links["interviewer"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.RequestURI()
+	}
+	fetch := func(feed string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", feed, nil))
+		return w.Code
+	}
+
+	first := link("GET", "/api/interviews/feeds")
+	if again := link("GET", "/api/interviews/feeds"); again != first {
+		t.Errorf("токен подписки меняется при каждом запросе: %s и %s", first, again)
+	}
+	if code := fetch(first); code != http.StatusOK {
+		t.Errorf("действующая ссылка: %d", code)
+	}
+
+	reset := link("POST", "/api/interviews/feeds/reset")
+	if reset == first {
+		t.Fatal("токен не перевыпущен")
+	}
+	if code := fetch(first); code != http.StatusForbidden {
+		t.Errorf("старая ссылка после перевыпуска: %d", code)
+	}
+	if code := fetch(reset); code != http.StatusOK {
+		t.Errorf("новая ссылка: %d", code)
+	}
+}
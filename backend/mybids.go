@@ -0,0 +1,377 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type MyBid struct {
+	ID          int        `json:"bid_id"`
+	FIO         string     `json:"fio"`
+	BirthDate   *string    `json:"birth_date"`
+	JobTitle    string     `json:"job_title"`
+	Subdivision string     `json:"subdivision"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	WithdrawnAt *time.Time `json:"withdrawn_at"`
+	Editable    bool       `json:"editable"`
+}
+
+type BidRevision struct {
+	ID            int             `json:"id"`
+	ChangedBy     string          `json:"changed_by"`
+	ChangedByName *string         `json:"changed_by_name"`
+	Changes       json.RawMessage `json:"changes"`
+	ChangedAt     time.Time       `json:"changed_at"`
+}
+
+type fieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// bidSnapshot — поля заявки, которые заявитель может исправить сам.
+type bidSnapshot struct {
+	FIO       string
+	BirthDate string
+	Places    map[int]string
+}
+
+// diffBid возвращает изменённые поля; места обучения записываются как educations.<id>.place.
+func diffBid(before, after bidSnapshot) map[string]fieldChange {
+	changes := map[string]fieldChange{}
+	if before.FIO != after.FIO {
+		changes["fio"] = fieldChange{before.FIO, after.FIO}
+	}
+	if before.BirthDate != after.BirthDate {
+		changes["birth_date"] = fieldChange{before.BirthDate, after.BirthDate}
+	}
+	for id, place := range after.Places {
+		if old := before.Places[id]; old != place {
+			changes["educations."+strconv.Itoa(id)+".place"] = fieldChange{old, place}
+		}
+	}
+	return changes
+}
+
+// Заявка считается нерассмотренной, пока её не открыли в списке входящих
+// и по ней нет ни обсуждения, ни собеседований.
+const bidUnreviewedSQL = `(NOT eb.read
+    AND NOT EXISTS (SELECT 1 FROM bid_comment bc WHERE bc.bid_id = eb.id)
+    AND NOT EXISTS (SELECT 1 FROM interview i WHERE i.bid_id = eb.id))`
+
+// GetMyBids — заявки, поданные текущим пользователем и ещё не получившие решения.
+func GetMyBids(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	rows, err := db.Query(`
+        SELECT eb.id, eb.fio, to_char(eb.birth_date, 'YYYY-MM-DD'), COALESCE(jt.name, ''), COALESCE(sd.name, ''),
+            eb.status, eb.created_at, eb.withdrawn_at, eb.status = 'submitted' AND `+bidUnreviewedSQL+`
+        FROM employee_bid eb
+        LEFT JOIN job_title jt ON eb.job_title_id = jt.id
+        LEFT JOIN subdivision sd ON eb.subdivision_id = sd.id
+        WHERE eb.submitted_by = $1
+        ORDER BY eb.created_at DESC
+    `, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	bids := []MyBid{}
+	for rows.Next() {
+		var b MyBid
+		if err := rows.Scan(&b.ID, &b.FIO, &b.BirthDate, &b.JobTitle, &b.Subdivision, &b.Status, &b.CreatedAt, &b.WithdrawnAt, &b.Editable); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan bids"})
+			return
+		}
+		bids = append(bids, b)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, bids)
+}
+
+// editMyBid исправляет ФИО, дату рождения и места обучения в своей заявке, пока её не начали
+// рассматривать. Каждая правка сохраняется в bid_revision, историю видят рецензенты.
+func editMyBid(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	var req struct {
+		FIO        *string `json:"fio"`
+		BirthDate  *string `json:"birth_date"`
+		Educations []struct {
+			EducationID int    `json:"education_id"`
+			Place       string `json:"place"`
+		} `json:"educations"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var before bidSnapshot
+	var birthDate sql.NullString
+	var status string
+	var unreviewed bool
+	err = tx.QueryRow(`
+        SELECT eb.fio, to_char(eb.birth_date, 'YYYY-MM-DD'), eb.status, `+bidUnreviewedSQL+`
+        FROM employee_bid eb
+        WHERE eb.id = $1 AND eb.submitted_by = $2
+        FOR UPDATE
+    `, bidID, userID).Scan(&before.FIO, &birthDate, &status, &unreviewed)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status == "withdrawn" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Заявка отозвана заявителем"})
+		return
+	}
+	if !unreviewed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Заявка уже рассматривается и не может быть изменена"})
+		return
+	}
+	before.BirthDate = birthDate.String
+
+	before.Places = map[int]string{}
+	rows, err := tx.Query("SELECT education_id, place FROM employee_education_bid WHERE employee_id = $1", bidID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var id int
+		var place string
+		if err := rows.Scan(&id, &place); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan educations"})
+			return
+		}
+		before.Places[id] = place
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	after := bidSnapshot{FIO: before.FIO, BirthDate: before.BirthDate, Places: map[int]string{}}
+	if req.FIO != nil {
+		after.FIO = strings.TrimSpace(*req.FIO)
+		if after.FIO == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fio is required"})
+			return
+		}
+	}
+	if req.BirthDate != nil {
+		d, err := time.Parse(dateLayout, *req.BirthDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid birth_date"})
+			return
+		}
+		if d.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "birth_date is in the future"})
+			return
+		}
+		after.BirthDate = d.Format(dateLayout)
+	}
+	for _, edu := range req.Educations {
+		if _, ok := before.Places[edu.EducationID]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Education " + strconv.Itoa(edu.EducationID) + " is not part of this bid"})
+			return
+		}
+		after.Places[edu.EducationID] = edu.Place
+	}
+
+	changes := diffBid(before, after)
+	if len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Nothing to change", "changes": changes})
+		return
+	}
+
+	var newBirthDate *string
+	if after.BirthDate != "" {
+		newBirthDate = &after.BirthDate
+	}
+	if _, err := tx.Exec("UPDATE employee_bid SET fio = $1, birth_date = $2::date WHERE id = $3", after.FIO, newBirthDate, bidID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee_bid"})
+		return
+	}
+	for id, place := range after.Places {
+		if place == before.Places[id] {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE employee_education_bid SET place = $1 WHERE employee_id = $2 AND education_id = $3", place, bidID, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee_education_bid"})
+			return
+		}
+	}
+	if err := insertBidRevision(tx, bidID, userID, changes); err != nil {
+		log.Printf("Ошибка сохранения истории заявки: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into bid_revision"})
+		return
+	}
+	fields := make([]string, 0, len(changes))
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	if err := publishBidEvent(tx, "bid.updated", bidID, gin.H{"change": "edited", "fields": fields}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish bid event"})
+		return
+	}
+	if err := snapshotBidStat(tx, bidID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bid_stat"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Bid updated successfully", "changes": changes})
+}
+
+// withdrawMyBid отзывает заявку: строки остаются, заявка уходит из очереди,
+// предстоящие собеседования отменяются.
+func withdrawMyBid(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM employee_bid WHERE id = $1 AND submitted_by = $2 FOR UPDATE", bidID, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status == "withdrawn" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Заявка уже отозвана"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE employee_bid SET status = 'withdrawn', withdrawn_at = NOW() WHERE id = $1", bidID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee_bid"})
+		return
+	}
+	if err := cancelUpcomingInterviews(tx, strconv.Itoa(bidID)); err != nil {
+		log.Printf("Ошибка отмены собеседований: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel interviews"})
+		return
+	}
+	changes := map[string]fieldChange{"status": {status, "withdrawn"}}
+	if err := insertBidRevision(tx, bidID, userID, changes); err != nil {
+		log.Printf("Ошибка сохранения истории заявки: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into bid_revision"})
+		return
+	}
+	if err := publishBidEvent(tx, "bid.updated", bidID, gin.H{"change": "withdrawn", "status": "withdrawn"}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish bid event"})
+		return
+	}
+	if err := writeOutbox(tx, "application.withdrawn", gin.H{"bid_id": bidID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write outbox"})
+		return
+	}
+	if err := closeBidStat(tx, bidID, "withdrawn"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bid_stat"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Bid withdrawn successfully", "bid_id": bidID})
+}
+
+func insertBidRevision(tx *sql.Tx, bidID int, userID string, changes map[string]fieldChange) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO bid_revision (bid_id, changed_by, changes) VALUES ($1, $2, $3)", bidID, userID, string(data))
+	return err
+}
+
+// GetBidHistory — правки и отзыв заявки заявителем в хронологическом порядке.
+func GetBidHistory(c *gin.Context) {
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT r.id, r.changed_by, u.username, r.changes, r.changed_at
+        FROM bid_revision r
+        LEFT JOIN users u ON u.id::text = r.changed_by
+        WHERE r.bid_id = $1
+        ORDER BY r.changed_at, r.id
+    `, bidID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []BidRevision{}
+	for rows.Next() {
+		var r BidRevision
+		var changes []byte
+		if err := rows.Scan(&r.ID, &r.ChangedBy, &r.ChangedByName, &changes, &r.ChangedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan revisions"})
+			return
+		}
+		r.Changes = changes
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffBid(t *testing.T) {
+	before := bidSnapshot{FIO: "Иванов Иван", BirthDate: "1990-01-01", Places: map[int]string{1: "МГУ", 2: "СПбГУ"}}
+	after := bidSnapshot{FIO: "Иванов Иван Иванович", BirthDate: "1990-01-01", Places: map[int]string{1: "МГУ", 2: "ИТМО"}}
+
+	got := diffBid(before, after)
+	expected := map[string]fieldChange{
+		"fio":                {Old: "Иванов Иван", New: "Иванов Иван Иванович"},
+		"educations.2.place": {Old: "СПбГУ", New: "ИТМО"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected changes: got %v want %v", got, expected)
+	}
+
+	if got := diffBid(before, before); len(got) != 0 {
+		t.Errorf("expected no changes, got %v", got)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// orgUnit — узел оргструктуры: подразделение, его руководитель и численность.
+type orgUnit struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	ParentID  *int       `json:"parent_id"`
+	Head      *orgHead   `json:"head"`
+	Employees int        `json:"employees"`
+	Total     int        `json:"total_employees"`
+	Children  []*orgUnit `json:"children"`
+}
+
+type orgHead struct {
+	ID       int    `json:"id"`
+	FIO      string `json:"fio"`
+	JobTitle string `json:"job_title"`
+}
+
+// loadOrgUnits читает подразделения; руководители и численность учитываются только в пределах scope.
+func loadOrgUnits(scope employeeScope) ([]*orgUnit, error) {
+	qb := &queryBuilder{}
+	rows, err := db.Query(`
+        SELECT s.id, s.name, s.parent_id, h.id, COALESCE(h.fio, ''), COALESCE(jt.name, ''), COUNT(e.id)
+        FROM subdivision s
+        LEFT JOIN employee h ON h.id = s.head_employee_id AND `+scope.cond(qb, "h.id")+`
+        LEFT JOIN job_title jt ON jt.id = h.job_title_id
+        LEFT JOIN employee e ON e.subdivision_id = s.id AND `+scope.cond(qb, "e.id")+`
+        GROUP BY s.id, h.id, jt.name
+        ORDER BY s.name, s.id
+    `, qb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var units []*orgUnit
+	for rows.Next() {
+		u := &orgUnit{Children: []*orgUnit{}}
+		var headID *int
+		var headFIO, headJobTitle string
+		if err := rows.Scan(&u.ID, &u.Name, &u.ParentID, &headID, &headFIO, &headJobTitle, &u.Employees); err != nil {
+			return nil, err
+		}
+		if headID != nil {
+			u.Head = &orgHead{ID: *headID, FIO: headFIO, JobTitle: headJobTitle}
+		}
+		units = append(units, u)
+	}
+	return units, rows.Err()
+}
+
+// buildOrgTree раскладывает подразделения по родителям и считает численность с учётом вложенных.
+// root = 0 — всё дерево, иначе только ветка root (nil, если такого подразделения нет).
+func buildOrgTree(units []*orgUnit, root int) []*orgUnit {
+	byID := make(map[int]*orgUnit, len(units))
+	for _, u := range units {
+		byID[u.ID] = u
+	}
+	var roots []*orgUnit
+	for _, u := range units {
+		if u.ParentID != nil {
+			if parent, ok := byID[*u.ParentID]; ok {
+				parent.Children = append(parent.Children, u)
+				continue
+			}
+		}
+		roots = append(roots, u)
+	}
+	var total func(u *orgUnit) int
+	total = func(u *orgUnit) int {
+		u.Total = u.Employees
+		for _, child := range u.Children {
+			u.Total += total(child)
+		}
+		return u.Total
+	}
+	for _, u := range roots {
+		total(u)
+	}
+	if root == 0 {
+		return roots
+	}
+	if u, ok := byID[root]; ok {
+		return []*orgUnit{u}
+	}
+	return nil
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// orgChartDOT описывает дерево на языке Graphviz DOT.
+func orgChartDOT(roots []*orgUnit) string {
+	var sb strings.Builder
+	sb.WriteString("digraph orgchart {\n")
+	sb.WriteString("\trankdir=TB;\n")
+	sb.WriteString("\tnode [shape=box, style=\"rounded,filled\", fillcolor=\"#f5f5f5\", fontname=\"Helvetica\"];\n")
+	var walk func(u *orgUnit)
+	walk = func(u *orgUnit) {
+		label := u.Name
+		if u.Head != nil {
+			label += "\n" + u.Head.FIO
+		}
+		label += fmt.Sprintf("\nсотрудников: %d", u.Employees)
+		if u.Total != u.Employees {
+			label += fmt.Sprintf(" (всего %d)", u.Total)
+		}
+		fmt.Fprintf(&sb, "\ts%d [label=%s];\n", u.ID, dotQuote(label))
+		for _, child := range u.Children {
+			fmt.Fprintf(&sb, "\ts%d -> s%d;\n", u.ID, child.ID)
+			walk(child)
+		}
+	}
+	for _, u := range roots {
+		walk(u)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// orgChartSVG рисует DOT утилитой dot из Graphviz (путь — GRAPHVIZ_DOT).
+func orgChartSVG(ctx context.Context, dot string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, envDuration("GRAPHVIZ_TIMEOUT", 10*time.Second))
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, envString("GRAPHVIZ_DOT", "dot"), "-Tsvg")
+	cmd.Stdin = strings.NewReader(dot)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// GetOrgChart — оргструктура целиком или ветка ?root=; ?format=json (по умолчанию), dot или svg.
+func GetOrgChart(c *gin.Context) {
+	root := 0
+	if v := c.Query("root"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid root"})
+			return
+		}
+		root = n
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "dot" && format != "svg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, dot or svg"})
+		return
+	}
+
+	scope, err := loadEmployeeScope(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	units, err := loadOrgUnits(scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	roots := buildOrgTree(units, root)
+	if root != 0 && roots == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subdivision not found"})
+		return
+	}
+	if roots == nil {
+		roots = []*orgUnit{}
+	}
+
+	switch format {
+	case "json":
+		c.JSON(http.StatusOK, roots)
+	case "dot":
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(orgChartDOT(roots)))
+	case "svg":
+		svg, err := orgChartSVG(c.Request.Context(), orgChartDOT(roots))
+		if err != nil {
+			log.Printf("Ошибка построения оргструктуры в SVG: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to render SVG"})
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", svg)
+	}
+}
+
+// moveSubdivision переносит подразделение вместе с веткой под другое (parent_id = null — в корень).
+func moveSubdivision(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subdivision ID"})
+		return
+	}
+	var req struct {
+		ParentID *int `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Переносы выполняются по одному, иначе два встречных переноса могут замкнуть цикл
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('subdivision_tree'))"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM subdivision WHERE id = $1)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subdivision not found"})
+		return
+	}
+
+	if req.ParentID != nil {
+		var parentExists, cycle bool
+		err = tx.QueryRow(`
+            SELECT EXISTS(SELECT 1 FROM subdivision WHERE id = $2), $2 IN `+fmt.Sprintf(subdivisionSubtreeSQL, "$1"),
+			pq.Array([]int{id}), *req.ParentID).Scan(&parentExists, &cycle)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !parentExists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent subdivision not found"})
+			return
+		}
+		if cycle {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot move a subdivision under itself or its descendant"})
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE subdivision SET parent_id = $1 WHERE id = $2", req.ParentID, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subdivision"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "parent_id": req.ParentID})
+}
+
+// setSubdivisionHead назначает руководителя подразделения (employee_id = null — снять).
+func setSubdivisionHead(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subdivision ID"})
+		return
+	}
+	var req struct {
+		EmployeeID *int `json:"employee_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.EmployeeID != nil {
+		var exists bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM employee WHERE id = $1)", *req.EmployeeID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+			return
+		}
+	}
+
+	result, err := db.Exec("UPDATE subdivision SET head_employee_id = $1 WHERE id = $2", req.EmployeeID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subdivision"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subdivision not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "head_employee_id": req.EmployeeID})
+}
+
+// GetSubdivisionEmployees — сотрудники, числящиеся непосредственно в подразделении;
+// ?include_descendants=true — вместе с вложенными подразделениями.
+func GetSubdivisionEmployees(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subdivision ID"})
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM subdivision WHERE id = $1)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subdivision not found"})
+		return
+	}
+
+	qb := &queryBuilder{}
+	if c.Query("include_descendants") == "true" {
+		qb.where("e.subdivision_id IN "+subdivisionSubtreeSQL, pq.Array([]int{id}))
+	} else {
+		qb.where("e.subdivision_id = %s", id)
+	}
+	scope, err := loadEmployeeScope(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	scope.apply(qb, "e.id")
+	rows, err := db.Query(`
+        SELECT e.id, e.fio, e.job_title_id, COALESCE(jt.name, ''), e.subdivision_id, sd.name, e.hire_date
+        FROM employee_computed e
+        LEFT JOIN job_title jt ON jt.id = e.job_title_id
+        JOIN subdivision sd ON sd.id = e.subdivision_id`+qb.whereSQL()+`
+        ORDER BY sd.name, e.fio, e.id
+    `, qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	employees := []gin.H{}
+	for rows.Next() {
+		var employeeID, jobTitleID, subdivisionID int
+		var fio, jobTitle, subdivision string
+		var hireDate sql.NullTime
+		if err := rows.Scan(&employeeID, &fio, &jobTitleID, &jobTitle, &subdivisionID, &subdivision, &hireDate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employees"})
+			return
+		}
+		employees = append(employees, gin.H{
+			"id":             employeeID,
+			"fio":            fio,
+			"job_title_id":   jobTitleID,
+			"job_title":      jobTitle,
+			"subdivision_id": subdivisionID,
+			"subdivision":    subdivision,
+			"hire_date":      formatDate(hireDate),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, employees)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func testOrgUnits() []*orgUnit {
+	parent := func(id int) *int { return &id }
+	return []*orgUnit{
+		{ID: 1, Name: "Дирекция", Employees: 2, Head: &orgHead{ID: 10, FIO: "Петров П. П."}},
+		{ID: 2, Name: "Отдел \"Альфа\"", ParentID: parent(1), Employees: 3},
+		{ID: 3, Name: "Группа", ParentID: parent(2), Employees: 4},
+		{ID: 4, Name: "Сирота", ParentID: parent(99), Employees: 1},
+	}
+}
+
+func TestBuildOrgTree(t *testing.T) {
+	roots := buildOrgTree(testOrgUnits(), 0)
+	if len(roots) != 2 || roots[0].ID != 1 || roots[1].ID != 4 {
+		t.Fatalf("unexpected roots: %+v", roots)
+	}
+	if roots[0].Total != 9 || roots[0].Children[0].Total != 7 {
+		t.Errorf("unexpected totals: %d, %d", roots[0].Total, roots[0].Children[0].Total)
+	}
+
+	branch := buildOrgTree(testOrgUnits(), 2)
+	if len(branch) != 1 || branch[0].ID != 2 || len(branch[0].Children) != 1 || branch[0].Total != 7 {
+		t.Errorf("unexpected branch: %+v", branch)
+	}
+	if buildOrgTree(testOrgUnits(), 42) != nil {
+		t.Error("expected nil for unknown root")
+	}
+}
+
+func TestOrgChartDOT(t *testing.T) {
+	dot := orgChartDOT(buildOrgTree(testOrgUnits(), 0))
+	for _, want := range []string{
+		"digraph orgchart {",
+		`s1 [label="Дирекция\nПетров П. П.\nсотрудников: 2 (всего 9)"];`,
+		`s2 [label="Отдел \"Альфа\"\nсотрудников: 3 (всего 7)"];`,
+		"s1 -> s2;",
+		"s2 -> s3;",
+		`s4 [label="Сирота\nсотрудников: 1"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output lacks %q:\n%s", want, dot)
+		}
+	}
+}
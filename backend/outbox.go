@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type outboxMessage struct {
+	ID        int64           `json:"id"`
+	EventType string          `json:"event"`
+	Payload   json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"occurred_at"`
+}
+
+// outboxSink — приёмник сообщений outbox. Publish выполняется в транзакции, где ставится отметка
+// об отправке: приёмники, пишущие в ту же базу, получают каждое сообщение ровно один раз,
+// внешние — как минимум один раз с неизменным id для отбрасывания повторов.
+type outboxSink interface {
+	Name() string
+	Publish(tx *sql.Tx, msg outboxMessage) error
+}
+
+type webhookSink struct{}
+
+func (webhookSink) Name() string { return "webhooks" }
+
+func (webhookSink) Publish(tx *sql.Tx, msg outboxMessage) error {
+	return enqueueWebhooks(tx, msg)
+}
+
+type logSink struct{}
+
+func (logSink) Name() string { return "log" }
+
+func (logSink) Publish(_ *sql.Tx, msg outboxMessage) error {
+	log.Printf("Событие %s #%d: %s", msg.EventType, msg.ID, msg.Payload)
+	return nil
+}
+
+// notifySink публикует сообщения в канал Postgres NOTIFY для внешних слушателей;
+// уведомление уходит только при фиксации транзакции вместе с отметкой.
+type notifySink struct {
+	channel string
+}
+
+func (s notifySink) Name() string { return "notify" }
+
+func (s notifySink) Publish(tx *sql.Tx, msg outboxMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("SELECT pg_notify($1, $2)", s.channel, string(data))
+	return err
+}
+
+var outboxSinkFactories = map[string]func() outboxSink{
+	"webhooks": func() outboxSink { return webhookSink{} },
+	"log":      func() outboxSink { return logSink{} },
+	"mail":     func() outboxSink { return mailSink{} },
+	"telegram": func() outboxSink { return telegramSink{} },
+	"notify":   func() outboxSink { return notifySink{channel: envString("OUTBOX_NOTIFY_CHANNEL", "outbox")} },
+}
+
+// outboxSinks собирает приёмники из OUTBOX_SINKS (через запятую, по умолчанию webhooks,log,mail,telegram).
+func outboxSinks() ([]outboxSink, error) {
+	var sinks []outboxSink
+	seen := map[string]bool{}
+	for _, name := range strings.Split(envString("OUTBOX_SINKS", "webhooks,log,mail,telegram"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		factory, ok := outboxSinkFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+		seen[name] = true
+		sinks = append(sinks, factory())
+	}
+	return sinks, nil
+}
+
+// writeOutbox сохраняет событие в транзакции изменения, которое его вызвало.
+func writeOutbox(tx *sql.Tx, eventType string, data gin.H) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO outbox (event_type, payload) VALUES ($1, $2)", eventType, string(payload))
+	return err
+}
+
+func runOutboxDispatcher(sinks []outboxSink) {
+	for {
+		total := 0
+		for _, sink := range sinks {
+			n, err := dispatchOutbox(sink)
+			if err != nil {
+				log.Printf("Ошибка отправки outbox в %s: %v", sink.Name(), err)
+			}
+			total += n
+		}
+		if total == 0 {
+			time.Sleep(envDuration("OUTBOX_POLL_INTERVAL", 2*time.Second))
+		}
+	}
+}
+
+// outboxRetryPolicy — сколько раз пытаться передать сообщение приёмнику и как долго ждать между попытками.
+func outboxRetryPolicy() (maxAttempts int, delay time.Duration) {
+	return envInt("OUTBOX_MAX_ATTEMPTS", 5), envDuration("OUTBOX_RETRY_DELAY", time.Minute)
+}
+
+// dispatchOutbox передаёт приёмнику очередную пачку неотправленных ему сообщений.
+// Advisory-блокировка оставляет по одному отправителю на приёмник среди всех экземпляров.
+// Каждое сообщение передаётся в своей точке сохранения: сбой откатывает только его,
+// попытка записывается в outbox_failure, а после maxAttempts сообщение откладывается.
+func dispatchOutbox(sink outboxSink) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock(hashtext('outbox:' || $1))", sink.Name()).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	maxAttempts, delay := outboxRetryPolicy()
+	rows, err := tx.Query(`
+        SELECT o.id, o.event_type, o.payload, o.created_at FROM outbox o
+        WHERE NOT EXISTS (SELECT 1 FROM outbox_dispatch d WHERE d.sink = $1 AND d.outbox_id = o.id)
+            AND NOT EXISTS (
+                SELECT 1 FROM outbox_failure f WHERE f.sink = $1 AND f.outbox_id = o.id
+                    AND (f.attempts >= $2 OR f.failed_at > NOW() - make_interval(secs => $3))
+            )
+        ORDER BY o.id
+        LIMIT 100
+    `, sink.Name(), maxAttempts, delay.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	var messages []outboxMessage
+	for rows.Next() {
+		var msg outboxMessage
+		var payload []byte
+		if err := rows.Scan(&msg.ID, &msg.EventType, &payload, &msg.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		msg.Payload = payload
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	dispatched := 0
+	for _, msg := range messages {
+		if _, err := tx.Exec("SAVEPOINT outbox_message"); err != nil {
+			return 0, err
+		}
+		err := sink.Publish(tx, msg)
+		if err == nil {
+			_, err = tx.Exec("INSERT INTO outbox_dispatch (outbox_id, sink) VALUES ($1, $2)", msg.ID, sink.Name())
+		}
+		if err == nil {
+			if _, err := tx.Exec("RELEASE SAVEPOINT outbox_message"); err != nil {
+				return 0, err
+			}
+			dispatched++
+			continue
+		}
+
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT outbox_message"); err != nil {
+			return 0, err
+		}
+		var attempts int
+		err2 := tx.QueryRow(`
+            INSERT INTO outbox_failure (outbox_id, sink, last_error) VALUES ($1, $2, $3)
+            ON CONFLICT (sink, outbox_id) DO UPDATE SET
+                attempts = outbox_failure.attempts + 1, last_error = EXCLUDED.last_error, failed_at = NOW()
+            RETURNING attempts
+        `, msg.ID, sink.Name(), err.Error()).Scan(&attempts)
+		if err2 != nil {
+			return 0, err2
+		}
+		if attempts >= maxAttempts {
+			log.Printf("Сообщение outbox #%d отложено для %s после %d попыток: %v", msg.ID, sink.Name(), attempts, err)
+		} else {
+			log.Printf("Ошибка передачи сообщения outbox #%d в %s (попытка %d): %v", msg.ID, sink.Name(), attempts, err)
+		}
+	}
+	return dispatched, tx.Commit()
+}
+
+// purgeOutbox удаляет старые сообщения, уже переданные всем настроенным приёмникам.
+func purgeOutbox(sinks []outboxSink) (int64, error) {
+	names := make([]string, len(sinks))
+	for i, sink := range sinks {
+		names[i] = sink.Name()
+	}
+	result, err := db.Exec(`
+        DELETE FROM outbox o
+        WHERE o.created_at < NOW() - make_interval(secs => $1)
+            AND (SELECT COUNT(*) FROM outbox_dispatch d WHERE d.outbox_id = o.id AND d.sink = ANY($2)) = $3
+    `, envDuration("OUTBOX_RETENTION", 7*24*time.Hour).Seconds(), pq.Array(names), len(names))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
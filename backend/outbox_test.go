@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestOutboxSinks(t *testing.T) {
+	t.Setenv("OUTBOX_SINKS", "log, notify,log")
+	sinks, err := outboxSinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sinks) != 2 || sinks[0].Name() != "log" || sinks[1].Name() != "notify" {
+		t.Errorf("unexpected sinks: %v", sinks)
+	}
+
+	t.Setenv("OUTBOX_SINKS", "webhooks,kafka")
+	if _, err := outboxSinks(); err == nil {
+		t.Error("expected unknown sink to be rejected")
+	}
+}
+
+// flakySink отказывается принимать сообщения из failing и считает попытки по id.
+type flakySink struct {
+	name     string
+	failing  map[int64]bool
+	attempts map[int64]int
+}
+
+func (s *flakySink) Name() string { return s.name }
+
+func (s *flakySink) Publish(_ *sql.Tx, msg outboxMessage) error {
+	s.attempts[msg.ID]++
+	if s.failing[msg.ID] {
+		return errors.New("sink is down")
+	}
+	return nil
+}
+
+func TestDispatchOutboxIsolatesFailures(t *testing.T) {
+	openTestDB(t)
+	t.Setenv("OUTBOX_MAX_ATTEMPTS", "3")
+	t.Setenv("OUTBOX_RETRY_DELAY", "0s")
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		var id int64
+		if err := db.QueryRow("INSERT INTO outbox (event_type, payload) VALUES ('test.event', '{}') RETURNING id").Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	sink := &flakySink{
+		name:     fmt.Sprint("test-", time.Now().UnixNano()),
+		failing:  map[int64]bool{ids[1]: true},
+		attempts: map[int64]int{},
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM outbox WHERE id = ANY($1)", pq.Array(ids))
+		db.Exec("DELETE FROM outbox_dispatch WHERE sink = $1", sink.name)
+		db.Exec("DELETE FROM outbox_failure WHERE sink = $1", sink.name)
+	})
+
+	for i := 0; i < 100; i++ {
+		n, err := dispatchOutbox(sink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 && sink.attempts[ids[1]] >= 3 {
+			break
+		}
+	}
+
+	var dispatched []int64
+	rows, err := db.Query("SELECT outbox_id FROM outbox_dispatch WHERE sink = $1 AND outbox_id = ANY($2) ORDER BY outbox_id", sink.name, pq.Array(ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		dispatched = append(dispatched, id)
+	}
+	if len(dispatched) != 2 || dispatched[0] != ids[0] || dispatched[1] != ids[2] {
+		t.Errorf("сбой одного сообщения не должен мешать остальным: переданы %v из %v", dispatched, ids)
+	}
+	if sink.attempts[ids[0]] != 1 || sink.attempts[ids[2]] != 1 {
+		t.Errorf("успешные сообщения переданы повторно: %v", sink.attempts)
+	}
+	if sink.attempts[ids[1]] != 3 {
+		t.Errorf("ожидалось 3 попытки до откладывания, получено %d", sink.attempts[ids[1]])
+	}
+
+	// Отложенное сообщение больше не выбирается
+	if _, err := dispatchOutbox(sink); err != nil {
+		t.Fatal(err)
+	}
+	if sink.attempts[ids[1]] != 3 {
+		t.Errorf("отложенное сообщение передаётся снова: %d попыток", sink.attempts[ids[1]])
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// employeeScopeSQL — подзапрос с id сотрудников, доступных пользователю, привязанному к сотруднику %s
+// (плейсхолдер подставляется дважды): сам сотрудник, все его прямые и непрямые подчинённые
+// и сотрудники его подразделения вместе с вложенными.
+var employeeScopeSQL = `(
+        WITH RECURSIVE chain AS (
+            SELECT id FROM employee WHERE id = %s
+            UNION
+            SELECT e.id FROM employee e JOIN chain ch ON e.manager_id = ch.id
+        )
+        SELECT id FROM chain
+        UNION
+        SELECT id FROM employee WHERE subdivision_id IN ` +
+	fmt.Sprintf(subdivisionSubtreeSQL, "ARRAY(SELECT subdivision_id FROM employee WHERE id = %s)") + `
+    )`
+
+// employeeScope — ограничение видимости сотрудников для текущего пользователя.
+type employeeScope struct {
+	restricted bool
+	employeeID *int
+}
+
+// loadEmployeeScope читает ограничение пользователя; администраторы и учётные записи
+// с employee_scope = 'all' видят всех. Должен вызываться после RoleMiddleware.
+func loadEmployeeScope(c *gin.Context) (employeeScope, error) {
+	var s employeeScope
+	if c.GetString("userRole") != "employee" {
+		return s, nil
+	}
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	var scope string
+	if err := db.QueryRow("SELECT employee_scope, employee_id FROM users WHERE id::text = $1", userID).Scan(&scope, &s.employeeID); err != nil {
+		return s, err
+	}
+	s.restricted = scope == "own"
+	return s, nil
+}
+
+// cond возвращает условие видимости для column с плейсхолдером из qb; без ограничения — TRUE.
+func (s employeeScope) cond(qb *queryBuilder, column string) string {
+	if !s.restricted {
+		return "TRUE"
+	}
+	ph := qb.arg(s.employeeID)
+	return column + " IN " + fmt.Sprintf(employeeScopeSQL, ph, ph)
+}
+
+func (s employeeScope) apply(qb *queryBuilder, column string) {
+	if s.restricted {
+		qb.conds = append(qb.conds, s.cond(qb, column))
+	}
+}
+
+func (s employeeScope) allows(q queryer, employeeID string) (bool, error) {
+	if !s.restricted {
+		return true, nil
+	}
+	var ok bool
+	err := q.QueryRow("SELECT $1::int IN "+fmt.Sprintf(employeeScopeSQL, "$2", "$2"), employeeID, s.employeeID).Scan(&ok)
+	return ok, err
+}
+
+// checkEmployeeScopeOf — checkEmployeeScope для записей, привязанных к сотруднику не всегда
+// (вложения и комментарии заявок до приёма): без сотрудника проверять нечего.
+func checkEmployeeScopeOf(c *gin.Context, employeeID *int) bool {
+	return employeeID == nil || checkEmployeeScope(c, strconv.Itoa(*employeeID))
+}
+
+// checkBidScope — checkEmployeeScopeOf для комментариев и вложений заявки: после приёма
+// они принадлежат сотруднику, и читать их по номеру заявки можно только в пределах scope.
+func checkBidScope(c *gin.Context, bidID int) bool {
+	var employeeID *int
+	err := db.QueryRow(`
+        SELECT COALESCE(
+            (SELECT employee_id FROM bid_comment WHERE bid_id = $1 AND employee_id IS NOT NULL LIMIT 1),
+            (SELECT employee_id FROM attachment WHERE bid_id = $1 AND employee_id IS NOT NULL LIMIT 1))
+    `, bidID).Scan(&employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	return checkEmployeeScopeOf(c, employeeID)
+}
+
+// checkEmployeeScope отвечает 403 и возвращает false, если сотрудник id недоступен пользователю.
+func checkEmployeeScope(c *gin.Context, id string) bool {
+	if _, err := strconv.Atoi(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return false
+	}
+	scope, err := loadEmployeeScope(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	ok, err := scope.allows(db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Employee is outside your scope"})
+		return false
+	}
+	return true
+}
+
+// setEmployeeManager назначает непосредственного руководителя (manager_id = null — снять).
+func setEmployeeManager(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+	var req struct {
+		ManagerID *int `json:"manager_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Как и переносы подразделений, изменения подчинения выполняются по одному
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('employee_reporting'))"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM employee WHERE id = $1)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	if req.ManagerID != nil {
+		var managerExists, cycle bool
+		err = tx.QueryRow(`
+            WITH RECURSIVE chain AS (
+                SELECT id FROM employee WHERE id = $1
+                UNION
+                SELECT e.id FROM employee e JOIN chain ch ON e.manager_id = ch.id
+            )
+            SELECT EXISTS(SELECT 1 FROM employee WHERE id = $2), EXISTS(SELECT 1 FROM chain WHERE id = $2)
+        `, id, *req.ManagerID).Scan(&managerExists, &cycle)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !managerExists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Manager not found"})
+			return
+		}
+		if cycle {
+			c.JSON(http.StatusConflict, gin.H{"error": "Manager cannot be the employee or one of their reports"})
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE employee SET manager_id = $1 WHERE id = $2", req.ManagerID, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "manager_id": req.ManagerID})
+}
+
+// GetEmployeeReports — прямые подчинённые сотрудника; ?indirect=true — вся линия подчинения,
+// depth — уровень относительно сотрудника (1 — прямые).
+func GetEmployeeReports(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+	if !checkEmployeeScope(c, id) {
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM employee WHERE id = $1)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	rows, err := db.Query(`
+        WITH RECURSIVE reports AS (
+            SELECT id, manager_id, 1 AS depth FROM employee WHERE manager_id = $1
+            UNION ALL
+            SELECT e.id, e.manager_id, r.depth + 1
+            FROM employee e JOIN reports r ON e.manager_id = r.id
+            WHERE $2
+        )
+        SELECT r.id, ec.fio, ec.job_title_id, COALESCE(jt.name, ''), ec.subdivision_id, COALESCE(sd.name, ''),
+            r.manager_id, r.depth
+        FROM reports r
+        JOIN employee_computed ec ON ec.id = r.id
+        LEFT JOIN job_title jt ON jt.id = ec.job_title_id
+        LEFT JOIN subdivision sd ON sd.id = ec.subdivision_id
+        ORDER BY r.depth, ec.fio, r.id
+    `, id, c.Query("indirect") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []gin.H{}
+	for rows.Next() {
+		var reportID, jobTitleID, subdivisionID, managerID, depth int
+		var fio, jobTitle, subdivision string
+		if err := rows.Scan(&reportID, &fio, &jobTitleID, &jobTitle, &subdivisionID, &subdivision, &managerID, &depth); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employees"})
+			return
+		}
+		reports = append(reports, gin.H{
+			"id":             reportID,
+			"fio":            fio,
+			"job_title_id":   jobTitleID,
+			"job_title":      jobTitle,
+			"subdivision_id": subdivisionID,
+			"subdivision":    subdivision,
+			"manager_id":     managerID,
+			"depth":          depth,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, reports)
+}
+
+// setUserEmployeeScope привязывает учётную запись к сотруднику и задаёт область видимости:
+// all — все сотрудники, own — только линия подчинения и подразделение привязанного сотрудника.
+func setUserEmployeeScope(c *gin.Context) {
+	var req struct {
+		EmployeeID *int   `json:"employee_id"`
+		Scope      string `json:"scope" binding:"required,oneof=all own"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Scope == "own" && req.EmployeeID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "employee_id is required for scope own"})
+		return
+	}
+
+	if req.EmployeeID != nil {
+		var exists bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM employee WHERE id = $1)", *req.EmployeeID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+			return
+		}
+	}
+
+	var userID string
+	err := db.QueryRow(`
+        UPDATE users SET employee_id = $1, employee_scope = $2 WHERE id::text = $3
+        RETURNING id::text
+    `, req.EmployeeID, req.Scope, c.Param("id")).Scan(&userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Employee is already linked to another user"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "employee_id": req.EmployeeID, "scope": req.Scope})
+}
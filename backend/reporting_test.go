@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmployeeScopeApply(t *testing.T) {
+	qb := &queryBuilder{}
+	employeeScope{}.apply(qb, "id")
+	if qb.whereSQL() != "" {
+		t.Errorf("unrestricted scope added a condition: %q", qb.whereSQL())
+	}
+
+	id := 7
+	qb.where("fio ILIKE %s", "%Иван%")
+	employeeScope{restricted: true, employeeID: &id}.apply(qb, "id")
+	got := qb.whereSQL()
+	if !strings.HasPrefix(got, " WHERE fio ILIKE $1 AND id IN (") || strings.Contains(got, "%") {
+		t.Errorf("unexpected where clause: %q", got)
+	}
+	for _, want := range []string{"WHERE id = $2", "e.manager_id = ch.id", "s.parent_id = t.id"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("where clause lacks %q: %s", want, got)
+		}
+	}
+	if strings.Contains(got, "$3") || len(qb.args) != 2 {
+		t.Errorf("expected 2 args, got %d", len(qb.args))
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// unassignedThreshold — через сколько после подачи заявка без рецензента помечается как stale.
+func unassignedThreshold() time.Duration {
+	return envDuration("UNASSIGNED_BID_THRESHOLD", 48*time.Hour)
+}
+
+type ReviewerWorkload struct {
+	UserID       string     `json:"user_id"`
+	Username     string     `json:"username"`
+	OpenBids     int        `json:"open_bids"`
+	OldestBidAt  *time.Time `json:"oldest_bid_at"`
+	Subdivisions []int64    `json:"subdivisions"`
+}
+
+// autoAssign назначает заявку следующему рецензенту подразделения по кругу.
+// Если для подразделения пул не настроен, заявка остаётся неназначенной и возвращается "".
+func autoAssign(tx *sql.Tx, bidID, subdivisionID int) (string, error) {
+	_, err := tx.Exec(`
+        INSERT INTO reviewer_rotation (subdivision_id, last_user_id) VALUES ($1, '')
+        ON CONFLICT (subdivision_id) DO NOTHING
+    `, subdivisionID)
+	if err != nil {
+		return "", err
+	}
+
+	var last string
+	err = tx.QueryRow("SELECT last_user_id FROM reviewer_rotation WHERE subdivision_id = $1 FOR UPDATE", subdivisionID).Scan(&last)
+	if err != nil {
+		return "", err
+	}
+
+	// Сначала рецензенты "после" последнего назначенного, затем — по кругу с начала
+	var next string
+	err = tx.QueryRow(`
+        SELECT rs.user_id
+        FROM reviewer_subdivision rs
+        JOIN users u ON u.id::text = rs.user_id AND u.role IN ('employee', 'admin')
+        WHERE rs.subdivision_id = $1
+        ORDER BY rs.user_id <= $2, rs.user_id
+        LIMIT 1
+    `, subdivisionID, last).Scan(&next)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec("UPDATE employee_bid SET assigned_to = $1, assigned_at = NOW() WHERE id = $2", next, bidID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("UPDATE reviewer_rotation SET last_user_id = $1 WHERE subdivision_id = $2", next, subdivisionID); err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// assignBid назначает заявку рецензенту вручную. Пустой user_id снимает назначение,
+// "auto" отдаёт заявку следующему по очереди рецензенту подразделения.
+func assignBid(c *gin.Context) {
+	bidID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.UserID == "me" {
+		req.UserID = c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var subdivisionID int
+	var status string
+	err = tx.QueryRow("SELECT subdivision_id, status FROM employee_bid WHERE id = $1 FOR UPDATE", bidID).Scan(&subdivisionID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status == "withdrawn" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Заявка отозвана заявителем"})
+		return
+	}
+
+	assignee := req.UserID
+	switch req.UserID {
+	case "":
+		_, err = tx.Exec("UPDATE employee_bid SET assigned_to = NULL, assigned_at = NULL WHERE id = $1", bidID)
+	case "auto":
+		assignee, err = autoAssign(tx, bidID, subdivisionID)
+		if err == nil && assignee == "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "No reviewers configured for this subdivision"})
+			return
+		}
+	default:
+		var isStaff bool
+		err = tx.QueryRow(`
+            SELECT EXISTS(SELECT 1 FROM users WHERE id::text = $1 AND role IN ('employee', 'admin'))
+        `, req.UserID).Scan(&isStaff)
+		if err == nil && !isStaff {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reviewer must be an employee or admin"})
+			return
+		}
+		if err == nil {
+			_, err = tx.Exec("UPDATE employee_bid SET assigned_to = $1, assigned_at = NOW() WHERE id = $2", req.UserID, bidID)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign bid"})
+		return
+	}
+	if err := publishBidEvent(tx, "bid.updated", bidID, gin.H{"change": "assigned", "assigned_to": assignee}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish bid event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bid_id": bidID, "assigned_to": assignee})
+}
+
+// GetReviewerWorkload показывает открытые заявки по рецензентам и неназначенные заявки.
+func GetReviewerWorkload(c *gin.Context) {
+	rows, err := db.Query(`
+        SELECT u.id::text, u.username, COUNT(eb.id), MIN(eb.created_at),
+            COALESCE((SELECT array_agg(rs.subdivision_id ORDER BY rs.subdivision_id)
+                FROM reviewer_subdivision rs WHERE rs.user_id = u.id::text), '{}')
+        FROM users u
+        LEFT JOIN employee_bid eb ON eb.assigned_to = u.id::text AND eb.status = 'submitted'
+        WHERE u.role IN ('employee', 'admin')
+        GROUP BY u.id, u.username
+        ORDER BY COUNT(eb.id) DESC, u.username
+    `)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	reviewers := []ReviewerWorkload{}
+	for rows.Next() {
+		var w ReviewerWorkload
+		if err := rows.Scan(&w.UserID, &w.Username, &w.OpenBids, &w.OldestBidAt, pq.Array(&w.Subdivisions)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan workload"})
+			return
+		}
+		reviewers = append(reviewers, w)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	threshold := unassignedThreshold()
+	var unassigned, stale int
+	err = db.QueryRow(`
+        SELECT COUNT(*), COUNT(*) FILTER (WHERE created_at < NOW() - make_interval(secs => $1))
+        FROM employee_bid WHERE assigned_to IS NULL AND status = 'submitted'
+    `, threshold.Seconds()).Scan(&unassigned, &stale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviewers":            reviewers,
+		"unassigned":           unassigned,
+		"stale_unassigned":     stale,
+		"stale_threshold_secs": int(threshold.Seconds()),
+	})
+}
+
+// setReviewerSubdivisions задаёт подразделения, заявки которых автоматически распределяются на рецензента.
+func setReviewerSubdivisions(c *gin.Context) {
+	userID := c.Param("id")
+
+	var req struct {
+		SubdivisionIDs []int64 `json:"subdivision_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var isStaff bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id::text = $1 AND role IN ('employee', 'admin'))", userID).Scan(&isStaff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !isStaff {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reviewer not found"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM reviewer_subdivision WHERE user_id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from reviewer_subdivision"})
+		return
+	}
+	if len(req.SubdivisionIDs) > 0 {
+		_, err = tx.Exec(`
+            INSERT INTO reviewer_subdivision (user_id, subdivision_id)
+            SELECT $1, unnest($2::int[])
+            ON CONFLICT DO NOTHING
+        `, userID, pq.Array(req.SubdivisionIDs))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to insert into reviewer_subdivision"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reviewer subdivisions updated successfully"})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAutoAssignRoundRobin(t *testing.T) {
+	openTestDB(t)
+	_, sub, emptySub := testPosition(t, nil)
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	var reviewers []string
+	for i, role := range []string{"employee", "admin", "employee", "user"} {
+		var id string
+		err := db.QueryRow(`
+            INSERT INTO users (email, username, password_hash, role, registration_date, ip_address)
+            VALUES ($1, $1, '-', $2, NOW(), '127.0.0.1') RETURNING id::text
+        `, fmt.Sprintf("reviewer%d-%s@example.com", i, suffix), role).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id::text = $1", id) })
+		if _, err := db.Exec("INSERT INTO reviewer_subdivision (user_id, subdivision_id) VALUES ($1, $2)", id, sub); err != nil {
+			t.Fatal(err)
+		}
+		// Соискатели в пуле не получают заявки
+		if role != "user" {
+			reviewers = append(reviewers, id)
+		}
+	}
+	sort.Strings(reviewers)
+
+	assign := func(subdivisionID int) string {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		next, err := autoAssign(tx, 0, subdivisionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return next
+	}
+
+	// Два полных круга: после последнего рецензента очередь возвращается к первому
+	for i := 0; i < 2*len(reviewers); i++ {
+		if got, want := assign(sub), reviewers[i%len(reviewers)]; got != want {
+			t.Errorf("назначение %d: ожидался %s, получено %s", i, want, got)
+		}
+	}
+
+	// Исключённый из пула рецензент пропускается
+	if got := assign(sub); got != reviewers[0] {
+		t.Errorf("ожидался %s, получено %s", reviewers[0], got)
+	}
+	if _, err := db.Exec("DELETE FROM reviewer_subdivision WHERE user_id = $1 AND subdivision_id = $2", reviewers[1], sub); err != nil {
+		t.Fatal(err)
+	}
+	if got := assign(sub); got != reviewers[2] {
+		t.Errorf("после исключения рецензента ожидался %s, получено %s", reviewers[2], got)
+	}
+
+	if got := assign(emptySub); got != "" {
+		t.Errorf("подразделение без пула: ожидалось пустое назначение, получено %s", got)
+	}
+}
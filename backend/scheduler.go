@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type scheduledJob struct {
+	name     string
+	spec     string
+	schedule *cronSchedule
+	run      func() (string, error)
+}
+
+// scheduler выполняет задачи по расписанию только на одном экземпляре — том, что держит
+// advisory-блокировку на выделенном соединении. При обрыве соединения блокировку забирает другой.
+type scheduler struct {
+	jobs   []*scheduledJob
+	leader atomic.Bool
+}
+
+// newScheduler собирает задачи; расписание каждой можно переопределить переменной окружения.
+func newScheduler(sinks []outboxSink) (*scheduler, error) {
+	s := &scheduler{}
+	add := func(name, env, def string, run func() (string, error)) error {
+		spec := envString(env, def)
+		schedule, err := parseCron(spec)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		s.jobs = append(s.jobs, &scheduledJob{name: name, spec: spec, schedule: schedule, run: run})
+		return nil
+	}
+	if err := add("daily_digest", "DIGEST_CRON", "0 8 * * *", sendDailyDigest); err != nil {
+		return nil, err
+	}
+	if err := add("sla_escalation", "SLA_ESCALATION_CRON", "30 * * * *", escalateOverdueBids); err != nil {
+		return nil, err
+	}
+	if err := add("cleanup", "CLEANUP_CRON", "@hourly", func() (string, error) { return runCleanup(sinks) }); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *scheduler) run() {
+	for {
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			log.Printf("Планировщик: нет соединения с базой: %v", err)
+			time.Sleep(30 * time.Second)
+			continue
+		}
+		var locked bool
+		err = conn.QueryRowContext(context.Background(), "SELECT pg_try_advisory_lock(hashtext('scheduler'))").Scan(&locked)
+		if err == nil && locked {
+			log.Print("Планировщик: экземпляр стал ведущим")
+			s.leader.Store(true)
+			s.lead(conn)
+			s.leader.Store(false)
+			// Соединение вернётся в пул, поэтому блокировку снимаем явно
+			conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext('scheduler'))")
+		}
+		conn.Close()
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// lead запускает задачи, пока соединение с блокировкой живо.
+func (s *scheduler) lead(conn *sql.Conn) {
+	due := make(map[*scheduledJob]time.Time, len(s.jobs))
+	for _, job := range s.jobs {
+		due[job] = job.schedule.next(time.Now())
+	}
+	for {
+		if err := conn.PingContext(context.Background()); err != nil {
+			log.Printf("Планировщик: потеряно соединение с блокировкой: %v", err)
+			return
+		}
+		now := time.Now()
+		wake := now.Add(30 * time.Second)
+		for _, job := range s.jobs {
+			at := due[job]
+			if at.IsZero() {
+				continue
+			}
+			if !at.After(now) {
+				s.execute(job, at)
+				at = job.schedule.next(time.Now())
+				due[job] = at
+			}
+			if !at.IsZero() && at.Before(wake) {
+				wake = at
+			}
+		}
+		time.Sleep(time.Until(wake))
+	}
+}
+
+// execute выполняет задачу за плановое время at, если этот запуск ещё никто не сделал.
+func (s *scheduler) execute(job *scheduledJob, at time.Time) {
+	var runID int64
+	err := db.QueryRow(`
+        INSERT INTO job_run (job, scheduled_for) VALUES ($1, $2)
+        ON CONFLICT (job, scheduled_for) DO NOTHING
+        RETURNING id
+    `, job.name, at).Scan(&runID)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Планировщик: не удалось записать запуск %s: %v", job.name, err)
+		return
+	}
+
+	result, err := func() (result string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return job.run()
+	}()
+
+	status, errText := "succeeded", (*string)(nil)
+	if err != nil {
+		status = "failed"
+		e := err.Error()
+		errText = &e
+		log.Printf("Планировщик: задача %s завершилась ошибкой: %v", job.name, err)
+	}
+	_, err = db.Exec(`
+        UPDATE job_run SET finished_at = NOW(), status = $2, result = $3, error = $4 WHERE id = $1
+    `, runID, status, result, errText)
+	if err != nil {
+		log.Printf("Планировщик: не удалось сохранить результат %s: %v", job.name, err)
+	}
+}
+
+func digestBidItem(id int, fio, jobTitle, subdivision string, createdAt time.Time) gin.H {
+	return gin.H{
+		"bid_id": id, "fio": fio, "job_title": jobTitle, "subdivision": subdivision,
+		"created_at": createdAt.Format("02.01.2006"),
+	}
+}
+
+// sendDailyDigest ставит в очередь рецензентам сводку по их подразделениям: заявки за последние
+// сутки и заявки без рецензента дольше UNASSIGNED_BID_THRESHOLD.
+func sendDailyDigest() (string, error) {
+	rows, err := db.Query(`
+        SELECT rs.user_id, eb.id, eb.fio, COALESCE(jt.name, ''), COALESCE(sd.name, ''), eb.created_at,
+            eb.assigned_to IS NULL AND eb.created_at < NOW() - make_interval(secs => $1) AS stale
+        FROM reviewer_subdivision rs
+        JOIN users u ON u.id::text = rs.user_id AND u.role IN ('employee', 'admin')
+        JOIN employee_bid eb ON eb.subdivision_id = rs.subdivision_id AND eb.status = 'submitted'
+        LEFT JOIN job_title jt ON jt.id = eb.job_title_id
+        LEFT JOIN subdivision sd ON sd.id = eb.subdivision_id
+        WHERE eb.created_at > NOW() - interval '1 day'
+            OR (eb.assigned_to IS NULL AND eb.created_at < NOW() - make_interval(secs => $1))
+        ORDER BY rs.user_id, eb.id
+    `, unassignedThreshold().Seconds())
+	if err != nil {
+		return "", err
+	}
+	type digest struct{ fresh, stale []gin.H }
+	digests := map[string]*digest{}
+	var reviewers []string
+	for rows.Next() {
+		var userID, fio, jobTitle, subdivision string
+		var id int
+		var createdAt time.Time
+		var stale bool
+		if err := rows.Scan(&userID, &id, &fio, &jobTitle, &subdivision, &createdAt, &stale); err != nil {
+			rows.Close()
+			return "", err
+		}
+		d, ok := digests[userID]
+		if !ok {
+			d = &digest{fresh: []gin.H{}, stale: []gin.H{}}
+			digests[userID] = d
+			reviewers = append(reviewers, userID)
+		}
+		item := digestBidItem(id, fio, jobTitle, subdivision, createdAt)
+		if stale {
+			d.stale = append(d.stale, item)
+		} else {
+			d.fresh = append(d.fresh, item)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	for _, userID := range reviewers {
+		d := digests[userID]
+		data := gin.H{"new": d.fresh, "stale": d.stale, "new_count": len(d.fresh), "stale_count": len(d.stale)}
+		if err := queueMail(tx, "daily_digest", data, false, "u.id::text = $4", userID); err != nil {
+			return "", err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("reviewers: %d", len(reviewers)), nil
+}
+
+func bidSLA() time.Duration {
+	return envDuration("BID_SLA", 7*24*time.Hour)
+}
+
+// escalateOverdueBids сообщает администраторам о заявках, не рассмотренных дольше BID_SLA.
+// Каждая заявка эскалируется один раз.
+func escalateOverdueBids() (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+        WITH overdue AS (
+            UPDATE employee_bid SET escalated_at = NOW()
+            WHERE status = 'submitted' AND escalated_at IS NULL
+                AND created_at < NOW() - make_interval(secs => $1)
+            RETURNING id, fio, job_title_id, subdivision_id, created_at, assigned_to
+        )
+        SELECT o.id, o.fio, COALESCE(jt.name, ''), COALESCE(sd.name, ''), o.created_at, COALESCE(ru.username, '')
+        FROM overdue o
+        LEFT JOIN job_title jt ON jt.id = o.job_title_id
+        LEFT JOIN subdivision sd ON sd.id = o.subdivision_id
+        LEFT JOIN users ru ON ru.id::text = o.assigned_to
+        ORDER BY o.id
+    `, bidSLA().Seconds())
+	if err != nil {
+		return "", err
+	}
+	bids := []gin.H{}
+	for rows.Next() {
+		var id int
+		var fio, jobTitle, subdivision, assignedName string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &fio, &jobTitle, &subdivision, &createdAt, &assignedName); err != nil {
+			rows.Close()
+			return "", err
+		}
+		item := digestBidItem(id, fio, jobTitle, subdivision, createdAt)
+		item["assigned_to_name"] = assignedName
+		bids = append(bids, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(bids) == 0 {
+		return "bids: 0", nil
+	}
+
+	data := gin.H{"bids": bids, "sla_days": int(bidSLA().Hours() / 24)}
+	if err := queueMail(tx, "sla_escalation", data, true, "u.role = 'admin'"); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("bids: %d", len(bids)), nil
+}
+
+func purgeJobRuns() (int64, error) {
+	result, err := db.Exec(
+		"DELETE FROM job_run WHERE started_at < NOW() - make_interval(secs => $1)",
+		envDuration("JOB_RUN_RETENTION", 30*24*time.Hour).Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// runCleanup удаляет устаревшие служебные записи; ошибка одной очистки не мешает остальным.
+func runCleanup(sinks []outboxSink) (string, error) {
+	purges := []struct {
+		name  string
+		purge func() (int64, error)
+	}{
+		{"idempotency_keys", purgeIdempotencyKeys},
+		{"drafts", purgeExpiredDrafts},
+		{"bid_events", purgeBidEvents},
+		{"outbox", func() (int64, error) { return purgeOutbox(sinks) }},
+		{"job_runs", purgeJobRuns},
+	}
+	var counts []string
+	var errs []error
+	for _, p := range purges {
+		n, err := p.purge()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+			continue
+		}
+		counts = append(counts, fmt.Sprintf("%s: %d", p.name, n))
+	}
+	return strings.Join(counts, ", "), errors.Join(errs...)
+}
+
+type JobRun struct {
+	ID           int64      `json:"id"`
+	Job          string     `json:"job"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	Status       string     `json:"status"`
+	Result       *string    `json:"result"`
+	Error        *string    `json:"error"`
+}
+
+const jobRunSelectSQL = `
+    SELECT id, job, scheduled_for, started_at, finished_at, status, result, error FROM job_run`
+
+func scanJobRun(row interface{ Scan(...interface{}) error }) (JobRun, error) {
+	var r JobRun
+	err := row.Scan(&r.ID, &r.Job, &r.ScheduledFor, &r.StartedAt, &r.FinishedAt, &r.Status, &r.Result, &r.Error)
+	return r, err
+}
+
+// GetScheduledJobs — задачи планировщика с последним запуском, числом сбоев за сутки
+// и временем следующего запуска.
+func GetScheduledJobs(s *scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		jobs := make([]gin.H, 0, len(s.jobs))
+		for _, job := range s.jobs {
+			var lastRun *JobRun
+			r, err := scanJobRun(db.QueryRow(jobRunSelectSQL+" WHERE job = $1 ORDER BY scheduled_for DESC LIMIT 1", job.name))
+			if err == nil {
+				lastRun = &r
+			} else if err != sql.ErrNoRows {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			var failures int
+			err = db.QueryRow(
+				"SELECT COUNT(*) FROM job_run WHERE job = $1 AND status = 'failed' AND started_at > NOW() - interval '1 day'", job.name,
+			).Scan(&failures)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			var nextRun *time.Time
+			if next := job.schedule.next(now); !next.IsZero() {
+				nextRun = &next
+			}
+			jobs = append(jobs, gin.H{
+				"name": job.name, "schedule": job.spec, "next_run_at": nextRun,
+				"last_run": lastRun, "failures_24h": failures,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"leader": s.leader.Load(), "jobs": jobs})
+	}
+}
+
+// GetJobRuns — журнал запусков; ?job=, ?status=running|succeeded|failed, ?limit= (по умолчанию 50).
+func GetJobRuns(c *gin.Context) {
+	qb := &queryBuilder{}
+	if job := c.Query("job"); job != "" {
+		qb.where("job = %s", job)
+	}
+	if status := c.Query("status"); status != "" {
+		qb.where("status = %s", status)
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	rows, err := db.Query(jobRunSelectSQL+qb.whereSQL()+" ORDER BY id DESC LIMIT "+strconv.Itoa(limit), qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		r, err := scanJobRun(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan job runs"})
+			return
+		}
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,797 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// migrations применяются по порядку версий, каждая ровно один раз.
+// Уже выпущенные миграции не редактируются — только добавляются новые.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "search_indexes",
+		SQL: `
+			CREATE EXTENSION IF NOT EXISTS pg_trgm;
+			CREATE INDEX IF NOT EXISTS employee_fio_trgm_idx ON employee USING gin (fio gin_trgm_ops);
+			CREATE INDEX IF NOT EXISTS employee_fio_fts_idx ON employee USING gin (to_tsvector('simple', fio));
+			CREATE INDEX IF NOT EXISTS employee_bid_fio_trgm_idx ON employee_bid USING gin (fio gin_trgm_ops);
+			CREATE INDEX IF NOT EXISTS employee_bid_fio_fts_idx ON employee_bid USING gin (to_tsvector('simple', fio));
+			CREATE INDEX IF NOT EXISTS employee_education_place_trgm_idx ON employee_education USING gin (place gin_trgm_ops);
+			CREATE INDEX IF NOT EXISTS employee_education_bid_place_trgm_idx ON employee_education_bid USING gin (place gin_trgm_ops);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "birth_and_hire_dates",
+		SQL: `
+			ALTER TABLE employee ADD COLUMN IF NOT EXISTS birth_date DATE;
+			ALTER TABLE employee ADD COLUMN IF NOT EXISTS hire_date DATE;
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS birth_date DATE;
+
+			CREATE TABLE IF NOT EXISTS employee_experience (
+				id SERIAL PRIMARY KEY,
+				employee_id INT NOT NULL REFERENCES employee(id) ON DELETE CASCADE,
+				started_on DATE NOT NULL,
+				ended_on DATE,
+				specialty BOOLEAN NOT NULL DEFAULT false
+			);
+			CREATE INDEX IF NOT EXISTS employee_experience_employee_idx ON employee_experience (employee_id);
+
+			CREATE TABLE IF NOT EXISTS employee_experience_bid (
+				id SERIAL PRIMARY KEY,
+				employee_id INT NOT NULL REFERENCES employee_bid(id) ON DELETE CASCADE,
+				started_on DATE NOT NULL,
+				ended_on DATE,
+				specialty BOOLEAN NOT NULL DEFAULT false
+			);
+			CREATE INDEX IF NOT EXISTS employee_experience_bid_employee_idx ON employee_experience_bid (employee_id);
+
+			-- Перевод целых значений в приблизительные даты: последние s_p лет — стаж по специальности,
+			-- предшествующие overall - s_p лет — прочий стаж. Для сотрудников дата приёма — день миграции.
+			UPDATE employee SET
+				birth_date = CURRENT_DATE - make_interval(years => COALESCE(age, 0)),
+				hire_date = CURRENT_DATE;
+			INSERT INTO employee_experience (employee_id, started_on, ended_on, specialty)
+			SELECT id, CURRENT_DATE - make_interval(years => overall_experience), CURRENT_DATE - make_interval(years => s_p_experience), false
+			FROM employee WHERE overall_experience > COALESCE(s_p_experience, 0);
+			INSERT INTO employee_experience (employee_id, started_on, ended_on, specialty)
+			SELECT id, CURRENT_DATE - make_interval(years => s_p_experience), CURRENT_DATE, true
+			FROM employee WHERE s_p_experience > 0;
+
+			UPDATE employee_bid SET birth_date = CURRENT_DATE - make_interval(years => COALESCE(age, 0));
+			INSERT INTO employee_experience_bid (employee_id, started_on, ended_on, specialty)
+			SELECT id, CURRENT_DATE - make_interval(years => overall_experience), CURRENT_DATE - make_interval(years => s_p_experience), false
+			FROM employee_bid WHERE overall_experience > COALESCE(s_p_experience, 0);
+			INSERT INTO employee_experience_bid (employee_id, started_on, ended_on, specialty)
+			SELECT id, CURRENT_DATE - make_interval(years => s_p_experience), CURRENT_DATE, true
+			FROM employee_bid WHERE s_p_experience > 0;
+
+			ALTER TABLE employee DROP COLUMN age, DROP COLUMN overall_experience, DROP COLUMN s_p_experience;
+			ALTER TABLE employee_bid DROP COLUMN age, DROP COLUMN overall_experience, DROP COLUMN s_p_experience;
+
+			-- Возраст и стаж вычисляются при чтении. Текущая работа у нас считается стажем по специальности.
+			CREATE VIEW employee_computed AS
+			SELECT
+				e.id, e.fio, e.job_title_id, e.subdivision_id, e.birth_date, e.hire_date,
+				COALESCE(date_part('year', age(e.birth_date))::int, 0) AS age,
+				floor((COALESCE(x.total_days, 0) + COALESCE(CURRENT_DATE - e.hire_date, 0)) / 365.25)::int AS overall_experience,
+				floor((COALESCE(x.sp_days, 0) + COALESCE(CURRENT_DATE - e.hire_date, 0)) / 365.25)::int AS s_p_experience
+			FROM employee e
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience WHERE employee_id = e.id
+			) x ON true;
+
+			CREATE VIEW employee_bid_computed AS
+			SELECT
+				eb.id, eb.fio, eb.job_title_id, eb.subdivision_id, eb.read, eb.birth_date,
+				COALESCE(date_part('year', age(eb.birth_date))::int, 0) AS age,
+				floor(COALESCE(x.total_days, 0) / 365.25)::int AS overall_experience,
+				floor(COALESCE(x.sp_days, 0) / 365.25)::int AS s_p_experience
+			FROM employee_bid eb
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience_bid WHERE employee_id = eb.id
+			) x ON true;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "employee_assignments",
+		SQL: `
+			-- Интервал назначения полуоткрытый: [effective_from, effective_to).
+			-- employee.job_title_id / subdivision_id остаются копией текущего назначения.
+			CREATE TABLE IF NOT EXISTS employee_assignment (
+				id SERIAL PRIMARY KEY,
+				employee_id INT NOT NULL REFERENCES employee(id) ON DELETE CASCADE,
+				job_title_id INT NOT NULL REFERENCES job_title(id),
+				subdivision_id INT NOT NULL REFERENCES subdivision(id),
+				effective_from DATE NOT NULL,
+				effective_to DATE,
+				kind TEXT NOT NULL DEFAULT 'hire' CHECK (kind IN ('hire', 'transfer', 'promotion')),
+				note TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				CHECK (effective_to IS NULL OR effective_to > effective_from)
+			);
+			CREATE UNIQUE INDEX IF NOT EXISTS employee_assignment_open_idx ON employee_assignment (employee_id) WHERE effective_to IS NULL;
+			CREATE INDEX IF NOT EXISTS employee_assignment_period_idx ON employee_assignment (employee_id, effective_from, effective_to);
+
+			INSERT INTO employee_assignment (employee_id, job_title_id, subdivision_id, effective_from, kind)
+			SELECT id, job_title_id, subdivision_id, COALESCE(hire_date, CURRENT_DATE), 'hire'
+			FROM employee;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "headcount_quota",
+		SQL: `
+			-- job_title.count — штатная численность должности по всей организации (NULL — без ограничения).
+			-- headcount_quota дополнительно ограничивает численность должности в конкретном подразделении.
+			CREATE TABLE IF NOT EXISTS headcount_quota (
+				job_title_id INT NOT NULL REFERENCES job_title(id) ON DELETE CASCADE,
+				subdivision_id INT NOT NULL REFERENCES subdivision(id) ON DELETE CASCADE,
+				positions INT NOT NULL CHECK (positions >= 0),
+				PRIMARY KEY (job_title_id, subdivision_id)
+			);
+			CREATE INDEX IF NOT EXISTS employee_job_title_subdivision_idx ON employee (job_title_id, subdivision_id);
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "vacancies",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS vacancy (
+				id SERIAL PRIMARY KEY,
+				job_title_id INT NOT NULL REFERENCES job_title(id),
+				subdivision_id INT NOT NULL REFERENCES subdivision(id),
+				description TEXT NOT NULL DEFAULT '',
+				requirements TEXT NOT NULL DEFAULT '',
+				positions INT NOT NULL DEFAULT 1 CHECK (positions > 0),
+				opens_on DATE NOT NULL DEFAULT CURRENT_DATE,
+				closes_on DATE,
+				status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+				created_by TEXT, -- users.id в текстовом виде, как в JWT (user_id)
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				closed_at TIMESTAMPTZ,
+				CHECK (closes_on IS NULL OR closes_on >= opens_on)
+			);
+			CREATE INDEX IF NOT EXISTS vacancy_open_idx ON vacancy (job_title_id, subdivision_id) WHERE status = 'open';
+
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS vacancy_id INT REFERENCES vacancy(id);
+			ALTER TABLE employee ADD COLUMN IF NOT EXISTS vacancy_id INT REFERENCES vacancy(id) ON DELETE SET NULL;
+			CREATE INDEX IF NOT EXISTS employee_vacancy_idx ON employee (vacancy_id);
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "job_requirements",
+		SQL: `
+			CREATE OR REPLACE VIEW employee_bid_computed AS
+			SELECT
+				eb.id, eb.fio, eb.job_title_id, eb.subdivision_id, eb.read, eb.birth_date,
+				COALESCE(date_part('year', age(eb.birth_date))::int, 0) AS age,
+				floor(COALESCE(x.total_days, 0) / 365.25)::int AS overall_experience,
+				floor(COALESCE(x.sp_days, 0) / 365.25)::int AS s_p_experience,
+				eb.vacancy_id
+			FROM employee_bid eb
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience_bid WHERE employee_id = eb.id
+			) x ON true;
+
+			-- Требования задаются либо для должности, либо для конкретной вакансии;
+			-- требования вакансии имеют приоритет над требованиями должности.
+			CREATE TABLE IF NOT EXISTS job_requirement (
+				id SERIAL PRIMARY KEY,
+				job_title_id INT UNIQUE REFERENCES job_title(id) ON DELETE CASCADE,
+				vacancy_id INT UNIQUE REFERENCES vacancy(id) ON DELETE CASCADE,
+				min_overall_experience INT NOT NULL DEFAULT 0 CHECK (min_overall_experience >= 0),
+				min_s_p_experience INT NOT NULL DEFAULT 0 CHECK (min_s_p_experience >= 0),
+				CHECK ((job_title_id IS NULL) <> (vacancy_id IS NULL))
+			);
+			CREATE TABLE IF NOT EXISTS job_requirement_language (
+				requirement_id INT NOT NULL REFERENCES job_requirement(id) ON DELETE CASCADE,
+				language_id INT NOT NULL REFERENCES languages(id),
+				min_level TEXT NOT NULL CHECK (min_level IN ('A1', 'A2', 'B1', 'B2', 'C1', 'C2')),
+				PRIMARY KEY (requirement_id, language_id)
+			);
+			CREATE TABLE IF NOT EXISTS job_requirement_education (
+				requirement_id INT NOT NULL REFERENCES job_requirement(id) ON DELETE CASCADE,
+				education_id INT NOT NULL REFERENCES education(id),
+				PRIMARY KEY (requirement_id, education_id)
+			);
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "bid_comments",
+		SQL: `
+			-- bid_id без внешнего ключа: заявка удаляется при решении, а обсуждение должно остаться.
+			-- При приёме комментарии получают employee_id нового сотрудника.
+			CREATE TABLE IF NOT EXISTS bid_comment (
+				id SERIAL PRIMARY KEY,
+				bid_id INT NOT NULL,
+				employee_id INT REFERENCES employee(id) ON DELETE SET NULL,
+				parent_id INT REFERENCES bid_comment(id) ON DELETE CASCADE,
+				author_id TEXT NOT NULL,
+				body TEXT NOT NULL,
+				decision TEXT CHECK (decision IN ('accepted', 'rejected')),
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMPTZ
+			);
+			CREATE INDEX IF NOT EXISTS bid_comment_bid_idx ON bid_comment (bid_id, created_at);
+			CREATE INDEX IF NOT EXISTS bid_comment_employee_idx ON bid_comment (employee_id);
+
+			CREATE TABLE IF NOT EXISTS bid_comment_revision (
+				id SERIAL PRIMARY KEY,
+				comment_id INT NOT NULL REFERENCES bid_comment(id) ON DELETE CASCADE,
+				body TEXT NOT NULL,
+				edited_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS bid_comment_revision_comment_idx ON bid_comment_revision (comment_id);
+
+			CREATE TABLE IF NOT EXISTS bid_comment_mention (
+				comment_id INT NOT NULL REFERENCES bid_comment(id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL,
+				PRIMARY KEY (comment_id, user_id)
+			);
+			CREATE INDEX IF NOT EXISTS bid_comment_mention_user_idx ON bid_comment_mention (user_id);
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "bid_reviewers",
+		SQL: `
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS assigned_to TEXT;
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMPTZ;
+			CREATE INDEX IF NOT EXISTS employee_bid_assigned_idx ON employee_bid (assigned_to);
+
+			CREATE OR REPLACE VIEW employee_bid_computed AS
+			SELECT
+				eb.id, eb.fio, eb.job_title_id, eb.subdivision_id, eb.read, eb.birth_date,
+				COALESCE(date_part('year', age(eb.birth_date))::int, 0) AS age,
+				floor(COALESCE(x.total_days, 0) / 365.25)::int AS overall_experience,
+				floor(COALESCE(x.sp_days, 0) / 365.25)::int AS s_p_experience,
+				eb.vacancy_id, eb.created_at, eb.assigned_to, eb.assigned_at
+			FROM employee_bid eb
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience_bid WHERE employee_id = eb.id
+			) x ON true;
+
+			-- Пул рецензентов подразделения и указатель очереди round-robin
+			CREATE TABLE IF NOT EXISTS reviewer_subdivision (
+				user_id TEXT NOT NULL,
+				subdivision_id INT NOT NULL REFERENCES subdivision(id) ON DELETE CASCADE,
+				PRIMARY KEY (user_id, subdivision_id)
+			);
+			CREATE INDEX IF NOT EXISTS reviewer_subdivision_subdivision_idx ON reviewer_subdivision (subdivision_id, user_id);
+
+			CREATE TABLE IF NOT EXISTS reviewer_rotation (
+				subdivision_id INT PRIMARY KEY REFERENCES subdivision(id) ON DELETE CASCADE,
+				last_user_id TEXT NOT NULL
+			);
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "interviews",
+		SQL: `
+			-- Как и у комментариев, bid_id без внешнего ключа; candidate_name хранит ФИО
+			-- на момент назначения, чтобы календарь кандидата работал и после решения по заявке.
+			CREATE TABLE IF NOT EXISTS interview (
+				id SERIAL PRIMARY KEY,
+				bid_id INT NOT NULL,
+				employee_id INT REFERENCES employee(id) ON DELETE SET NULL,
+				candidate_name TEXT NOT NULL,
+				starts_at TIMESTAMPTZ NOT NULL,
+				duration_minutes INT NOT NULL CHECK (duration_minutes > 0),
+				location TEXT NOT NULL DEFAULT '',
+				status TEXT NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled')),
+				sequence INT NOT NULL DEFAULT 0,
+				created_by TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS interview_bid_idx ON interview (bid_id, starts_at);
+
+			CREATE TABLE IF NOT EXISTS interview_interviewer (
+				interview_id INT NOT NULL REFERENCES interview(id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL,
+				PRIMARY KEY (interview_id, user_id)
+			);
+			CREATE INDEX IF NOT EXISTS interview_interviewer_user_idx ON interview_interviewer (user_id);
+
+			CREATE TABLE IF NOT EXISTS interview_feedback (
+				interview_id INT NOT NULL REFERENCES interview(id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL,
+				rating INT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+				recommendation TEXT NOT NULL CHECK (recommendation IN ('strong_no', 'no', 'yes', 'strong_yes')),
+				notes TEXT NOT NULL DEFAULT '',
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (interview_id, user_id)
+			);
+
+			-- Токены подписок на календарь собеседований; перевыпуск токена отключает старую ссылку
+			CREATE TABLE IF NOT EXISTS calendar_feed (
+				kind TEXT NOT NULL CHECK (kind IN ('interviewers', 'bids')),
+				subject_id TEXT NOT NULL,
+				token TEXT NOT NULL UNIQUE,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (kind, subject_id)
+			);
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "attachments",
+		SQL: `
+			-- Содержимое файлов лежит в хранилище (локальный диск или S3), здесь только метаданные.
+			-- При приёме вложения получают employee_id, при отказе удаляются вместе с файлами.
+			CREATE TABLE IF NOT EXISTS attachment (
+				id SERIAL PRIMARY KEY,
+				bid_id INT NOT NULL,
+				employee_id INT REFERENCES employee(id) ON DELETE SET NULL,
+				filename TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size BIGINT NOT NULL CHECK (size >= 0),
+				sha256 TEXT NOT NULL,
+				storage_key TEXT NOT NULL UNIQUE,
+				uploaded_by TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS attachment_bid_idx ON attachment (bid_id);
+			CREATE INDEX IF NOT EXISTS attachment_employee_idx ON attachment (employee_id);
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "duplicate_bids",
+		SQL: `
+			-- Нормализация ФИО для поиска повторных заявок: регистр, ё/е, пунктуация и лишние пробелы
+			CREATE OR REPLACE FUNCTION normalize_fio(t TEXT) RETURNS TEXT AS $$
+				SELECT btrim(regexp_replace(
+					regexp_replace(lower(translate(t, 'Ёё', 'Ее')), '[^[:alpha:][:space:]-]', '', 'g'),
+					'\s+', ' ', 'g'))
+			$$ LANGUAGE SQL IMMUTABLE;
+
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS submitted_by TEXT;
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS duplicate_of INT REFERENCES employee_bid(id) ON DELETE SET NULL;
+			CREATE INDEX IF NOT EXISTS employee_bid_fio_norm_idx ON employee_bid (normalize_fio(fio));
+			CREATE INDEX IF NOT EXISTS employee_fio_norm_idx ON employee (normalize_fio(fio));
+			-- Триграммные индексы для поиска похожих ФИО оператором %
+			CREATE INDEX IF NOT EXISTS employee_bid_fio_norm_trgm_idx ON employee_bid USING gin (normalize_fio(fio) gin_trgm_ops);
+			CREATE INDEX IF NOT EXISTS employee_fio_norm_trgm_idx ON employee USING gin (normalize_fio(fio) gin_trgm_ops);
+
+			CREATE OR REPLACE VIEW employee_bid_computed AS
+			SELECT
+				eb.id, eb.fio, eb.job_title_id, eb.subdivision_id, eb.read, eb.birth_date,
+				COALESCE(date_part('year', age(eb.birth_date))::int, 0) AS age,
+				floor(COALESCE(x.total_days, 0) / 365.25)::int AS overall_experience,
+				floor(COALESCE(x.sp_days, 0) / 365.25)::int AS s_p_experience,
+				eb.vacancy_id, eb.created_at, eb.assigned_to, eb.assigned_at,
+				eb.submitted_by, eb.duplicate_of
+			FROM employee_bid eb
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience_bid WHERE employee_id = eb.id
+			) x ON true;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "idempotency_keys",
+		SQL: `
+			-- status IS NULL — запрос с этим ключом ещё выполняется
+			CREATE TABLE IF NOT EXISTS idempotency_key (
+				scope TEXT NOT NULL,
+				key TEXT NOT NULL,
+				request_hash TEXT NOT NULL,
+				status INT,
+				content_type TEXT,
+				response BYTEA,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (scope, key)
+			);
+			CREATE INDEX IF NOT EXISTS idempotency_key_created_idx ON idempotency_key (created_at);
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "bid_drafts",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS bid_draft (
+				id SERIAL PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				data JSONB NOT NULL DEFAULT '{}',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				expires_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS bid_draft_user_idx ON bid_draft (user_id, updated_at);
+			CREATE INDEX IF NOT EXISTS bid_draft_expires_idx ON bid_draft (expires_at);
+		`,
+	},
+	{
+		Version: 14,
+		Name:    "bid_withdrawal",
+		SQL: `
+			-- Отозванная заявка остаётся в базе, но пропадает из очереди рецензентов
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'submitted'
+				CHECK (status IN ('submitted', 'withdrawn'));
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS withdrawn_at TIMESTAMPTZ;
+
+			-- Правки заявки заявителем: changes — {"поле": {"old": ..., "new": ...}}
+			CREATE TABLE IF NOT EXISTS bid_revision (
+				id SERIAL PRIMARY KEY,
+				bid_id INT NOT NULL REFERENCES employee_bid(id) ON DELETE CASCADE,
+				changed_by TEXT NOT NULL,
+				changes JSONB NOT NULL,
+				changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS bid_revision_bid_idx ON bid_revision (bid_id);
+
+			CREATE OR REPLACE VIEW employee_bid_computed AS
+			SELECT
+				eb.id, eb.fio, eb.job_title_id, eb.subdivision_id, eb.read, eb.birth_date,
+				COALESCE(date_part('year', age(eb.birth_date))::int, 0) AS age,
+				floor(COALESCE(x.total_days, 0) / 365.25)::int AS overall_experience,
+				floor(COALESCE(x.sp_days, 0) / 365.25)::int AS s_p_experience,
+				eb.vacancy_id, eb.created_at, eb.assigned_to, eb.assigned_at,
+				eb.submitted_by, eb.duplicate_of, eb.status, eb.withdrawn_at
+			FROM employee_bid eb
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience_bid WHERE employee_id = eb.id
+			) x ON true;
+		`,
+	},
+	{
+		Version: 15,
+		Name:    "bid_events",
+		SQL: `
+			-- Журнал событий по заявкам для живого обновления входящих; id служит Last-Event-ID
+			CREATE TABLE IF NOT EXISTS bid_event (
+				id BIGSERIAL PRIMARY KEY,
+				kind TEXT NOT NULL,
+				bid_id INT NOT NULL,
+				data JSONB NOT NULL DEFAULT '{}',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS bid_event_created_idx ON bid_event (created_at);
+		`,
+	},
+	{
+		Version: 16,
+		Name:    "webhooks",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS webhook_subscription (
+				id SERIAL PRIMARY KEY,
+				url TEXT NOT NULL,
+				secret TEXT NOT NULL,
+				event_types TEXT[] NOT NULL,
+				active BOOLEAN NOT NULL DEFAULT true,
+				created_by TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+
+			-- Очередь доставки: pending ждёт next_attempt_at, dead — исчерпаны попытки (dead-letter)
+			CREATE TABLE IF NOT EXISTS webhook_delivery (
+				id BIGSERIAL PRIMARY KEY,
+				subscription_id INT NOT NULL REFERENCES webhook_subscription(id) ON DELETE CASCADE,
+				event_type TEXT NOT NULL,
+				payload JSONB NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+				attempts INT NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				last_status_code INT,
+				last_error TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				delivered_at TIMESTAMPTZ
+			);
+			CREATE INDEX IF NOT EXISTS webhook_delivery_due_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+			CREATE INDEX IF NOT EXISTS webhook_delivery_subscription_idx ON webhook_delivery (subscription_id, created_at);
+
+			CREATE TABLE IF NOT EXISTS webhook_attempt (
+				id BIGSERIAL PRIMARY KEY,
+				delivery_id BIGINT NOT NULL REFERENCES webhook_delivery(id) ON DELETE CASCADE,
+				attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				status_code INT,
+				error TEXT,
+				duration_ms INT NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS webhook_attempt_delivery_idx ON webhook_attempt (delivery_id);
+		`,
+	},
+	{
+		Version: 17,
+		Name:    "outbox",
+		SQL: `
+			-- Сообщения пишутся в транзакции изменения; outbox_dispatch отмечает, каким приёмникам
+			-- сообщение уже передано, отметка ставится в транзакции самой передачи.
+			CREATE TABLE IF NOT EXISTS outbox (
+				id BIGSERIAL PRIMARY KEY,
+				event_type TEXT NOT NULL,
+				payload JSONB NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS outbox_created_idx ON outbox (created_at);
+
+			CREATE TABLE IF NOT EXISTS outbox_dispatch (
+				outbox_id BIGINT NOT NULL REFERENCES outbox(id) ON DELETE CASCADE,
+				sink TEXT NOT NULL,
+				dispatched_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (sink, outbox_id)
+			);
+
+			-- Неудачные попытки передачи сообщения приёмнику; после OUTBOX_MAX_ATTEMPTS сообщение
+			-- откладывается и больше не задерживает остальные
+			CREATE TABLE IF NOT EXISTS outbox_failure (
+				outbox_id BIGINT NOT NULL REFERENCES outbox(id) ON DELETE CASCADE,
+				sink TEXT NOT NULL,
+				attempts INT NOT NULL DEFAULT 1,
+				last_error TEXT NOT NULL DEFAULT '',
+				failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (sink, outbox_id)
+			);
+		`,
+	},
+	{
+		Version: 18,
+		Name:    "mail",
+		SQL: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT 'ru' CHECK (locale IN ('ru', 'en'));
+			-- Отказ от необязательных писем; подтверждение подачи и решение по заявке приходят всегда
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS email_opt_out BOOLEAN NOT NULL DEFAULT false;
+
+			-- Письма хранятся до отправки как шаблон и данные, текст собирается при отправке
+			CREATE TABLE IF NOT EXISTS mail_message (
+				id BIGSERIAL PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				recipient TEXT NOT NULL,
+				locale TEXT NOT NULL,
+				template TEXT NOT NULL,
+				data JSONB NOT NULL DEFAULT '{}',
+				essential BOOLEAN NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+				attempts INT NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				last_error TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				sent_at TIMESTAMPTZ
+			);
+			CREATE INDEX IF NOT EXISTS mail_message_due_idx ON mail_message (next_attempt_at) WHERE status = 'pending';
+		`,
+	},
+	{
+		Version: 19,
+		Name:    "telegram",
+		SQL: `
+			-- Личный чат с ботом; id пользователя Telegram совпадает с id этого чата
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS telegram_chat_id BIGINT UNIQUE;
+
+			-- Одноразовые коды для команды /start, выдаются в веб-интерфейсе
+			CREATE TABLE IF NOT EXISTS telegram_link_code (
+				code TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL
+			);
+		`,
+	},
+	{
+		Version: 20,
+		Name:    "scheduler",
+		SQL: `
+			-- Один запуск на задачу и плановое время, даже если ведущий экземпляр сменился
+			CREATE TABLE IF NOT EXISTS job_run (
+				id BIGSERIAL PRIMARY KEY,
+				job TEXT NOT NULL,
+				scheduled_for TIMESTAMPTZ NOT NULL,
+				started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				finished_at TIMESTAMPTZ,
+				status TEXT NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'succeeded', 'failed')),
+				result TEXT,
+				error TEXT,
+				UNIQUE (job, scheduled_for)
+			);
+
+			-- Заявка эскалируется администраторам один раз
+			ALTER TABLE employee_bid ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMPTZ;
+		`,
+	},
+	{
+		Version: 21,
+		Name:    "bid_stat",
+		SQL: `
+			-- Без даты рождения возраст неизвестен: NULL, а не 0, иначе такие записи попадают
+			-- в младшую корзину аналитики и совпадают между собой при поиске дублей.
+			CREATE OR REPLACE VIEW employee_computed AS
+			SELECT
+				e.id, e.fio, e.job_title_id, e.subdivision_id, e.birth_date, e.hire_date,
+				date_part('year', age(e.birth_date))::int AS age,
+				floor((COALESCE(x.total_days, 0) + COALESCE(CURRENT_DATE - e.hire_date, 0)) / 365.25)::int AS overall_experience,
+				floor((COALESCE(x.sp_days, 0) + COALESCE(CURRENT_DATE - e.hire_date, 0)) / 365.25)::int AS s_p_experience
+			FROM employee e
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience WHERE employee_id = e.id
+			) x ON true;
+
+			CREATE OR REPLACE VIEW employee_bid_computed AS
+			SELECT
+				eb.id, eb.fio, eb.job_title_id, eb.subdivision_id, eb.read, eb.birth_date,
+				date_part('year', age(eb.birth_date))::int AS age,
+				floor(COALESCE(x.total_days, 0) / 365.25)::int AS overall_experience,
+				floor(COALESCE(x.sp_days, 0) / 365.25)::int AS s_p_experience,
+				eb.vacancy_id, eb.created_at, eb.assigned_to, eb.assigned_at,
+				eb.submitted_by, eb.duplicate_of, eb.status, eb.withdrawn_at
+			FROM employee_bid eb
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) AS total_days,
+					SUM(COALESCE(ended_on, CURRENT_DATE) - started_on) FILTER (WHERE specialty) AS sp_days
+				FROM employee_experience_bid WHERE employee_id = eb.id
+			) x ON true;
+
+			-- Учётная запись по каждой заявке для аналитики: сама заявка удаляется после решения.
+			-- Возраст и стаж фиксируются на момент подачи (и последней правки заявителем).
+			CREATE TABLE IF NOT EXISTS bid_stat (
+				bid_id INT PRIMARY KEY,
+				job_title_id INT NOT NULL,
+				subdivision_id INT NOT NULL,
+				age INT,
+				overall_experience INT NOT NULL,
+				s_p_experience INT NOT NULL,
+				submitted_at TIMESTAMPTZ NOT NULL,
+				decided_at TIMESTAMPTZ,
+				outcome TEXT CHECK (outcome IN ('accepted', 'rejected', 'withdrawn', 'merged')),
+				CHECK ((decided_at IS NULL) = (outcome IS NULL))
+			);
+			CREATE INDEX IF NOT EXISTS bid_stat_submitted_idx ON bid_stat (submitted_at);
+			CREATE INDEX IF NOT EXISTS bid_stat_decided_idx ON bid_stat (decided_at) WHERE decided_at IS NOT NULL;
+			CREATE INDEX IF NOT EXISTS employee_assignment_from_idx ON employee_assignment (effective_from);
+
+			-- Решения по уже удалённым заявкам восстановить нельзя, учитываются только текущие
+			INSERT INTO bid_stat (bid_id, job_title_id, subdivision_id, age, overall_experience, s_p_experience, submitted_at, decided_at, outcome)
+			SELECT id, job_title_id, subdivision_id, age, overall_experience, s_p_experience, created_at,
+				CASE WHEN status = 'withdrawn' THEN COALESCE(withdrawn_at, NOW()) END,
+				CASE WHEN status = 'withdrawn' THEN 'withdrawn' END
+			FROM employee_bid_computed
+			ON CONFLICT (bid_id) DO NOTHING;
+		`,
+	},
+	{
+		Version: 22,
+		Name:    "documents",
+		SQL: `
+			-- Шаблоны приказов: текст с подстановками text/template, строка на абзац, "# " — заголовок
+			CREATE TABLE IF NOT EXISTS document_template (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				body TEXT NOT NULL,
+				updated_by TEXT,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+
+			-- Сформированные документы, файлы лежат в том же хранилище, что и вложения
+			CREATE TABLE IF NOT EXISTS employee_document (
+				id SERIAL PRIMARY KEY,
+				employee_id INT NOT NULL REFERENCES employee(id) ON DELETE CASCADE,
+				kind TEXT NOT NULL CHECK (kind IN ('order', 'personal_card')),
+				template_id INT REFERENCES document_template(id) ON DELETE SET NULL,
+				title TEXT NOT NULL,
+				filename TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size BIGINT NOT NULL,
+				sha256 TEXT NOT NULL,
+				storage_key TEXT NOT NULL UNIQUE,
+				generated_by TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS employee_document_employee_idx ON employee_document (employee_id);
+
+			INSERT INTO document_template (name, body)
+			SELECT 'Приказ о приёме работника на работу', E'# ПРИКАЗ (распоряжение) о приёме работника на работу\n'
+				'от {{.today}} № ______\n'
+				'Принять на работу {{.fio}}, {{.birth_date}} года рождения, в подразделение «{{.subdivision}}» на должность «{{.job_title}}» с {{.hire_date}}.\n'
+				'Табельный номер: {{.employee_id}}.\n'
+				'Основание: заявление работника.\n'
+				'Руководитель организации ____________________\n'
+				'С приказом (распоряжением) работник ознакомлен ____________________ «___» __________ 20__ г.'
+			WHERE NOT EXISTS (SELECT 1 FROM document_template);
+		`,
+	},
+	{
+		Version: 23,
+		Name:    "subdivision_hierarchy",
+		SQL: `
+			-- Подразделения образуют дерево; циклы не допускает перенос ветки (moveSubdivision)
+			ALTER TABLE subdivision ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES subdivision(id) ON DELETE RESTRICT;
+			ALTER TABLE subdivision ADD COLUMN IF NOT EXISTS head_employee_id INT REFERENCES employee(id) ON DELETE SET NULL;
+			ALTER TABLE subdivision DROP CONSTRAINT IF EXISTS subdivision_parent_not_self;
+			ALTER TABLE subdivision ADD CONSTRAINT subdivision_parent_not_self CHECK (parent_id <> id);
+			CREATE INDEX IF NOT EXISTS subdivision_parent_idx ON subdivision (parent_id);
+		`,
+	},
+	{
+		Version: 24,
+		Name:    "reporting_lines",
+		SQL: `
+			-- Непосредственный руководитель; циклы не допускает setEmployeeManager
+			ALTER TABLE employee ADD COLUMN IF NOT EXISTS manager_id INT REFERENCES employee(id) ON DELETE SET NULL;
+			ALTER TABLE employee DROP CONSTRAINT IF EXISTS employee_manager_not_self;
+			ALTER TABLE employee ADD CONSTRAINT employee_manager_not_self CHECK (manager_id <> id);
+			CREATE INDEX IF NOT EXISTS employee_manager_idx ON employee (manager_id);
+
+			-- Учётная запись с ролью employee и employee_scope = 'own' видит только свою линию
+			-- подчинения и своё подразделение; без привязки к сотруднику — никого
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS employee_id INT UNIQUE REFERENCES employee(id) ON DELETE SET NULL;
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS employee_scope TEXT NOT NULL DEFAULT 'all' CHECK (employee_scope IN ('all', 'own'));
+		`,
+	},
+}
+
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	for _, m := range migrations {
+		var applied bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", m.Version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("check migration %d: %w", m.Version, err)
+		}
+		if applied {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m.SQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Применена миграция %d: %s", m.Version, m.Name)
+	}
+	return nil
+}
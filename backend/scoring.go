@@ -0,0 +1,411 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LanguageRequirement struct {
+	LanguageID int    `json:"language_id" binding:"required,min=1"`
+	Language   string `json:"language"`
+	MinLevel   string `json:"min_level" binding:"required,oneof=A1 A2 B1 B2 C1 C2"`
+}
+
+type EducationRequirement struct {
+	EducationID int    `json:"education_id" binding:"required,min=1"`
+	Name        string `json:"name"`
+}
+
+type Requirements struct {
+	Source               string                 `json:"source"`
+	MinOverallExperience int                    `json:"min_overall_experience" binding:"min=0"`
+	MinSPExperience      int                    `json:"min_s_p_experience" binding:"min=0"`
+	Languages            []LanguageRequirement  `json:"languages" binding:"dive"`
+	Educations           []EducationRequirement `json:"educations" binding:"dive"`
+}
+
+type CriterionResult struct {
+	Criterion string  `json:"criterion"`
+	Required  string  `json:"required"`
+	Actual    string  `json:"actual"`
+	Matched   bool    `json:"matched"`
+	Points    float64 `json:"points"`
+	MaxPoints float64 `json:"max_points"`
+}
+
+type BidScore struct {
+	BidID        int               `json:"bid_id"`
+	EmployeeName string            `json:"employee_name"`
+	JobTitle     string            `json:"job_title"`
+	Subdivision  string            `json:"subdivision"`
+	Score        float64           `json:"score"`
+	Requirements string            `json:"requirements_source"`
+	Criteria     []CriterionResult `json:"criteria"`
+	Missing      []string          `json:"missing"`
+}
+
+// Веса критериев. Критерии, для которых требование не задано, в расчёт не входят,
+// итоговый балл нормируется к 100 по сумме весов заданных критериев.
+const (
+	weightOverallExperience = 20
+	weightSPExperience      = 30
+	weightLanguages         = 30
+	weightEducation         = 20
+)
+
+var cefrRank = map[string]int{"A1": 1, "A2": 2, "B1": 3, "B2": 4, "C1": 5, "C2": 6}
+
+// scoreBid сравнивает анкету с требованиями. Стаж даёт частичный балл пропорционально
+// набранному, язык ниже требуемого уровня — половину балла, образование засчитывается,
+// если есть хотя бы один из требуемых видов.
+func scoreBid(bid Bid, req Requirements) BidScore {
+	result := BidScore{
+		BidID:        bid.ID,
+		EmployeeName: bid.EmployeeName,
+		JobTitle:     bid.JobTitle,
+		Subdivision:  bid.Subdivision,
+		Requirements: req.Source,
+		Criteria:     []CriterionResult{},
+		Missing:      []string{},
+	}
+
+	add := func(r CriterionResult) {
+		result.Criteria = append(result.Criteria, r)
+		if !r.Matched {
+			result.Missing = append(result.Missing, r.Criterion+": "+r.Required)
+		}
+	}
+
+	experience := func(name string, required, actual int, weight float64) {
+		if required <= 0 {
+			return
+		}
+		add(CriterionResult{
+			Criterion: name,
+			Required:  fmt.Sprintf(">= %d years", required),
+			Actual:    fmt.Sprintf("%d years", actual),
+			Matched:   actual >= required,
+			Points:    weight * math.Min(float64(actual)/float64(required), 1),
+			MaxPoints: weight,
+		})
+	}
+	experience("overall_experience", req.MinOverallExperience, bid.OverallExp, weightOverallExperience)
+	experience("s_p_experience", req.MinSPExperience, bid.SPExp, weightSPExperience)
+
+	if len(req.Languages) > 0 {
+		levels := map[int]string{}
+		for _, l := range bid.Languages {
+			if cefrRank[l.Level] > cefrRank[levels[l.ID]] {
+				levels[l.ID] = l.Level
+			}
+		}
+		per := float64(weightLanguages) / float64(len(req.Languages))
+		for _, lr := range req.Languages {
+			r := CriterionResult{
+				Criterion: "language " + lr.Language,
+				Required:  lr.MinLevel,
+				Actual:    levels[lr.LanguageID],
+				MaxPoints: per,
+			}
+			switch {
+			case levels[lr.LanguageID] == "":
+				r.Actual = "none"
+			case cefrRank[levels[lr.LanguageID]] >= cefrRank[lr.MinLevel]:
+				r.Matched = true
+				r.Points = per
+			default:
+				r.Points = per / 2
+			}
+			add(r)
+		}
+	}
+
+	if len(req.Educations) > 0 {
+		r := CriterionResult{Criterion: "education", MaxPoints: weightEducation, Actual: "none"}
+		for i, er := range req.Educations {
+			if i > 0 {
+				r.Required += " or "
+			}
+			r.Required += er.Name
+			for _, e := range bid.Educations {
+				if e.ID == er.EducationID {
+					r.Matched = true
+					r.Points = weightEducation
+					r.Actual = e.Name
+				}
+			}
+		}
+		add(r)
+	}
+
+	var points, max float64
+	for _, r := range result.Criteria {
+		points += r.Points
+		max += r.MaxPoints
+	}
+	if max == 0 {
+		result.Score = 100
+	} else {
+		result.Score = math.Round(points/max*1000) / 10
+	}
+	return result
+}
+
+// loadRequirements возвращает требования вакансии, а если их нет — требования должности.
+func loadRequirements(vacancyID *int, jobTitleID int) (Requirements, error) {
+	if vacancyID != nil {
+		req, err := loadRequirementsBy("vacancy_id", *vacancyID)
+		if err != sql.ErrNoRows {
+			req.Source = "vacancy"
+			return req, err
+		}
+	}
+	req, err := loadRequirementsBy("job_title_id", jobTitleID)
+	if err == sql.ErrNoRows {
+		return Requirements{Source: "none", Languages: []LanguageRequirement{}, Educations: []EducationRequirement{}}, nil
+	}
+	req.Source = "job_title"
+	return req, err
+}
+
+func loadRequirementsBy(column string, id int) (Requirements, error) {
+	req := Requirements{Languages: []LanguageRequirement{}, Educations: []EducationRequirement{}}
+	var requirementID int
+	err := db.QueryRow(`
+        SELECT id, min_overall_experience, min_s_p_experience
+        FROM job_requirement WHERE `+column+` = $1
+    `, id).Scan(&requirementID, &req.MinOverallExperience, &req.MinSPExperience)
+	if err != nil {
+		return req, err
+	}
+
+	rows, err := db.Query(`
+        SELECT r.language_id, l.language, r.min_level
+        FROM job_requirement_language r JOIN languages l ON r.language_id = l.id
+        WHERE r.requirement_id = $1
+        ORDER BY l.language
+    `, requirementID)
+	if err != nil {
+		return req, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l LanguageRequirement
+		if err := rows.Scan(&l.LanguageID, &l.Language, &l.MinLevel); err != nil {
+			return req, err
+		}
+		req.Languages = append(req.Languages, l)
+	}
+	if err := rows.Err(); err != nil {
+		return req, err
+	}
+
+	eduRows, err := db.Query(`
+        SELECT r.education_id, e.name
+        FROM job_requirement_education r JOIN education e ON r.education_id = e.id
+        WHERE r.requirement_id = $1
+        ORDER BY e.name
+    `, requirementID)
+	if err != nil {
+		return req, err
+	}
+	defer eduRows.Close()
+	for eduRows.Next() {
+		var e EducationRequirement
+		if err := eduRows.Scan(&e.EducationID, &e.Name); err != nil {
+			return req, err
+		}
+		req.Educations = append(req.Educations, e)
+	}
+	return req, eduRows.Err()
+}
+
+func getJobTitleRequirements(c *gin.Context) {
+	getRequirements(c, "job_title_id", "job_title")
+}
+
+func getVacancyRequirements(c *gin.Context) {
+	getRequirements(c, "vacancy_id", "vacancy")
+}
+
+func getRequirements(c *gin.Context, column, source string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	req, err := loadRequirementsBy(column, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Requirements not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	req.Source = source
+	c.JSON(http.StatusOK, req)
+}
+
+func putJobTitleRequirements(c *gin.Context) {
+	putRequirements(c, "job_title_id")
+}
+
+func putVacancyRequirements(c *gin.Context) {
+	putRequirements(c, "vacancy_id")
+}
+
+func putRequirements(c *gin.Context, column string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req Requirements
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var requirementID int
+	err = tx.QueryRow(`
+        INSERT INTO job_requirement (`+column+`, min_overall_experience, min_s_p_experience)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (`+column+`) DO UPDATE SET
+            min_overall_experience = EXCLUDED.min_overall_experience,
+            min_s_p_experience = EXCLUDED.min_s_p_experience
+        RETURNING id
+    `, id, req.MinOverallExperience, req.MinSPExperience).Scan(&requirementID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job_requirement"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM job_requirement_language WHERE requirement_id = $1", requirementID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from job_requirement_language"})
+		return
+	}
+	for _, l := range req.Languages {
+		_, err := tx.Exec(`
+            INSERT INTO job_requirement_language (requirement_id, language_id, min_level)
+            VALUES ($1, $2, $3)
+        `, requirementID, l.LanguageID, l.MinLevel)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to insert into job_requirement_language"})
+			return
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM job_requirement_education WHERE requirement_id = $1", requirementID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from job_requirement_education"})
+		return
+	}
+	for _, e := range req.Educations {
+		_, err := tx.Exec(`
+            INSERT INTO job_requirement_education (requirement_id, education_id)
+            VALUES ($1, $2)
+        `, requirementID, e.EducationID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to insert into job_requirement_education"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Requirements saved successfully"})
+}
+
+// scoreBids оценивает заявки, подгружая требования один раз на каждую пару вакансия/должность.
+func scoreBids(bids []Bid) ([]BidScore, error) {
+	cache := map[string]Requirements{}
+	scores := make([]BidScore, 0, len(bids))
+	for _, bid := range bids {
+		key := "j" + strconv.Itoa(bid.JobTitleID)
+		if bid.VacancyID != nil {
+			key += "v" + strconv.Itoa(*bid.VacancyID)
+		}
+		req, ok := cache[key]
+		if !ok {
+			var err error
+			req, err = loadRequirements(bid.VacancyID, bid.JobTitleID)
+			if err != nil {
+				return nil, err
+			}
+			cache[key] = req
+		}
+		scores = append(scores, scoreBid(bid, req))
+	}
+	return scores, nil
+}
+
+// GetRankedBids возвращает заявки, отсортированные по соответствию требованиям.
+func GetRankedBids(c *gin.Context) {
+	qb := &queryBuilder{}
+	qb.conds = append(qb.conds, "eb.status = 'submitted'")
+	for _, f := range []string{"job_title_id", "subdivision_id", "vacancy_id"} {
+		if err := qb.inFilter(c, "eb."+f, f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	bids, err := loadBids(qb)
+	if err != nil {
+		log.Printf("Ошибка загрузки заявок для оценки: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	scores, err := scoreBids(bids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load requirements"})
+		return
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	c.JSON(http.StatusOK, scores)
+}
+
+func GetBidScore(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bid ID"})
+		return
+	}
+
+	qb := &queryBuilder{}
+	qb.where("eb.id = %s", id)
+	bids, err := loadBids(qb)
+	if err != nil {
+		log.Printf("Ошибка загрузки заявок для оценки: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(bids) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return
+	}
+	scores, err := scoreBids(bids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load requirements"})
+		return
+	}
+	c.JSON(http.StatusOK, scores[0])
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestScoreBid(t *testing.T) {
+	bid := Bid{
+		ID:         1,
+		OverallExp: 4,
+		SPExp:      3,
+		Languages: []Language{
+			{ID: 1, Name: "Английский", Level: "B1"},
+			{ID: 2, Name: "Немецкий", Level: "C1"},
+		},
+		Educations: []Education{{ID: 2, Name: "Высшее"}},
+	}
+	req := Requirements{
+		Source:               "job_title",
+		MinOverallExperience: 2,
+		MinSPExperience:      6,
+		Languages: []LanguageRequirement{
+			{LanguageID: 1, Language: "Английский", MinLevel: "B2"},
+			{LanguageID: 2, Language: "Немецкий", MinLevel: "B2"},
+		},
+		Educations: []EducationRequirement{{EducationID: 1, Name: "Среднее"}, {EducationID: 2, Name: "Высшее"}},
+	}
+
+	score := scoreBid(bid, req)
+
+	// 20 (стаж) + 15 из 30 (3 из 6 лет) + 7.5 + 15 (языки) + 20 (образование) = 77.5 из 100
+	if score.Score != 77.5 {
+		t.Errorf("unexpected score: %v", score.Score)
+	}
+	if len(score.Criteria) != 5 {
+		t.Errorf("expected 5 criteria, got %d", len(score.Criteria))
+	}
+	if len(score.Missing) != 2 {
+		t.Errorf("expected 2 missing requirements, got %v", score.Missing)
+	}
+}
+
+func TestScoreBidWithoutRequirements(t *testing.T) {
+	score := scoreBid(Bid{ID: 1}, Requirements{Source: "none"})
+	if score.Score != 100 || len(score.Criteria) != 0 {
+		t.Errorf("unexpected score: %+v", score)
+	}
+}
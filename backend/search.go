@@ -0,0 +1,256 @@
+package main
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type SearchHit struct {
+	Type        string            `json:"type"`
+	ID          int               `json:"id"`
+	FIO         string            `json:"fio"`
+	JobTitle    string            `json:"job_title"`
+	Subdivision string            `json:"subdivision"`
+	Rank        float64           `json:"rank"`
+	Highlights  map[string]string `json:"highlights"`
+}
+
+// Ранжирование: сходство триграмм по словам (опечатки, транслит) плюс ts_rank полнотекстового
+// совпадения (порядок слов не важен). Совпадения по месту обучения и языкам весят меньше, чем по ФИО.
+const searchRankSQL = `
+	GREATEST(
+		(SELECT MAX(word_similarity(t, {alias}.fio) + ts_rank(to_tsvector('simple', {alias}.fio), plainto_tsquery('simple', t))) FROM unnest($1::text[]) t),
+		(SELECT MAX(word_similarity(t, COALESCE(edu.places, ''))) * 0.6 FROM unnest($1::text[]) t),
+		(SELECT MAX(word_similarity(t, COALESCE(lng.langs, ''))) * 0.5 FROM unnest($1::text[]) t)
+	)`
+
+const searchMatchSQL = `
+	EXISTS (
+		SELECT 1 FROM unnest($1::text[]) t
+		WHERE t <% {alias}.fio
+			OR to_tsvector('simple', {alias}.fio) @@ plainto_tsquery('simple', t)
+			OR t <% COALESCE(edu.places, '')
+			OR t <% COALESCE(lng.langs, '')
+	)`
+
+var searchSources = map[string]struct {
+	alias string
+	from  string
+}{
+	"employee": {
+		alias: "e",
+		from: `
+			FROM employee e
+			LEFT JOIN job_title jt ON e.job_title_id = jt.id
+			LEFT JOIN subdivision sd ON e.subdivision_id = sd.id
+			LEFT JOIN LATERAL (
+				SELECT string_agg(place, ' | ') AS places FROM employee_education WHERE employee_id = e.id
+			) edu ON true
+			LEFT JOIN LATERAL (
+				SELECT string_agg(l.language, ', ') AS langs
+				FROM employee_languages el JOIN languages l ON el.language_id = l.id
+				WHERE el.employee_id = e.id
+			) lng ON true`,
+	},
+	"bid": {
+		alias: "eb",
+		from: `
+			FROM employee_bid eb
+			LEFT JOIN job_title jt ON eb.job_title_id = jt.id
+			LEFT JOIN subdivision sd ON eb.subdivision_id = sd.id
+			LEFT JOIN LATERAL (
+				SELECT string_agg(place, ' | ') AS places FROM employee_education_bid WHERE employee_id = eb.id
+			) edu ON true
+			LEFT JOIN LATERAL (
+				SELECT string_agg(l.language, ', ') AS langs
+				FROM employee_languages_bid elb JOIN languages l ON elb.language_id = l.id
+				WHERE elb.employee_id = eb.id
+			) lng ON true`,
+	},
+}
+
+// searchQuery — поиск по источнику kind; $1 — варианты запроса, $2 — лимит,
+// scope — дополнительное условие видимости (TRUE, если его нет).
+func searchQuery(kind, scope string) string {
+	src := searchSources[kind]
+	return strings.ReplaceAll(`
+		SELECT {alias}.id, {alias}.fio,
+			COALESCE(jt.name, ''), COALESCE(sd.name, ''),
+			COALESCE(edu.places, ''), COALESCE(lng.langs, ''),
+			`+searchRankSQL+` AS rank
+		`+src.from+`
+		WHERE `+searchMatchSQL+` AND `+scope+`
+		ORDER BY rank DESC, {alias}.id
+		LIMIT $2`, "{alias}", src.alias)
+}
+
+func SearchHandler(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query must be at least 2 characters"})
+		return
+	}
+
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	var kinds []string
+	switch c.DefaultQuery("type", "all") {
+	case "employees":
+		kinds = []string{"employee"}
+	case "bids":
+		kinds = []string{"bid"}
+	case "all":
+		kinds = []string{"employee", "bid"}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be employees, bids or all"})
+		return
+	}
+
+	scope, err := loadEmployeeScope(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	variants := searchVariants(q)
+	hits := []SearchHit{}
+	for _, kind := range kinds {
+		qb := &queryBuilder{}
+		qb.arg(pq.Array(variants))
+		qb.arg(limit)
+		// Заявки ещё не сотрудники, ограничение видимости касается только сотрудников;
+		// отозванные заявки рецензентам не показываются
+		cond := "eb.status <> 'withdrawn'"
+		if kind == "employee" {
+			cond = scope.cond(qb, "e.id")
+		}
+		rows, err := db.Query(searchQuery(kind, cond), qb.args...)
+		if err != nil {
+			log.Printf("Ошибка поиска: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		for rows.Next() {
+			hit := SearchHit{Type: kind}
+			var places, langs string
+			if err := rows.Scan(&hit.ID, &hit.FIO, &hit.JobTitle, &hit.Subdivision, &places, &langs, &hit.Rank); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan search results"})
+				return
+			}
+			hit.Highlights = map[string]string{}
+			for field, text := range map[string]string{"fio": hit.FIO, "educations": places, "languages": langs} {
+				if snippet, ok := highlight(text, variants); ok {
+					hit.Highlights[field] = snippet
+				}
+			}
+			hits = append(hits, hit)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Rank > hits[j].Rank })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	c.JSON(http.StatusOK, hits)
+}
+
+const highlightThreshold = 0.3
+
+// highlight экранирует text и оборачивает в <mark> слова, похожие на любое слово запроса.
+func highlight(text string, variants []string) (string, bool) {
+	var terms []string
+	for _, v := range variants {
+		terms = append(terms, splitWords(v)...)
+	}
+
+	var b strings.Builder
+	found := false
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		if wordMatches(w, terms) {
+			b.WriteString("<mark>" + html.EscapeString(w) + "</mark>")
+			found = true
+		} else {
+			b.WriteString(html.EscapeString(w))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+	return b.String(), found
+}
+
+func wordMatches(word string, terms []string) bool {
+	lw := strings.ToLower(word)
+	for _, t := range terms {
+		if strings.HasPrefix(lw, t) || trigramSimilarity(lw, t) >= highlightThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigramSimilarity повторяет similarity() из pg_trgm для одного слова: слово дополняется
+// двумя пробелами в начале и одним в конце, результат — коэффициент Жаккара множеств триграмм.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+func trigrams(word string) map[string]bool {
+	r := []rune("  " + word + " ")
+	set := map[string]bool{}
+	for i := 0; i+3 <= len(r); i++ {
+		set[string(r[i:i+3])] = true
+	}
+	return set
+}
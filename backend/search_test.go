@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestSearchVariants(t *testing.T) {
+	variants := searchVariants("Иванов Пётр")
+	if len(variants) != 2 || variants[1] != "ivanov petr" {
+		t.Errorf("unexpected variants: %v", variants)
+	}
+
+	variants = searchVariants("Shchukina Yulia")
+	if len(variants) != 2 || variants[1] != "щукина юлия" {
+		t.Errorf("unexpected variants: %v", variants)
+	}
+
+	if got := translitToCyrillic("Rybakov"); got != "рыбаков" {
+		t.Errorf("unexpected transliteration: %q", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	snippet, ok := highlight("Иванов Иван <Иванович>", searchVariants("Ивонов"))
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	expected := "<mark>Иванов</mark> Иван &lt;Иванович&gt;"
+	if snippet != expected {
+		t.Errorf("unexpected snippet: got %q want %q", snippet, expected)
+	}
+
+	if _, ok := highlight("Петров", []string{"Сидоров"}); ok {
+		t.Error("unexpected match")
+	}
+}
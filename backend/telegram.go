@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tgBot — клиент Bot API; nil, если TELEGRAM_BOT_TOKEN не задан и бот отключён.
+var tgBot *telegramBot
+
+type telegramBot struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+// newTelegramBot читает TELEGRAM_BOT_TOKEN и TELEGRAM_API_URL; адрес API можно заменить
+// на локальную заглушку для тестов.
+func newTelegramBot() *telegramBot {
+	token := envString("TELEGRAM_BOT_TOKEN", "")
+	if token == "" {
+		return nil
+	}
+	return &telegramBot{
+		apiURL: strings.TrimRight(envString("TELEGRAM_API_URL", "https://api.telegram.org"), "/"),
+		token:  token,
+		// Больше, чем таймаут long polling в getUpdates
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type telegramError struct {
+	Code        int
+	Description string
+}
+
+func (e *telegramError) Error() string {
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+func (b *telegramBot) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(b.apiURL+"/bot"+b.token+"/"+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// В тексте url.Error есть адрес запроса, а в нём токен бота
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("telegram %s: %w", method, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("telegram %s: status %d: %w", method, resp.StatusCode, err)
+	}
+	if !r.OK {
+		return &telegramError{Code: r.ErrorCode, Description: r.Description}
+	}
+	if result != nil {
+		return json.Unmarshal(r.Result, result)
+	}
+	return nil
+}
+
+func (b *telegramBot) send(chatID int64, text string, markup interface{}) error {
+	params := gin.H{"chat_id": chatID, "text": text, "parse_mode": "HTML"}
+	if markup != nil {
+		params["reply_markup"] = markup
+	}
+	return b.call("sendMessage", params, nil)
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+type telegramCallback struct {
+	ID   string `json:"id"`
+	From struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	Message *telegramMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+type telegramUpdate struct {
+	UpdateID      int64             `json:"update_id"`
+	Message       *telegramMessage  `json:"message"`
+	CallbackQuery *telegramCallback `json:"callback_query"`
+}
+
+// bidSummary — карточка заявки для сообщения, по тем же данным, что видит рецензент во входящих.
+func bidSummary(bid Bid) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<b>Новая заявка №%d</b>\n", bid.ID)
+	age := "не указан"
+	if bid.Age != nil {
+		age = strconv.Itoa(*bid.Age)
+	}
+	fmt.Fprintf(&sb, "%s, возраст: %s\n", html.EscapeString(bid.EmployeeName), age)
+	fmt.Fprintf(&sb, "Должность: %s\n", html.EscapeString(bid.JobTitle))
+	fmt.Fprintf(&sb, "Подразделение: %s\n", html.EscapeString(bid.Subdivision))
+	fmt.Fprintf(&sb, "Общий стаж: %d лет\n", bid.OverallExp)
+	fmt.Fprintf(&sb, "Научно-технический стаж: %d лет", bid.SPExp)
+	if len(bid.Educations) > 0 {
+		items := make([]string, len(bid.Educations))
+		for i, e := range bid.Educations {
+			items[i] = html.EscapeString(e.Name)
+			if e.Place != "" {
+				items[i] += " (" + html.EscapeString(e.Place) + ")"
+			}
+		}
+		sb.WriteString("\nОбразование: " + strings.Join(items, ", "))
+	}
+	if len(bid.Languages) > 0 {
+		items := make([]string, len(bid.Languages))
+		for i, l := range bid.Languages {
+			items[i] = html.EscapeString(l.Name + " (" + l.Level + ")")
+		}
+		sb.WriteString("\nЯзыки: " + strings.Join(items, ", "))
+	}
+	if bid.DuplicateOf != nil {
+		fmt.Fprintf(&sb, "\nВозможный дубликат заявки №%d", *bid.DuplicateOf)
+	}
+	if bid.EmployeeMatch != nil {
+		fmt.Fprintf(&sb, "\nСовпадает с сотрудником №%d", *bid.EmployeeMatch)
+	}
+	return sb.String()
+}
+
+func decisionKeyboard(bidID int) gin.H {
+	return gin.H{"inline_keyboard": [][]gin.H{{
+		{"text": "Принять", "callback_data": fmt.Sprintf("accept:%d", bidID)},
+		{"text": "Отклонить", "callback_data": fmt.Sprintf("reject:%d", bidID)},
+	}}}
+}
+
+// parseDecision разбирает callback_data кнопок из decisionKeyboard.
+func parseDecision(data string) (string, int, bool) {
+	action, id, ok := strings.Cut(data, ":")
+	if !ok || (action != "accept" && action != "reject") {
+		return "", 0, false
+	}
+	bidID, err := strconv.Atoi(id)
+	if err != nil || bidID <= 0 {
+		return "", 0, false
+	}
+	return action, bidID, true
+}
+
+// telegramSink рассылает новые заявки привязавшим Telegram рецензентам подразделения.
+// Сообщения уходят из транзакции dispatchOutbox, поэтому при сбое её фиксации пачка может прийти повторно.
+type telegramSink struct{}
+
+func (telegramSink) Name() string { return "telegram" }
+
+func (telegramSink) Publish(tx *sql.Tx, msg outboxMessage) error {
+	if tgBot == nil || msg.EventType != "application.submitted" {
+		return nil
+	}
+	var ev struct {
+		BidID int `json:"bid_id"`
+	}
+	if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+		return err
+	}
+
+	qb := &queryBuilder{}
+	qb.where("eb.id = %s", ev.BidID)
+	bids, err := loadBids(qb)
+	if err != nil {
+		return err
+	}
+	// Заявку уже успели рассмотреть или отозвать
+	if len(bids) == 0 || bids[0].Status != "submitted" {
+		return nil
+	}
+	bid := bids[0]
+
+	rows, err := tx.Query(`
+        SELECT u.telegram_chat_id FROM users u
+        WHERE u.telegram_chat_id IS NOT NULL AND u.role IN ('employee', 'admin') AND EXISTS (
+            SELECT 1 FROM reviewer_subdivision rs WHERE rs.user_id = u.id::text AND rs.subdivision_id = $1)
+    `, bid.SubdivisionID)
+	if err != nil {
+		return err
+	}
+	var chats []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			rows.Close()
+			return err
+		}
+		chats = append(chats, chatID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	text := bidSummary(bid)
+	for _, chatID := range chats {
+		err := tgBot.send(chatID, text, decisionKeyboard(bid.ID))
+		if err == nil {
+			continue
+		}
+		var tgErr *telegramError
+		if !errors.As(err, &tgErr) || tgErr.Code == http.StatusTooManyRequests || tgErr.Code >= 500 {
+			return err
+		}
+		// Прочие ошибки запроса повтор не исправит; заблокировавший бота чат отвязываем
+		log.Printf("Telegram не принял сообщение для чата %d: %v", chatID, err)
+		if tgErr.Code == http.StatusForbidden {
+			if _, err := tx.Exec("UPDATE users SET telegram_chat_id = NULL WHERE telegram_chat_id = $1", chatID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// run получает обновления через long polling. Решения по кнопкам принимаются теми же
+// acceptBid и rejectBid, что и в веб-интерфейсе, от имени привязанного пользователя.
+func (b *telegramBot) run() {
+	var offset int64
+	for {
+		var updates []telegramUpdate
+		err := b.call("getUpdates", gin.H{
+			"offset": offset, "timeout": 30, "allowed_updates": []string{"message", "callback_query"},
+		}, &updates)
+		if err != nil {
+			// 409 — обновления уже забирает другой экземпляр с тем же токеном
+			log.Printf("Ошибка получения обновлений Telegram: %v", err)
+			time.Sleep(envDuration("TELEGRAM_RETRY_INTERVAL", 10*time.Second))
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			switch {
+			case u.Message != nil:
+				b.handleMessage(u.Message)
+			case u.CallbackQuery != nil:
+				b.handleCallback(u.CallbackQuery)
+			}
+		}
+	}
+}
+
+func (b *telegramBot) reply(chatID int64, text string) {
+	if err := b.send(chatID, text, nil); err != nil {
+		log.Printf("Ошибка отправки сообщения Telegram: %v", err)
+	}
+}
+
+func (b *telegramBot) handleMessage(m *telegramMessage) {
+	if m.Chat.Type != "private" {
+		return
+	}
+	command, arg, _ := strings.Cut(strings.TrimSpace(m.Text), " ")
+	switch command {
+	case "/start":
+		if arg == "" {
+			b.reply(m.Chat.ID, "Чтобы получать заявки, получите код привязки в профиле на сайте и отправьте /start &lt;код&gt;.")
+			return
+		}
+		username, err := linkTelegramChat(m.Chat.ID, strings.TrimSpace(arg))
+		if err != nil {
+			log.Printf("Ошибка привязки Telegram: %v", err)
+			b.reply(m.Chat.ID, "Не удалось привязать аккаунт, попробуйте позже.")
+			return
+		}
+		if username == "" {
+			b.reply(m.Chat.ID, "Код привязки недействителен или истёк.")
+			return
+		}
+		b.reply(m.Chat.ID, "Аккаунт "+html.EscapeString(username)+" привязан. Новые заявки будут приходить сюда.")
+	case "/stop":
+		if _, err := db.Exec("UPDATE users SET telegram_chat_id = NULL WHERE telegram_chat_id = $1", m.Chat.ID); err != nil {
+			log.Printf("Ошибка отвязки Telegram: %v", err)
+			return
+		}
+		b.reply(m.Chat.ID, "Аккаунт отвязан, уведомления больше не придут.")
+	}
+}
+
+// linkTelegramChat погашает код привязки и возвращает имя пользователя; пустое имя — код не найден.
+func linkTelegramChat(chatID int64, code string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow("DELETE FROM telegram_link_code WHERE code = $1 AND expires_at > NOW() RETURNING user_id", code).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// Чат привязан не более чем к одному аккаунту
+	if _, err := tx.Exec("UPDATE users SET telegram_chat_id = NULL WHERE telegram_chat_id = $1", chatID); err != nil {
+		return "", err
+	}
+	var username string
+	err = tx.QueryRow("UPDATE users SET telegram_chat_id = $1 WHERE id::text = $2 RETURNING username", chatID, userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return username, tx.Commit()
+}
+
+func (b *telegramBot) handleCallback(q *telegramCallback) {
+	answer := func(text string, alert bool) {
+		if err := b.call("answerCallbackQuery", gin.H{"callback_query_id": q.ID, "text": text, "show_alert": alert}, nil); err != nil {
+			log.Printf("Ошибка ответа на кнопку Telegram: %v", err)
+		}
+	}
+
+	action, bidID, ok := parseDecision(q.Data)
+	if !ok {
+		answer("Неизвестная команда", false)
+		return
+	}
+	var userID, username, role string
+	err := db.QueryRow("SELECT id::text, username, role FROM users WHERE telegram_chat_id = $1", q.From.ID).Scan(&userID, &username, &role)
+	if err == sql.ErrNoRows {
+		answer("Аккаунт не привязан", true)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка поиска пользователя Telegram: %v", err)
+		answer("Ошибка базы данных", true)
+		return
+	}
+	// Те же роли, что RoleMiddleware пропускает к решениям в веб-интерфейсе
+	if role != "employee" && role != "admin" {
+		answer("Недостаточно прав", true)
+		return
+	}
+
+	// Повторная доставка уже обработанного нажатия не найдёт заявку и второго решения не будет
+	message, err := decideBid(action, bidID, userID)
+	if err != nil {
+		answer(err.Error(), true)
+		return
+	}
+	answer(message, false)
+
+	if q.Message != nil {
+		verdict := "✅ Принята"
+		if action == "reject" {
+			verdict = "❌ Отклонена"
+		}
+		err := b.call("editMessageReplyMarkup", gin.H{
+			"chat_id": q.Message.Chat.ID, "message_id": q.Message.MessageID, "reply_markup": gin.H{"inline_keyboard": [][]gin.H{}},
+		}, nil)
+		if err != nil {
+			log.Printf("Ошибка обновления сообщения Telegram: %v", err)
+		}
+		b.reply(q.Message.Chat.ID, fmt.Sprintf("Заявка №%d: %s (%s)", bidID, verdict, html.EscapeString(username)))
+	}
+}
+
+// decideBid выполняет решение по заявке от имени пользователя и возвращает текст для показа в Telegram.
+// Ошибка — *bidDecisionError с тем же текстом, что получил бы веб-интерфейс.
+func decideBid(action string, bidID int, userID string) (string, error) {
+	if action == "reject" {
+		if err := rejectBid(strconv.Itoa(bidID), userID, ""); err != nil {
+			return "", err
+		}
+		return "Заявка отклонена", nil
+	}
+	if _, err := acceptBid(strconv.Itoa(bidID), userID, "", false); err != nil {
+		return "", err
+	}
+	return "Заявка принята", nil
+}
+
+func GetTelegramLink(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	var chatID sql.NullInt64
+	if err := db.QueryRow("SELECT telegram_chat_id FROM users WHERE id::text = $1", userID).Scan(&chatID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": tgBot != nil, "linked": chatID.Valid})
+}
+
+// createTelegramLink выдаёт код для /start; TELEGRAM_BOT_USERNAME добавляет ссылку на бота.
+func createTelegramLink(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	if tgBot == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Telegram-бот не настроен"})
+		return
+	}
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		return
+	}
+	code := hex.EncodeToString(buf)
+	ttl := envDuration("TELEGRAM_LINK_TTL", 15*time.Minute)
+
+	_, err := db.Exec("DELETE FROM telegram_link_code WHERE user_id = $1 OR expires_at < NOW()", userID)
+	if err == nil {
+		_, err = db.Exec("INSERT INTO telegram_link_code (code, user_id, expires_at) VALUES ($1, $2, NOW() + make_interval(secs => $3))", code, userID, ttl.Seconds())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into telegram_link_code"})
+		return
+	}
+
+	resp := gin.H{"code": code, "expires_at": time.Now().Add(ttl)}
+	if name := envString("TELEGRAM_BOT_USERNAME", ""); name != "" {
+		resp["url"] = "https://t.me/" + name + "?start=" + code
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+func deleteTelegramLink(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	if _, err := db.Exec("UPDATE users SET telegram_chat_id = NULL WHERE id::text = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Telegram отвязан"})
+}
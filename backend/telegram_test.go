@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTelegramCall(t *testing.T) {
+	var sent map[string]interface{}
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botTOKEN/sendMessage":
+			json.NewDecoder(r.Body).Decode(&sent)
+			w.Write([]byte(`{"ok":true,"result":{"message_id":7}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+		}
+	}))
+	defer stub.Close()
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "TOKEN")
+	t.Setenv("TELEGRAM_API_URL", stub.URL+"/")
+	bot := newTelegramBot()
+
+	if err := bot.send(42, "<b>hi</b>", decisionKeyboard(5)); err != nil {
+		t.Fatal(err)
+	}
+	if sent["chat_id"] != float64(42) || sent["parse_mode"] != "HTML" || sent["reply_markup"] == nil {
+		t.Errorf("unexpected sendMessage params: %v", sent)
+	}
+
+	err := bot.call("answerCallbackQuery", gin.H{}, nil)
+	var tgErr *telegramError
+	if !errors.As(err, &tgErr) || tgErr.Code != 403 {
+		t.Errorf("expected telegram 403 error, got %v", err)
+	}
+
+	stub.Close()
+	err = bot.call("getMe", gin.H{}, nil)
+	if err == nil || strings.Contains(err.Error(), "TOKEN") {
+		t.Errorf("network error should not expose the token: %v", err)
+	}
+}
+
+func TestTelegramDisabled(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	if newTelegramBot() != nil {
+		t.Error("bot without token should be disabled")
+	}
+}
+
+func TestBidSummary(t *testing.T) {
+	dup, age := 3, 30
+	text := bidSummary(Bid{
+		ID: 12, EmployeeName: "Иванов <script>", Age: &age, JobTitle: "Инженер", Subdivision: "Отдел & Ко",
+		Educations:  []Education{{Name: "Высшее", Place: "МГУ"}},
+		Languages:   []Language{{Name: "English", Level: "B2"}},
+		DuplicateOf: &dup,
+	})
+	for _, want := range []string{"№12", "Иванов &lt;script&gt;, возраст: 30", "Отдел &amp; Ко", "Высшее (МГУ)", "English (B2)", "дубликат заявки №3"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("summary misses %q:\n%s", want, text)
+		}
+	}
+	if text := bidSummary(Bid{ID: 13, EmployeeName: "Петров"}); !strings.Contains(text, "возраст: не указан") {
+		t.Errorf("summary without birth date should say age is unknown:\n%s", text)
+	}
+}
+
+func TestParseDecision(t *testing.T) {
+	cases := []struct {
+		data   string
+		action string
+		id     int
+		ok     bool
+	}{
+		{"accept:12", "accept", 12, true},
+		{"reject:3", "reject", 3, true},
+		{"delete:3", "", 0, false},
+		{"accept:x", "", 0, false},
+		{"accept:-1", "", 0, false},
+		{"accept", "", 0, false},
+	}
+	for _, tc := range cases {
+		action, id, ok := parseDecision(tc.data)
+		if action != tc.action || id != tc.id || ok != tc.ok {
+			t.Errorf("parseDecision(%q) = %q, %d, %v", tc.data, action, id, ok)
+		}
+	}
+}
+
+func TestDecideBid(t *testing.T) {
+	openTestDB(t)
+	job, sub, _ := testPosition(t, nil)
+
+	bid := func(status string) int {
+		var id int
+		err := db.QueryRow(`
+            INSERT INTO employee_bid (fio, birth_date, job_title_id, subdivision_id, status)
+            VALUES ('Кандидат Телеграм', '1990-01-01', $1, $2, $3) RETURNING id
+        `, job, sub, status).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.Exec("DELETE FROM bid_comment WHERE bid_id = $1", id)
+			db.Exec("DELETE FROM employee_bid WHERE id = $1", id)
+		})
+		return id
+	}
+
+	withdrawn := bid("withdrawn")
+	if _, err := decideBid("accept", withdrawn, "0"); err == nil || err.Error() != "Заявка отозвана заявителем" {
+		t.Errorf("accept withdrawn: %v", err)
+	}
+
+	submitted := bid("submitted")
+	if msg, err := decideBid("reject", submitted, "0"); err != nil || msg != "Заявка отклонена" {
+		t.Errorf("reject: %q %v", msg, err)
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM employee_bid WHERE id = $1)", submitted).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("rejected bid is still stored")
+	}
+
+	// Повторное нажатие не принимает уже рассмотренную заявку
+	if _, err := decideBid("accept", submitted, "0"); err == nil {
+		t.Error("accepting an already rejected bid succeeded")
+	}
+	var comments int
+	if _, err := decideBid("reject", submitted, "0"); err == nil || err.Error() != "Bid not found" {
+		t.Errorf("reject missing bid: %v", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM bid_comment WHERE bid_id = $1 AND decision = 'rejected'", submitted).Scan(&comments); err != nil || comments != 1 {
+		t.Errorf("rejected decisions recorded: %d, %v", comments, err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+var cyrToLat = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// Сочетания проверяются от длинных к коротким, поэтому "shch" разбирается раньше "sh".
+var latToCyr = []struct {
+	lat string
+	cyr string
+}{
+	{"shch", "щ"}, {"sch", "щ"},
+	{"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"tz", "ц"}, {"ch", "ч"}, {"sh", "ш"},
+	{"yu", "ю"}, {"ju", "ю"}, {"ya", "я"}, {"ja", "я"}, {"yo", "ё"}, {"jo", "ё"},
+	{"a", "а"}, {"b", "б"}, {"v", "в"}, {"w", "в"}, {"g", "г"}, {"d", "д"},
+	{"e", "е"}, {"z", "з"}, {"i", "и"}, {"y", "й"}, {"j", "й"}, {"k", "к"},
+	{"l", "л"}, {"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"}, {"r", "р"},
+	{"s", "с"}, {"t", "т"}, {"u", "у"}, {"f", "ф"}, {"h", "х"}, {"c", "к"},
+	{"x", "кс"}, {"q", "к"},
+}
+
+func translitToLatin(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if lat, ok := cyrToLat[r]; ok {
+			b.WriteString(lat)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func translitToCyrillic(s string) string {
+	s = strings.ToLower(s)
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		// окончание "-ia" в именах (Maria, Yulia) соответствует "-ия"
+		if strings.HasPrefix(s[i:], "ia") && (i+2 == len(s) || s[i+2] < 'a' || s[i+2] > 'z') {
+			b.WriteString("ия")
+			i += 2
+			continue
+		}
+		matched := false
+		for _, p := range latToCyr {
+			if strings.HasPrefix(s[i:], p.lat) {
+				// "y" после согласной обычно "ы" (Rybakov), после гласной и в начале слова — "й"
+				if p.lat == "y" && i > 0 && s[i-1] >= 'a' && s[i-1] <= 'z' && !strings.ContainsRune("aeiouy", rune(s[i-1])) {
+					b.WriteString("ы")
+				} else {
+					b.WriteString(p.cyr)
+				}
+				i += len(p.lat)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+func hasCyrillic(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLatin(s string) bool {
+	for _, r := range s {
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchVariants возвращает исходную строку и её транслитерацию в другую раскладку,
+// чтобы "Ivanov" находил "Иванов" и наоборот.
+func searchVariants(q string) []string {
+	q = strings.TrimSpace(q)
+	variants := []string{q}
+	if hasCyrillic(q) {
+		variants = append(variants, translitToLatin(q))
+	}
+	if hasLatin(q) {
+		variants = append(variants, translitToCyrillic(q))
+	}
+	return variants
+}
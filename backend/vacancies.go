@@ -0,0 +1,327 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Vacancy struct {
+	ID            int     `json:"id"`
+	JobTitleID    int     `json:"job_title_id"`
+	JobTitle      string  `json:"job_title"`
+	SubdivisionID int     `json:"subdivision_id"`
+	Subdivision   string  `json:"subdivision"`
+	Description   string  `json:"description"`
+	Requirements  string  `json:"requirements"`
+	Positions     int     `json:"positions"`
+	Filled        int     `json:"filled"`
+	OpensOn       string  `json:"opens_on"`
+	ClosesOn      *string `json:"closes_on"`
+	Status        string  `json:"status"`
+}
+
+// Вакансия принимает заявки, пока она открыта, срок её публикации наступил и не истёк.
+const vacancyAcceptingSQL = `v.status = 'open' AND v.opens_on <= CURRENT_DATE AND (v.closes_on IS NULL OR v.closes_on >= CURRENT_DATE)`
+
+const vacancySelectSQL = `
+    SELECT
+        v.id, v.job_title_id, jt.name, v.subdivision_id, sd.name,
+        v.description, v.requirements, v.positions,
+        (SELECT COUNT(*) FROM employee e WHERE e.vacancy_id = v.id),
+        to_char(v.opens_on, 'YYYY-MM-DD'), to_char(v.closes_on, 'YYYY-MM-DD'),
+        CASE WHEN ` + vacancyAcceptingSQL + ` THEN 'open' ELSE 'closed' END
+    FROM vacancy v
+    JOIN job_title jt ON v.job_title_id = jt.id
+    JOIN subdivision sd ON v.subdivision_id = sd.id`
+
+var (
+	errVacancyClosed   = errors.New("vacancy is not accepting applications")
+	errNoOpenVacancy   = errors.New("there is no open vacancy for this job title and subdivision")
+	errVacancyNotFound = errors.New("vacancy not found")
+)
+
+func scanVacancies(rows *sql.Rows) ([]Vacancy, error) {
+	defer rows.Close()
+	vacancies := []Vacancy{}
+	for rows.Next() {
+		var v Vacancy
+		if err := rows.Scan(&v.ID, &v.JobTitleID, &v.JobTitle, &v.SubdivisionID, &v.Subdivision,
+			&v.Description, &v.Requirements, &v.Positions, &v.Filled,
+			&v.OpensOn, &v.ClosesOn, &v.Status); err != nil {
+			return nil, err
+		}
+		vacancies = append(vacancies, v)
+	}
+	return vacancies, rows.Err()
+}
+
+// resolveVacancy находит вакансию, к которой привязывается заявка. Если vacancyID не передан,
+// берётся самая ранняя открытая вакансия на ту же должность в том же подразделении.
+func resolveVacancy(tx *sql.Tx, vacancyID, jobTitleID, subdivisionID int) (id, job, sub int, err error) {
+	if vacancyID != 0 {
+		var accepting bool
+		err = tx.QueryRow(`
+            SELECT v.id, v.job_title_id, v.subdivision_id, `+vacancyAcceptingSQL+`
+            FROM vacancy v WHERE v.id = $1
+        `, vacancyID).Scan(&id, &job, &sub, &accepting)
+		if err == sql.ErrNoRows {
+			return 0, 0, 0, errVacancyNotFound
+		}
+		if err == nil && !accepting {
+			err = errVacancyClosed
+		}
+		return id, job, sub, err
+	}
+
+	err = tx.QueryRow(`
+        SELECT v.id, v.job_title_id, v.subdivision_id
+        FROM vacancy v
+        WHERE v.job_title_id = $1 AND v.subdivision_id = $2 AND `+vacancyAcceptingSQL+`
+        ORDER BY v.opens_on, v.id
+        LIMIT 1
+    `, jobTitleID, subdivisionID).Scan(&id, &job, &sub)
+	if err == sql.ErrNoRows {
+		return 0, 0, 0, errNoOpenVacancy
+	}
+	return id, job, sub, err
+}
+
+// checkVacancyCapacity блокирует вакансию до конца транзакции и проверяет, что в ней остались места.
+func checkVacancyCapacity(tx *sql.Tx, vacancyID int) error {
+	var positions, filled int
+	err := tx.QueryRow("SELECT positions FROM vacancy WHERE id = $1 FOR UPDATE", vacancyID).Scan(&positions)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow("SELECT COUNT(*) FROM employee WHERE vacancy_id = $1", vacancyID).Scan(&filled); err != nil {
+		return err
+	}
+	if filled >= positions {
+		return &headcountError{Scope: "vacancy", Authorized: positions, Filled: filled}
+	}
+	return nil
+}
+
+// closeFilledVacancy закрывает вакансию, как только по ней принято столько сотрудников, сколько мест.
+func closeFilledVacancy(tx *sql.Tx, vacancyID int) error {
+	_, err := tx.Exec(`
+        UPDATE vacancy SET status = 'closed', closed_at = NOW()
+        WHERE id = $1 AND status = 'open'
+            AND positions <= (SELECT COUNT(*) FROM employee WHERE vacancy_id = $1)
+    `, vacancyID)
+	return err
+}
+
+// GetOpenVacancies — публичный список вакансий, на которые можно подать заявку.
+func GetOpenVacancies(c *gin.Context) {
+	qb := &queryBuilder{}
+	qb.conds = append(qb.conds, vacancyAcceptingSQL)
+	if err := qb.inFilter(c, "v.job_title_id", "job_title_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := qb.inFilter(c, "v.subdivision_id", "subdivision_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(vacancySelectSQL+qb.whereSQL()+" ORDER BY v.opens_on DESC, v.id", qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	vacancies, err := scanVacancies(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan vacancies"})
+		return
+	}
+	c.JSON(http.StatusOK, vacancies)
+}
+
+// GetAllVacancies — список для сотрудников, включая закрытые; ?status=open|closed.
+func GetAllVacancies(c *gin.Context) {
+	qb := &queryBuilder{}
+	switch c.Query("status") {
+	case "":
+	case "open":
+		qb.conds = append(qb.conds, vacancyAcceptingSQL)
+	case "closed":
+		qb.conds = append(qb.conds, "NOT ("+vacancyAcceptingSQL+")")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open or closed"})
+		return
+	}
+
+	rows, err := db.Query(vacancySelectSQL+qb.whereSQL()+" ORDER BY v.created_at DESC", qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	vacancies, err := scanVacancies(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan vacancies"})
+		return
+	}
+	c.JSON(http.StatusOK, vacancies)
+}
+
+type vacancyRequest struct {
+	JobTitleID    int    `json:"job_title_id" binding:"required,min=1"`
+	SubdivisionID int    `json:"subdivision_id" binding:"required,min=1"`
+	Description   string `json:"description"`
+	Requirements  string `json:"requirements"`
+	Positions     int    `json:"positions" binding:"required,min=1"`
+	OpensOn       string `json:"opens_on"`
+	ClosesOn      string `json:"closes_on"`
+}
+
+func (r vacancyRequest) dates() (time.Time, *time.Time, error) {
+	opens := truncateDay(time.Now())
+	if r.OpensOn != "" {
+		d, err := time.Parse(dateLayout, r.OpensOn)
+		if err != nil {
+			return opens, nil, errors.New("invalid opens_on")
+		}
+		opens = d
+	}
+	if r.ClosesOn == "" {
+		return opens, nil, nil
+	}
+	closes, err := time.Parse(dateLayout, r.ClosesOn)
+	if err != nil {
+		return opens, nil, errors.New("invalid closes_on")
+	}
+	if closes.Before(opens) {
+		return opens, nil, errors.New("closes_on is before opens_on")
+	}
+	return opens, &closes, nil
+}
+
+func createVacancy(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	var req vacancyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opens, closes, err := req.dates()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	err = db.QueryRow(`
+        INSERT INTO vacancy (job_title_id, subdivision_id, description, requirements, positions, opens_on, closes_on, created_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id
+    `, req.JobTitleID, req.SubdivisionID, req.Description, req.Requirements, req.Positions, opens, closes, userID).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into vacancy"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// updateVacancy правит вакансию. Должность и подразделение нельзя менять, пока на вакансию
+// есть заявки или по ней приняты сотрудники: они унаследовали их от вакансии.
+func updateVacancy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vacancy ID"})
+		return
+	}
+
+	var req vacancyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opens, closes, err := req.dates()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database transaction error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var jobTitleID, subdivisionID int
+	var referenced bool
+	err = tx.QueryRow(`
+        SELECT job_title_id, subdivision_id,
+            EXISTS(SELECT 1 FROM employee_bid WHERE vacancy_id = v.id)
+                OR EXISTS(SELECT 1 FROM employee WHERE vacancy_id = v.id)
+        FROM vacancy v WHERE id = $1
+        FOR UPDATE
+    `, id).Scan(&jobTitleID, &subdivisionID, &referenced)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vacancy not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if referenced && (jobTitleID != req.JobTitleID || subdivisionID != req.SubdivisionID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot change job title or subdivision of a vacancy with applications or hires"})
+		return
+	}
+
+	_, err = tx.Exec(`
+        UPDATE vacancy SET
+            job_title_id = $1, subdivision_id = $2, description = $3, requirements = $4,
+            positions = $5, opens_on = $6, closes_on = $7
+        WHERE id = $8
+    `, req.JobTitleID, req.SubdivisionID, req.Description, req.Requirements, req.Positions, opens, closes, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vacancy updated successfully"})
+}
+
+func closeVacancy(c *gin.Context) {
+	setVacancyStatus(c, "UPDATE vacancy SET status = 'closed', closed_at = NOW() WHERE id = $1", "Vacancy closed successfully")
+}
+
+func reopenVacancy(c *gin.Context) {
+	setVacancyStatus(c, "UPDATE vacancy SET status = 'open', closed_at = NULL WHERE id = $1", "Vacancy reopened successfully")
+}
+
+func setVacancyStatus(c *gin.Context, query, message string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vacancy ID"})
+		return
+	}
+
+	result, err := db.Exec(query, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vacancy not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testVacancy открывает вакансию, удаляемую после теста.
+func testVacancy(t *testing.T, jobTitleID, subdivisionID, positions int, opensOn time.Time, status string) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO vacancy (job_title_id, subdivision_id, positions, opens_on, status)
+        VALUES ($1, $2, $3, $4, $5) RETURNING id
+    `, jobTitleID, subdivisionID, positions, opensOn, status).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("UPDATE employee SET vacancy_id = NULL WHERE vacancy_id = $1", id)
+		db.Exec("DELETE FROM vacancy WHERE id = $1", id)
+	})
+	return id
+}
+
+func TestResolveVacancy(t *testing.T) {
+	openTestDB(t)
+	job, subA, subB := testPosition(t, nil)
+	today := time.Now()
+	later := testVacancy(t, job, subA, 1, today.AddDate(0, 0, -1), "open")
+	earliest := testVacancy(t, job, subA, 1, today.AddDate(0, 0, -10), "open")
+	closed := testVacancy(t, job, subA, 1, today.AddDate(0, 0, -20), "closed")
+	future := testVacancy(t, job, subB, 1, today.AddDate(0, 0, 5), "open")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	// Без vacancy_id выбирается самая ранняя из принимающих заявки вакансий
+	id, _, _, err := resolveVacancy(tx, 0, job, subA)
+	if err != nil || id != earliest {
+		t.Errorf("ожидалась вакансия %d, получено %d (%v)", earliest, id, err)
+	}
+	if _, _, _, err := resolveVacancy(tx, 0, job, subB); err != errNoOpenVacancy {
+		t.Errorf("подразделение только с будущей вакансией: ожидалась errNoOpenVacancy, получено %v", err)
+	}
+
+	// Явно указанная вакансия задаёт должность и подразделение заявки
+	id, gotJob, gotSub, err := resolveVacancy(tx, later, 0, 0)
+	if err != nil || id != later || gotJob != job || gotSub != subA {
+		t.Errorf("явная вакансия: получено %d/%d/%d (%v)", id, gotJob, gotSub, err)
+	}
+	for _, v := range []int{closed, future} {
+		if _, _, _, err := resolveVacancy(tx, v, job, subA); err != errVacancyClosed {
+			t.Errorf("вакансия %d: ожидалась errVacancyClosed, получено %v", v, err)
+		}
+	}
+	if _, _, _, err := resolveVacancy(tx, -1, job, subA); err != errVacancyNotFound {
+		t.Errorf("несуществующая вакансия: ожидалась errVacancyNotFound, получено %v", err)
+	}
+}
+
+func TestVacancyCapacity(t *testing.T) {
+	openTestDB(t)
+	job, subA, _ := testPosition(t, nil)
+	vacancy := testVacancy(t, job, subA, 2, time.Now(), "open")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	hire := func() {
+		id := testEmployee(t, job, subA)
+		if _, err := tx.Exec("UPDATE employee SET vacancy_id = $1 WHERE id = $2", vacancy, id); err != nil {
+			t.Fatal(err)
+		}
+		if err := closeFilledVacancy(tx, vacancy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := func() string {
+		var s string
+		if err := tx.QueryRow("SELECT status FROM vacancy WHERE id = $1", vacancy).Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	hire()
+	if err := checkVacancyCapacity(tx, vacancy); err != nil {
+		t.Errorf("одно из двух мест занято: %v", err)
+	}
+	if s := status(); s != "open" {
+		t.Errorf("вакансия закрыта до заполнения: %s", s)
+	}
+
+	hire()
+	err = checkVacancyCapacity(tx, vacancy)
+	if hc, ok := err.(*headcountError); !ok || hc.Scope != "vacancy" || hc.Authorized != 2 || hc.Filled != 2 {
+		t.Errorf("заполненная вакансия: ожидался лимит вакансии, получено %v", err)
+	}
+	if s := status(); s != "closed" {
+		t.Errorf("заполненная вакансия не закрыта: %s", s)
+	}
+}
+
+func TestUpdateVacancyKeepsPositionOnceReferenced(t *testing.T) {
+	openTestDB(t)
+	job, subA, subB := testPosition(t, nil)
+	vacancy := testVacancy(t, job, subA, 2, time.Now(), "open")
+
+	r := gin.New()
+	r.PUT("/api/vacancies/:id", updateVacancy)
+	put := func(sub int) int {
+		body := fmt.Sprintf(`{"job_title_id":%d,"subdivision_id":%d,"positions":2,"description":"обновлено"}`, job, sub)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("PUT", fmt.Sprint("/api/vacancies/", vacancy), strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := put(subB); code != http.StatusOK {
+		t.Fatalf("вакансия без заявок: ожидался 200, получено %d", code)
+	}
+	if code := put(subA); code != http.StatusOK {
+		t.Fatalf("возврат подразделения: ожидался 200, получено %d", code)
+	}
+
+	hired := testEmployee(t, job, subA)
+	if _, err := db.Exec("UPDATE employee SET vacancy_id = $1 WHERE id = $2", vacancy, hired); err != nil {
+		t.Fatal(err)
+	}
+	if code := put(subB); code != http.StatusConflict {
+		t.Errorf("смена подразделения после приёма: ожидался 409, получено %d", code)
+	}
+	if code := put(subA); code != http.StatusOK {
+		t.Errorf("правка описания после приёма: ожидался 200, получено %d", code)
+	}
+}
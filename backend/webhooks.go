@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// Типы событий, на которые можно подписаться.
+var webhookEventTypes = map[string]bool{
+	"application.submitted": true,
+	"application.rejected":  true,
+	"application.withdrawn": true,
+	"employee.hired":        true,
+	"employee.deleted":      true,
+}
+
+type WebhookSubscription struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	SubscriptionID int              `json:"subscription_id"`
+	EventType      string           `json:"event_type"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at"`
+	LastStatusCode *int             `json:"last_status_code"`
+	LastError      *string          `json:"last_error"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at"`
+	Log            []WebhookAttempt `json:"log,omitempty"`
+}
+
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  *int      `json:"status_code"`
+	Error       *string   `json:"error"`
+	DurationMS  int       `json:"duration_ms"`
+}
+
+func webhookMaxAttempts() int {
+	return envInt("WEBHOOK_MAX_ATTEMPTS", 8)
+}
+
+func webhookTimeout() time.Duration {
+	return envDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+}
+
+// webhookBackoff — пауза перед следующей попыткой: 30с, 1м, 2м, … но не больше 6 часов.
+func webhookBackoff(attempt int) time.Duration {
+	const limit = 6 * time.Hour
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// webhookSignature подписывает "<timestamp>.<тело>"; получатель сверяет подпись и отбрасывает старые метки времени.
+func webhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhooks ставит сообщение outbox в очередь всем активным подпискам на его тип.
+// id сообщения попадает в тело, чтобы получатель мог отбросить повторную доставку.
+func enqueueWebhooks(tx *sql.Tx, msg outboxMessage) error {
+	payload, err := json.Marshal(gin.H{"id": msg.ID, "event": msg.EventType, "occurred_at": msg.CreatedAt.UTC(), "data": msg.Payload})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+        INSERT INTO webhook_delivery (subscription_id, event_type, payload)
+        SELECT id, $1, $2 FROM webhook_subscription WHERE active AND $1 = ANY(event_types)
+    `, msg.EventType, string(payload))
+	return err
+}
+
+var webhookClient = &http.Client{
+	// Перенаправления не выполняем: адрес доставки задаёт администратор
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func sendWebhook(client *http.Client, target, secret string, deliveryID int64, eventType string, payload []byte, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", webhookSignature(secret, timestamp, payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// nextWebhookState решает, что делать с доставкой после attempts-й попытки.
+func nextWebhookState(attempts int, sendErr error) (string, time.Duration) {
+	switch {
+	case sendErr == nil:
+		return "delivered", 0
+	case attempts >= webhookMaxAttempts():
+		return "dead", 0
+	default:
+		return "pending", webhookBackoff(attempts)
+	}
+}
+
+// runWebhookWorker доставляет очередь, пока она не опустеет, затем ждёт WEBHOOK_POLL_INTERVAL.
+func runWebhookWorker() {
+	webhookClient.Timeout = webhookTimeout()
+	for {
+		n, err := deliverDueWebhooks()
+		if err != nil {
+			log.Printf("Ошибка доставки вебхуков: %v", err)
+		}
+		if n == 0 || err != nil {
+			time.Sleep(envDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second))
+		}
+	}
+}
+
+func deliverDueWebhooks() (int, error) {
+	// Взятые доставки откладываются на время аренды, чтобы другой экземпляр не отправил их параллельно
+	rows, err := db.Query(`
+        UPDATE webhook_delivery d SET next_attempt_at = NOW() + make_interval(secs => $1)
+        FROM webhook_subscription s
+        WHERE s.id = d.subscription_id AND d.id IN (
+            SELECT wd.id FROM webhook_delivery wd
+            JOIN webhook_subscription ws ON ws.id = wd.subscription_id
+            WHERE wd.status = 'pending' AND wd.next_attempt_at <= NOW() AND ws.active
+            ORDER BY wd.next_attempt_at
+            LIMIT 10
+            FOR UPDATE OF wd SKIP LOCKED
+        )
+        RETURNING d.id, d.event_type, d.payload, d.attempts, s.url, s.secret
+    `, (2 * webhookTimeout()).Seconds())
+	if err != nil {
+		return 0, err
+	}
+	type job struct {
+		id          int64
+		eventType   string
+		payload     []byte
+		attempts    int
+		url, secret string
+	}
+	var jobs []job
+	for rows.Next() {
+		var j job
+		if err := rows.Scan(&j.id, &j.eventType, &j.payload, &j.attempts, &j.url, &j.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobs = append(jobs, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, j := range jobs {
+		started := time.Now()
+		code, sendErr := sendWebhook(webhookClient, j.url, j.secret, j.id, j.eventType, j.payload, started)
+		if err := recordWebhookAttempt(j.id, j.attempts+1, code, sendErr, time.Since(started)); err != nil {
+			return len(jobs), err
+		}
+	}
+	return len(jobs), nil
+}
+
+func recordWebhookAttempt(deliveryID int64, attempts, code int, sendErr error, took time.Duration) error {
+	var statusCode *int
+	if code != 0 {
+		statusCode = &code
+	}
+	var errText *string
+	if sendErr != nil {
+		s := sendErr.Error()
+		errText = &s
+	}
+	status, retryIn := nextWebhookState(attempts, sendErr)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+        INSERT INTO webhook_attempt (delivery_id, status_code, error, duration_ms) VALUES ($1, $2, $3, $4)
+    `, deliveryID, statusCode, errText, took.Milliseconds()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+        UPDATE webhook_delivery SET
+            status = $2, attempts = $3, last_status_code = $4, last_error = $5,
+            next_attempt_at = NOW() + make_interval(secs => $6),
+            delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() END
+        WHERE id = $1
+    `, deliveryID, status, attempts, statusCode, errText, retryIn.Seconds()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type webhookRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required,min=1"`
+	Secret     string   `json:"secret"`
+	Active     *bool    `json:"active"`
+}
+
+func (r webhookRequest) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	for _, t := range r.EventTypes {
+		if !webhookEventTypes[t] {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+const webhookSelectSQL = `SELECT id, url, event_types, active, created_by, created_at FROM webhook_subscription`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (WebhookSubscription, error) {
+	var w WebhookSubscription
+	err := row.Scan(&w.ID, &w.URL, pq.Array(&w.EventTypes), &w.Active, &w.CreatedBy, &w.CreatedAt)
+	return w, err
+}
+
+func GetWebhooks(c *gin.Context) {
+	rows, err := db.Query(webhookSelectSQL + " ORDER BY id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	hooks := []WebhookSubscription{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan webhooks"})
+			return
+		}
+		hooks = append(hooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// createWebhook регистрирует подписку; секрет для подписи возвращается только в этом ответе.
+func createWebhook(c *gin.Context) {
+	userID := c.MustGet("userClaims").(jwt.MapClaims)["user_id"].(string)
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		req.Secret = hex.EncodeToString(buf)
+	}
+	active := req.Active == nil || *req.Active
+
+	w, err := scanWebhook(db.QueryRow(`
+        INSERT INTO webhook_subscription (url, secret, event_types, active, created_by)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, url, event_types, active, created_by, created_at
+    `, req.URL, req.Secret, pq.Array(req.EventTypes), active, userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert into webhook_subscription"})
+		return
+	}
+	w.Secret = req.Secret
+	c.JSON(http.StatusCreated, w)
+}
+
+// updateWebhook меняет адрес, типы событий и активность; пустой secret оставляет прежний.
+func updateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	w, err := scanWebhook(db.QueryRow(`
+        UPDATE webhook_subscription SET
+            url = $2, event_types = $3, active = COALESCE($4, active),
+            secret = COALESCE(NULLIF($5, ''), secret)
+        WHERE id = $1
+        RETURNING id, url, event_types, active, created_by, created_at
+    `, c.Param("id"), req.URL, pq.Array(req.EventTypes), req.Active, req.Secret))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook_subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+func deleteWebhook(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM webhook_subscription WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+const webhookDeliverySelectSQL = `
+    SELECT id, subscription_id, event_type, payload, status, attempts, next_attempt_at,
+        last_status_code, last_error, created_at, delivered_at
+    FROM webhook_delivery`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload []byte
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+	d.Payload = payload
+	return d, err
+}
+
+// GetWebhookDeliveries — журнал доставок; ?status=dead показывает dead-letter список.
+func GetWebhookDeliveries(c *gin.Context) {
+	qb := &queryBuilder{}
+	if err := qb.inFilter(c, "subscription_id", "subscription_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		qb.where("status = %s", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		qb.where("event_type = %s", eventType)
+	}
+
+	rows, err := db.Query(webhookDeliverySelectSQL+qb.whereSQL()+" ORDER BY id DESC LIMIT 200", qb.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan deliveries"})
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func GetWebhookDelivery(c *gin.Context) {
+	d, err := scanWebhookDelivery(db.QueryRow(webhookDeliverySelectSQL+" WHERE id = $1", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT attempted_at, status_code, error, duration_ms FROM webhook_attempt
+        WHERE delivery_id = $1 ORDER BY attempted_at, id
+    `, d.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+	d.Log = []WebhookAttempt{}
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMS); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan attempts"})
+			return
+		}
+		d.Log = append(d.Log, a)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// redeliverWebhook возвращает доставку в очередь с полным запасом попыток — в том числе из dead-letter.
+func redeliverWebhook(c *gin.Context) {
+	d, err := scanWebhookDelivery(db.QueryRow(`
+        UPDATE webhook_delivery SET status = 'pending', attempts = 0, next_attempt_at = NOW(), delivered_at = NULL
+        WHERE id = $1
+        RETURNING id, subscription_id, event_type, payload, status, attempts, next_attempt_at,
+            last_status_code, last_error, created_at, delivered_at
+    `, c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook_delivery"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
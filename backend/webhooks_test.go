@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		20: 6 * time.Hour,
+	}
+	for attempt, expected := range cases {
+		if got := webhookBackoff(attempt); got != expected {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", attempt, got, expected)
+		}
+	}
+}
+
+func TestSendWebhookSignsPayload(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	payload := []byte(`{"event":"employee.hired","data":{"employee_id":5}}`)
+	now := time.Unix(1700000000, 0)
+	code, err := sendWebhook(receiver.Client(), receiver.URL, "s3cret", 17, "employee.hired", payload, now)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("unexpected result: %d %v", code, err)
+	}
+
+	if string(body) != string(payload) {
+		t.Errorf("unexpected body %s", body)
+	}
+	if got.Header.Get("X-Webhook-Event") != "employee.hired" || got.Header.Get("X-Webhook-Delivery") != "17" {
+		t.Errorf("unexpected headers: %v", got.Header)
+	}
+	timestamp, _ := strconv.ParseInt(got.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if sig := got.Header.Get("X-Webhook-Signature"); sig != webhookSignature("s3cret", timestamp, body) || timestamp != now.Unix() {
+		t.Errorf("signature %s does not match", sig)
+	}
+}
+
+func TestSendWebhookFailures(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/ok", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	client := &http.Client{CheckRedirect: webhookClient.CheckRedirect}
+	if code, err := sendWebhook(client, receiver.URL, "s", 1, "employee.deleted", []byte("{}"), time.Now()); err == nil || code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 to fail, got %d %v", code, err)
+	}
+	if code, err := sendWebhook(client, receiver.URL+"/redirect", "s", 1, "employee.deleted", []byte("{}"), time.Now()); err == nil || code != http.StatusFound {
+		t.Errorf("expected redirect not to be followed, got %d %v", code, err)
+	}
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	err503 := errors.New("unexpected status 503 Service Unavailable")
+	if status, retry := nextWebhookState(2, err503); status != "pending" || retry != time.Minute {
+		t.Errorf("unexpected state after 2 attempts: %s %v", status, retry)
+	}
+	if status, _ := nextWebhookState(3, err503); status != "dead" {
+		t.Errorf("expected dead-letter after max attempts, got %s", status)
+	}
+	if status, _ := nextWebhookState(3, nil); status != "delivered" {
+		t.Errorf("expected delivered, got %s", status)
+	}
+}
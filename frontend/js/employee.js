@@ -60,21 +60,19 @@ document.addEventListener('DOMContentLoaded', async () => {
     const readList = document.getElementById('readList');
     const notRead = document.querySelector('.not-read');
     const Read = document.querySelector('.read');
-    let countread = 0;
-    let countnotread = 0;
-
-    try {
+    // Перерисовывает входящие по /api/messages; вызывается при загрузке и при событиях по заявкам
+    async function loadMessages(initial = false) {
         const messageResponse = await fetch("/api/messages");
-        if (!messageResponse.ok) {
-            Read.classList.add('hidden');
-            notRead.classList.add('hidden');
-        }
-        else if (messageResponse.ok){
+        notReadList.replaceChildren();
+        readList.replaceChildren();
+        let countread = 0;
+        let countnotread = 0;
+
+        if (messageResponse.ok) {
             const messages = await messageResponse.json();
 
-            if (messages.length === 0) {
+            if (messages.length === 0 && initial) {
                 alert('Нет доступных сообщений');
-                return;
             }
 
             for (const message of messages) {
@@ -87,7 +85,7 @@ document.addEventListener('DOMContentLoaded', async () => {
                         <span class="message-title-fio">${message.employee_name}</span>
                     </div>
                     <div class="message-info">
-                        <span class="message-age">Возраст: ${message.age}</span>
+                        <span class="message-age">Возраст: ${message.age ?? "не указан"}</span>
                         <span class="message-job">Должность: ${message.job_title}</span>
                         <span class="message-subdivision">Подразделение: ${message.subdivision}</span>
                         <span class="message-languages">Языки: ${message.languages.map(lang => `${lang.language} (${lang.proficiency})`).join(', ')}</span>
@@ -122,9 +120,14 @@ document.addEventListener('DOMContentLoaded', async () => {
         } else {
             notRead.classList.remove('hidden');
         }
+        return messageResponse.ok;
+    }
+
+    try {
+        const messagesLoaded = await loadMessages(true);
 
         const messageForRead = await fetch("/api/messagesread")
-        if (!messageResponse.ok) throw new Error('Ошибка обновления статуса сообщений');
+        if (!messagesLoaded) throw new Error('Ошибка обновления статуса сообщений');
 
         document.body.addEventListener('click', async (event) => {
             const target = event.target;
@@ -141,7 +144,7 @@ document.addEventListener('DOMContentLoaded', async () => {
                         const errorData = await response.json();
                         throw new Error(errorData.error || 'Ошибка принятия заявки');
                     }
-                    location.reload();
+                    await loadMessages();
                 } catch (error) {
                     console.error('Ошибка:', error);
                     alert('Не удалось принять заявку');
@@ -161,7 +164,7 @@ document.addEventListener('DOMContentLoaded', async () => {
                         const errorData = await response.json();
                         throw new Error(errorData.error || 'Ошибка отклонения заявки');
                     }
-                    location.reload();
+                    await loadMessages();
                 } catch (error) {
                     console.error('Ошибка:', error);
                     alert('Не удалось отклонить заявку');
@@ -169,6 +172,18 @@ document.addEventListener('DOMContentLoaded', async () => {
             }
         });
 
+        // Живое обновление входящих: решённые заявки убираем, при новых и изменённых перечитываем список
+        const events = new EventSource('/api/bids/events', { withCredentials: true });
+        events.addEventListener('bid.decided', (event) => {
+            const { bid_id } = JSON.parse(event.data);
+            document.querySelector(`[data-message-id="${bid_id}"]`)?.remove();
+        });
+        for (const kind of ['bid.created', 'bid.updated', 'reset']) {
+            events.addEventListener(kind, () => {
+                loadMessages().catch(error => console.error('Ошибка обновления сообщений:', error));
+            });
+        }
+
     } catch (error) {
         console.error('Ошибка загрузки данных сообщений:', error);
     }
@@ -468,7 +483,7 @@ async function loadTableData(tableType, filters = {}) {
             row.innerHTML = `
                 <td>${item.id}</td>
                 <td>${item.fio}</td>
-                <td>${item.age}</td>
+                <td>${item.age ?? ""}</td>
                 <td>${item.job_title_id}</td>
                 <td>${item.subdivision_id}</td>
                 <td>${item.overall_experience}</td>
@@ -582,7 +597,8 @@ async function saveEdit() {
 
         const editedItem = {
             fio: document.getElementById('editFio').value.trim(),
-            age: parseInt(document.getElementById('editAge').value, 10) || 0,
+            // Пустое поле — возраст неизвестен, сохранённая дата рождения не меняется
+            age: document.getElementById('editAge').value === '' ? null : parseInt(document.getElementById('editAge').value, 10),
             job_title_id: parseInt(document.getElementById('editJobTitle').value, 10) || 0,
             subdivision_id: parseInt(document.getElementById('editSubdivision').value, 10) || 0,
             overall_experience: parseInt(document.getElementById('editOverallExp').value, 10) || 0,
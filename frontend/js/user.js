@@ -66,6 +66,10 @@ document.addEventListener('DOMContentLoaded', async () => {
         alert('Не удалось загрузить данные для выпадающих списков');
     }
 
+    await loadVacancies();
+    await restoreDraft();
+    applyVacancy();
+
     const languageResponse = await fetch('/api/languages');
     if (!languageResponse.ok) throw new Error('Ошибка загрузки языков');
     const languages = await languageResponse.json();
@@ -193,6 +197,119 @@ document.querySelector('.logout').addEventListener('click', async (event) => {
     }
 });
 
+// Открытые вакансии: выбранная вакансия сама задаёт должность и подразделение заявки
+const vacancies = new Map();
+
+async function loadVacancies() {
+    try {
+        const response = await fetch('/api/vacancies');
+        if (!response.ok) throw new Error('Ошибка загрузки вакансий');
+        const vacancySelect = document.getElementById('vacancy');
+        (await response.json()).forEach(vacancy => {
+            vacancies.set(String(vacancy.id), vacancy);
+            const option = document.createElement('option');
+            option.value = vacancy.id;
+            option.textContent = `${vacancy.job_title} — ${vacancy.subdivision}`;
+            vacancySelect.appendChild(option);
+        });
+    } catch (error) {
+        console.error('Ошибка:', error);
+    }
+}
+
+function applyVacancy() {
+    const vacancy = vacancies.get(document.getElementById('vacancy').value);
+    ['job_title', 'subdivision'].forEach(field => {
+        const select = document.getElementById(field);
+        select.disabled = Boolean(vacancy);
+        select.required = !vacancy;
+        if (vacancy) {
+            select.value = vacancy[`${field}_id`];
+        }
+    });
+}
+
+document.getElementById('vacancy').addEventListener('change', applyVacancy);
+
+function selectedVacancyId() {
+    const value = document.getElementById('vacancy').value;
+    return value === '' ? null : parseInt(value);
+}
+
+// Черновик заявки сохраняется на сервере, чтобы заполненная форма не терялась при закрытии вкладки
+const draftFields = ['fio', 'age', 'overall_experience', 's_p_experience', 'vacancy', 'job_title', 'subdivision'];
+let draftId = null;
+let draftTimer = null;
+let draftSave = Promise.resolve();
+
+function collectDraft() {
+    const value = (id) => document.getElementById(id).value;
+    const number = (id) => value(id) === '' ? null : parseInt(value(id));
+    return {
+        fio: value('fio') || null,
+        age: number('age'),
+        overall_experience: number('overall_experience'),
+        s_p_experience: number('s_p_experience'),
+        vacancy_id: selectedVacancyId(),
+        job_title_id: number('job_title'),
+        subdivision_id: number('subdivision')
+    };
+}
+
+async function saveDraft() {
+    try {
+        const response = await fetch(draftId ? `/api/drafts/${draftId}` : '/api/drafts', {
+            method: draftId ? 'PATCH' : 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            credentials: 'include',
+            body: JSON.stringify({ data: collectDraft() })
+        });
+        if (!response.ok) throw new Error('Ошибка сохранения черновика');
+        const draft = await response.json();
+        draftId = draft.id;
+    } catch (error) {
+        console.error('Ошибка:', error);
+    }
+}
+
+async function restoreDraft() {
+    try {
+        const response = await fetch('/api/drafts', { credentials: 'include' });
+        if (!response.ok) return;
+        const drafts = await response.json();
+        if (drafts.length === 0) return;
+
+        draftId = drafts[0].id;
+        const data = drafts[0].data;
+        const keys = { vacancy: 'vacancy_id', job_title: 'job_title_id', subdivision: 'subdivision_id' };
+        draftFields.forEach(field => {
+            const stored = data[keys[field] || field];
+            if (stored !== undefined && stored !== null) {
+                document.getElementById(field).value = stored;
+            }
+        });
+    } catch (error) {
+        console.error('Ошибка загрузки черновика:', error);
+    }
+}
+
+async function discardDraft() {
+    clearTimeout(draftTimer);
+    await draftSave;
+    if (!draftId) return;
+    await fetch(`/api/drafts/${draftId}`, { method: 'DELETE', credentials: 'include' });
+    draftId = null;
+}
+
+// Один ключ на заполнение формы: повторная отправка той же формы не создаст вторую заявку
+let idempotencyKey = null;
+document.getElementById('applicationForm').addEventListener('input', () => {
+    idempotencyKey = null;
+    clearTimeout(draftTimer);
+    // Сохранения идут по очереди, чтобы первое успело создать черновик
+    draftTimer = setTimeout(() => { draftSave = draftSave.then(saveDraft); }, 1000);
+});
+
 document.getElementById('applicationForm').addEventListener('submit', async (e) => {
     e.preventDefault();
 
@@ -225,6 +342,7 @@ document.getElementById('applicationForm').addEventListener('submit', async (e)
         age: parseInt(document.getElementById('age').value),
         overall_experience: parseInt(document.getElementById('overall_experience').value),
         s_p_experience: parseInt(document.getElementById('s_p_experience').value),
+        vacancy_id: selectedVacancyId(),
         job_title_id: parseInt(document.getElementById('job_title').value),
         subdivision_id: parseInt(document.getElementById('subdivision').value),
         languages: [],
@@ -245,10 +363,14 @@ document.getElementById('applicationForm').addEventListener('submit', async (e)
         formData.educations.push({ education_id: educationID, place });
     });
 
+    if (!idempotencyKey) {
+        idempotencyKey = crypto.randomUUID();
+    }
+
     try {
         const response = await fetch('/api/submit-application', {
             method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
+            headers: { 'Content-Type': 'application/json', 'Idempotency-Key': idempotencyKey },
             body: JSON.stringify(formData)
         });
 
@@ -258,6 +380,9 @@ document.getElementById('applicationForm').addEventListener('submit', async (e)
 
         alert('Заявка успешно отправлена!');
         document.getElementById('applicationForm').reset();
+        applyVacancy();
+        idempotencyKey = null;
+        await discardDraft();
     } catch (error) {
         console.error('Ошибка:', error);
         alert('Не удалось отправить заявку');